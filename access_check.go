@@ -0,0 +1,558 @@
+package winsddlconverter
+
+import "fmt"
+
+// GroupAttributes are the SE_GROUP_* attributes of a token group.
+type GroupAttributes uint32
+
+const (
+	SE_GROUP_MANDATORY          GroupAttributes = 0x00000001
+	SE_GROUP_ENABLED_BY_DEFAULT GroupAttributes = 0x00000002
+	SE_GROUP_ENABLED            GroupAttributes = 0x00000004
+	SE_GROUP_OWNER              GroupAttributes = 0x00000008
+	SE_GROUP_USE_FOR_DENY_ONLY  GroupAttributes = 0x00000010
+	SE_GROUP_INTEGRITY          GroupAttributes = 0x00000020
+	SE_GROUP_INTEGRITY_ENABLED  GroupAttributes = 0x00000040
+	SE_GROUP_RESOURCE           GroupAttributes = 0x20000000
+	SE_GROUP_LOGON_ID           GroupAttributes = 0xC0000000
+)
+
+// TokenGroup is a group SID of a token, a SID string or alias.
+type TokenGroup struct {
+	Sid        string          `json:"sid"`
+	Attributes GroupAttributes `json:"attributes"`
+}
+
+// Token is the security context access is evaluated for, like a Windows access token.
+// Well-known groups such as Everyone and Authenticated Users match only if listed.
+type Token struct {
+	// User is the user SID or alias. It is always enabled.
+	User   string       `json:"user"`
+	Groups []TokenGroup `json:"groups,omitempty"`
+	// Privileges are the enabled privileges, e.g. SE_BACKUP_NAME
+	Privileges PrivilegeSet `json:"privileges,omitempty"`
+	// MandatoryPolicy is the mandatory policy of the token. If nil, it is
+	// TOKEN_MANDATORY_POLICY_VALID_MASK like for ordinary tokens. The integrity level is that
+	// of the group with SE_GROUP_INTEGRITY_ENABLED, see IntegrityLevel.
+	MandatoryPolicy *TokenMandatoryPolicy `json:"mandatoryPolicy,omitempty"`
+
+	// AppContainerSid is the package SID, S-1-15-2-..., of an AppContainer token
+	AppContainerSid string `json:"appContainerSid,omitempty"`
+	// Capabilities are the capability SIDs, S-1-15-3-..., of an AppContainer token
+	Capabilities []TokenGroup `json:"capabilities,omitempty"`
+	// LessPrivilegedAppContainer is not matched by ALL APPLICATION PACKAGES
+	LessPrivilegedAppContainer bool `json:"lessPrivilegedAppContainer,omitempty"`
+	// RestrictingSids make a restricted token, see CreateRestrictedToken. They are always enabled.
+	RestrictingSids []TokenGroup `json:"restrictingSids,omitempty"`
+	// WriteRestricted checks RestrictingSids for write access only
+	WriteRestricted bool `json:"writeRestricted,omitempty"`
+
+	// UserClaims and DeviceClaims are read by conditional ACEs as @User. and @Device.
+	UserClaims   []Claim `json:"userClaims,omitempty"`
+	DeviceClaims []Claim `json:"deviceClaims,omitempty"`
+	// DeviceGroups are the groups of the device, tested by Device_Member_of
+	DeviceGroups []TokenGroup `json:"deviceGroups,omitempty"`
+}
+
+// tokenSids indexes the SIDs of a token by their SID string.
+type tokenSids map[string]GroupAttributes
+
+func newTokenSids(user string, groups []TokenGroup) tokenSids {
+	sids := tokenSids{}
+	if user != "" {
+		sids[GetRawSid(user)] = SE_GROUP_ENABLED
+	}
+	for _, group := range groups {
+		sids[GetRawSid(group.Sid)] |= group.Attributes
+	}
+	return sids
+}
+
+// contains reports whether sid matches an enabled SID, or also a deny-only SID for deny ACEs.
+func (s tokenSids) contains(sid string, deny bool) bool {
+	attributes, ok := s[GetRawSid(sid)]
+	if !ok {
+		return false
+	}
+	return attributes&SE_GROUP_ENABLED != 0 || (deny && attributes&SE_GROUP_USE_FOR_DENY_ONLY != 0)
+}
+
+// GenericMapping maps the generic rights to the specific and standard rights of a kind of object.
+type GenericMapping struct {
+	GenericRead    AccessMask `json:"genericRead"`
+	GenericWrite   AccessMask `json:"genericWrite"`
+	GenericExecute AccessMask `json:"genericExecute"`
+	GenericAll     AccessMask `json:"genericAll"`
+}
+
+var (
+	FileGenericMapping = GenericMapping{
+		GenericRead:    0x00120089,
+		GenericWrite:   0x00120116,
+		GenericExecute: 0x001200a0,
+		GenericAll:     FILE_ALL_ACCESS,
+	}
+	RegistryGenericMapping = GenericMapping{
+		GenericRead:    0x00020019,
+		GenericWrite:   0x00020006,
+		GenericExecute: 0x00020019,
+		GenericAll:     0x000f003f,
+	}
+	DirectoryServiceGenericMapping = GenericMapping{
+		GenericRead:    0x00020094,
+		GenericWrite:   0x00020028,
+		GenericExecute: 0x00020004,
+		GenericAll:     0x000f01ff,
+	}
+	// ShareGenericMapping maps generic rights of share permissions to the rights of the
+	// Read, Change and Full Control permissions
+	ShareGenericMapping = GenericMapping{
+		GenericRead:    0x001200a9,
+		GenericWrite:   0x00130116,
+		GenericExecute: 0x001200a0,
+		GenericAll:     FILE_ALL_ACCESS,
+	}
+)
+
+// Map replaces the generic rights of mask with the rights they stand for, like MapGenericMask.
+func (m *GenericMapping) Map(mask AccessMask) AccessMask {
+	if mask.Has(GENERIC_READ) {
+		mask |= m.GenericRead
+	}
+	if mask.Has(GENERIC_WRITE) {
+		mask |= m.GenericWrite
+	}
+	if mask.Has(GENERIC_EXECUTE) {
+		mask |= m.GenericExecute
+	}
+	if mask.Has(GENERIC_ALL) {
+		mask |= m.GenericAll
+	}
+	return mask &^ (GENERIC_READ | GENERIC_WRITE | GENERIC_EXECUTE | GENERIC_ALL)
+}
+
+// GenericMapping returns the generic mapping of the kind of object the profile describes.
+func (p RightsProfile) GenericMapping() GenericMapping {
+	switch p {
+	case RegistryRights:
+		return RegistryGenericMapping
+	case DirectoryServiceRights:
+		return DirectoryServiceGenericMapping
+	case ShareRights:
+		return ShareGenericMapping
+	default:
+		return FileGenericMapping
+	}
+}
+
+// AccessCheckOptions controls AccessCheck.
+type AccessCheckOptions struct {
+	// Profile names rights in the trace and selects the generic mapping when Mapping is nil
+	Profile RightsProfile
+	// Mapping maps generic rights of the desired access
+	Mapping *GenericMapping
+	// MapAceGenericRights also maps generic rights in ACEs. Windows maps them when an object
+	// is created, so ACEs of real objects have none, but SDDL templates often do.
+	MapAceGenericRights bool
+	// BackupIntent opens the object for backup, like FILE_FLAG_BACKUP_SEMANTICS. SE_BACKUP_NAME
+	// then grants read and SE_RESTORE_NAME write access to files regardless of the DACL.
+	BackupIntent bool
+	// CentralAccessPolicies are the policies that SP ACEs in the SACL refer to. Without a
+	// store SP ACEs are ignored.
+	CentralAccessPolicies *CentralAccessPolicyStore
+	// Trace records in AccessCheckResult.Trace how each right was decided
+	Trace bool
+}
+
+// AccessStatus is the outcome of an access check.
+type AccessStatus uint8
+
+const (
+	AccessGranted AccessStatus = iota
+	AccessDenied
+	// AccessPrivilegeNotHeld means ACCESS_SYSTEM_SECURITY was requested without SE_SECURITY_NAME
+	AccessPrivilegeNotHeld
+)
+
+func (s AccessStatus) String() string {
+	switch s {
+	case AccessGranted:
+		return "granted"
+	case AccessDenied:
+		return "denied"
+	case AccessPrivilegeNotHeld:
+		return "privilege not held"
+	default:
+		return "?"
+	}
+}
+
+// ProposedAccessResult is the outcome of an access check with staged permissions.
+type ProposedAccessResult struct {
+	Status        AccessStatus `json:"status"`
+	GrantedAccess AccessMask   `json:"grantedAccess"`
+	Missing       AccessMask   `json:"missing"`
+}
+
+// AccessCheckResult is the outcome of AccessCheck.
+type AccessCheckResult struct {
+	Status AccessStatus `json:"status"`
+	// GrantedAccess is 0 if denied, like AccessCheck. Otherwise it is the mapped desired access,
+	// or every right the token has when MAXIMUM_ALLOWED was requested.
+	GrantedAccess AccessMask `json:"grantedAccess"`
+	// Missing are the desired rights that were not granted
+	Missing AccessMask `json:"missing"`
+	// ResultList has the result of each entry of the object type list, see AccessCheckByType
+	ResultList []ObjectTypeResult `json:"resultList,omitempty"`
+	// Proposed is the outcome with the proposed permissions of staged central access rules,
+	// see CentralAccessRule.ProposedPermissions. Only Status, GrantedAccess and Missing are enforced.
+	Proposed *ProposedAccessResult `json:"proposed,omitempty"`
+	// PrivilegesUsed are the privileges that granted rights
+	PrivilegesUsed []string          `json:"privilegesUsed,omitempty"`
+	Trace          []AccessTraceStep `json:"trace,omitempty"`
+}
+
+// accessEvaluator holds the state of one access check.
+type accessEvaluator struct {
+	sd      *SecurityDescriptor
+	token   *Token
+	opts    *AccessCheckOptions
+	mapping *GenericMapping
+	passes  []accessPass
+	// objectTypes is the object type list, or only the object itself
+	objectTypes []ObjectTypeNode
+	parents     []int
+	// dacl is the DACL or the permissions of the central access rule being evaluated
+	dacl *Acl
+	// rules are the central access rules that apply, rule names the one being evaluated
+	rules []centralAccessRule
+	rule  string
+	// pass is the pass being evaluated
+	pass *accessPass
+	// resource are the resource attributes for conditional ACEs
+	resource []Claim
+
+	privilegesUsed []string
+	trace          []AccessTraceStep
+}
+
+func newAccessEvaluator(sd *SecurityDescriptor, token *Token, opts *AccessCheckOptions) (*accessEvaluator, error) {
+	if sd.Owner == "" || sd.Group == "" {
+		return nil, fmt.Errorf("security descriptor without owner or group cannot be access checked")
+	}
+	if token == nil || token.User == "" {
+		return nil, fmt.Errorf("token without user")
+	}
+	if opts == nil {
+		opts = &AccessCheckOptions{}
+	}
+	e := &accessEvaluator{sd: sd, token: token, opts: opts, mapping: opts.Mapping}
+	if e.mapping == nil {
+		mapping := opts.Profile.GenericMapping()
+		e.mapping = &mapping
+	}
+	var err error
+	if e.resource, err = sd.ResourceAttributes(); err != nil {
+		return nil, err
+	}
+	e.passes = newAccessPasses(token, sd.Owner)
+	e.objectTypes = []ObjectTypeNode{{Level: ACCESS_OBJECT_GUID}}
+	e.parents = []int{-1}
+	if err := e.applyCentralAccessPolicies(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// aceMask returns the rights of an ACE. ACEs never grant ACCESS_SYSTEM_SECURITY.
+func (e *accessEvaluator) aceMask(ace *Ace) AccessMask {
+	mask := ace.AccessMask
+	if e.opts.MapAceGenericRights {
+		mask = e.mapping.Map(mask)
+	}
+	return mask &^ ACCESS_SYSTEM_SECURITY
+}
+
+// aceSidMatches reports whether an ACE applies to the token. OWNER RIGHTS applies to the owner.
+func (e *accessEvaluator) aceSidMatches(ace *Ace, deny bool) bool {
+	if GetRawSid(ace.Sid) == "S-1-3-4" {
+		return e.pass.owner
+	}
+	return e.pass.sids.contains(ace.Sid, deny)
+}
+
+// hasOwnerRightsAce reports whether an effective DACL ACE is for OWNER RIGHTS,
+// which replaces the implicit READ_CONTROL and WRITE_DAC of the owner.
+func (e *accessEvaluator) hasOwnerRightsAce() bool {
+	return e.dacl.Find(And(BySid("S-1-3-4"), Not(isInheritOnlyAce))) >= 0
+}
+
+func isInheritOnlyAce(ace *Ace) bool {
+	return ace.AceFlags.Has(INHERIT_ONLY_ACE)
+}
+
+// daclAccess walks the DACL in order and returns the rights granted to each object type.
+// An ACE grants or denies only the bits no earlier ACE decided, so deny ACEs win only if
+// they come first. granted is the previously granted access.
+func (e *accessEvaluator) daclAccess(granted AccessMask) []AccessMask {
+	nodes := len(e.objectTypes)
+	grants := make([]AccessMask, nodes)
+	denies := make([]AccessMask, nodes)
+	for i := range grants {
+		grants[i] = granted
+	}
+	for i := range e.dacl.Aces {
+		ace := &e.dacl.Aces[i]
+		if isInheritOnlyAce(ace) {
+			continue
+		}
+		var deny bool
+		// target is the object type the ACE applies to, along with its subtree
+		target := 0
+		switch ace.AceType {
+		case ACCESS_ALLOWED_ACE_TYPE, ACCESS_ALLOWED_CALLBACK_ACE_TYPE:
+		case ACCESS_DENIED_ACE_TYPE, ACCESS_DENIED_CALLBACK_ACE_TYPE:
+			deny = true
+		case ACCESS_ALLOWED_OBJECT_ACE_TYPE, ACCESS_DENIED_OBJECT_ACE_TYPE,
+			ACCESS_ALLOWED_CALLBACK_OBJECT_ACE_TYPE, ACCESS_DENIED_CALLBACK_OBJECT_ACE_TYPE:
+			if ace.ObjectType != "" {
+				if target = e.findObjectType(ace.ObjectType); target < 0 {
+					continue
+				}
+			}
+			deny = ace.AceType == ACCESS_DENIED_OBJECT_ACE_TYPE || ace.AceType == ACCESS_DENIED_CALLBACK_OBJECT_ACE_TYPE
+		default:
+			continue
+		}
+		if !e.aceSidMatches(ace, deny) {
+			continue
+		}
+		// condition is the result of the condition of a callback ACE, for the trace
+		var condition string
+		if ace.AceType.IsCallback() {
+			result, applies := e.aceCondition(i, ace, deny)
+			if !applies {
+				continue
+			}
+			condition = result.String()
+		}
+		mask := e.aceMask(ace)
+		undecided := mask &^ (grants[target] | denies[target])
+		if deny {
+			e.traceAce(i, ace, 0, undecided, condition)
+		} else {
+			e.traceAce(i, ace, undecided, 0, condition)
+		}
+		end := e.subtreeEnd(target)
+		for j := target; j < end; j++ {
+			if deny {
+				denies[j] |= mask &^ grants[j]
+			} else {
+				grants[j] |= mask &^ denies[j]
+			}
+		}
+		// access to an object type includes access to its children, so a deny propagates
+		// to the ancestors, and a grant once all siblings have it
+		for p := e.parents[target]; p >= 0; p = e.parents[p] {
+			if deny {
+				denies[p] |= mask &^ grants[p]
+				continue
+			}
+			all := ^AccessMask(0)
+			for c := p + 1; c < e.subtreeEnd(p); c++ {
+				if e.parents[c] == p {
+					all &= grants[c]
+				}
+			}
+			grants[p] |= all &^ denies[p]
+		}
+	}
+	return grants
+}
+
+// aceCondition evaluates the condition of a callback ACE and reports whether the ACE applies.
+// An allow ACE applies if it is TRUE, a deny ACE also if it is UNKNOWN. Callback ACEs without
+// a conditional expression need the application that wrote them and never apply.
+func (e *accessEvaluator) aceCondition(index int, ace *Ace, deny bool) (ConditionResult, bool) {
+	result := ConditionUnknown
+	if ace.IsConditional() {
+		tokens, err := decodeCondition(ace.ApplicationData)
+		if err == nil {
+			context := newConditionContext(e.token, e.pass.sids, e.resource)
+			context.deny = deny
+			result, _ = context.evaluate(tokens)
+		}
+	} else if deny {
+		result = ConditionFalse
+	}
+	applies := result == ConditionTrue || deny && result == ConditionUnknown
+	if !applies {
+		e.traceCondition(index, ace, result)
+	}
+	return result, applies
+}
+
+// passAccess returns the rights the DACL grants to each object type in the current pass.
+func (e *accessEvaluator) passAccess(granted AccessMask) []AccessMask {
+	if e.pass.owner {
+		if e.hasOwnerRightsAce() {
+			e.traceStep(0, 0, "the owner is not granted READ_CONTROL and WRITE_DAC because the DACL has an OWNER RIGHTS ACE")
+		} else {
+			implicit := AccessMask(READ_CONTROL|WRITE_DAC) &^ granted
+			granted |= implicit
+			e.traceStep(implicit, 0, "the owner is granted %s", e.rightNames(implicit))
+		}
+	}
+	grants := e.daclAccess(granted)
+	if e.pass.writeOnly {
+		for i := range grants {
+			grants[i] |= ^e.writeRights()
+		}
+	}
+	return grants
+}
+
+// writeRights returns the rights that modify the object.
+func (e *accessEvaluator) writeRights() AccessMask {
+	return (e.mapping.GenericWrite | DELETE | WRITE_DAC | WRITE_OWNER) &^ (READ_CONTROL | SYNCHRONIZE)
+}
+
+// aclGrants returns the rights an ACL grants to each object type, intersected over the passes
+// of the token. A nil ACL grants everything. privileged are the rights privileges grant.
+func (e *accessEvaluator) aclGrants(acl *Acl, privileged AccessMask, desired AccessMask) []AccessMask {
+	grants := make([]AccessMask, len(e.objectTypes))
+	if acl == nil {
+		all := (desired | e.mapping.GenericAll) &^ ACCESS_SYSTEM_SECURITY
+		e.traceStep(all, 0, "the NULL DACL grants all access")
+		for i := range grants {
+			grants[i] = privileged | all
+		}
+		return grants
+	}
+	for i := range grants {
+		grants[i] = ^AccessMask(0)
+	}
+	e.dacl = acl
+	for i := range e.passes {
+		e.pass = &e.passes[i]
+		for j, granted := range e.passAccess(privileged) {
+			grants[j] &= granted
+		}
+	}
+	e.pass = nil
+	return grants
+}
+
+// grantedAccess returns for each object type the desired rights the token has,
+// or every right when maximum is set. staged is the same with the proposed permissions
+// of central access rules, or nil if no rule has any.
+func (e *accessEvaluator) grantedAccess(desired AccessMask, maximum bool) (grants []AccessMask, staged []AccessMask) {
+	wanted := desired
+	if maximum {
+		// ACCESS_SYSTEM_SECURITY is granted only when asked for
+		wanted = ^AccessMask(ACCESS_SYSTEM_SECURITY|MAXIMUM_ALLOWED|GENERIC_ALL|GENERIC_EXECUTE|GENERIC_WRITE|GENERIC_READ) |
+			desired&ACCESS_SYSTEM_SECURITY
+	}
+	mandatory := e.mandatoryDenied()
+	privileged := e.privilegeAccess(wanted &^ mandatory)
+
+	grants = e.aclGrants(e.sd.DiscretionaryAcl, privileged, desired)
+	if e.staging() {
+		staged = append([]AccessMask{}, grants...)
+	}
+	for i := range e.rules {
+		rule := &e.rules[i]
+		e.rule = rule.name
+		for j, granted := range e.aclGrants(rule.permissions, privileged, desired) {
+			grants[j] &= granted
+		}
+		if staged != nil {
+			permissions := rule.permissions
+			if rule.proposed != nil {
+				e.rule = rule.name + " (proposed)"
+				permissions = rule.proposed
+			}
+			for j, granted := range e.aclGrants(permissions, privileged, desired) {
+				staged[j] &= granted
+			}
+		}
+	}
+	e.rule = ""
+
+	for i := range grants {
+		grants[i] &^= mandatory
+		if staged != nil {
+			staged[i] &^= mandatory
+		}
+	}
+	if desired.Has(ACCESS_SYSTEM_SECURITY) && !grants[0].Has(ACCESS_SYSTEM_SECURITY) {
+		e.traceStep(0, ACCESS_SYSTEM_SECURITY, "ACCESS_SYSTEM_SECURITY requires %s", SE_SECURITY_NAME)
+	}
+	return grants, staged
+}
+
+// accessStatus decides the outcome for the rights granted to an object type.
+func accessStatus(desired AccessMask, maximum bool, granted AccessMask) (AccessStatus, AccessMask, AccessMask) {
+	missing := desired &^ granted
+	switch {
+	case missing.Has(ACCESS_SYSTEM_SECURITY):
+		return AccessPrivilegeNotHeld, 0, missing
+	case missing != 0:
+		return AccessDenied, 0, missing
+	case maximum && granted != 0:
+		return AccessGranted, granted, 0
+	case !maximum && desired != 0:
+		return AccessGranted, desired, 0
+	default:
+		return AccessDenied, 0, 0
+	}
+}
+
+// check evaluates the access to the object, and with resultList to every object type.
+func (e *accessEvaluator) check(desired AccessMask, resultList bool) *AccessCheckResult {
+	maximum := desired.Has(MAXIMUM_ALLOWED)
+	desired = e.mapping.Map(desired &^ MAXIMUM_ALLOWED)
+
+	grants, staged := e.grantedAccess(desired, maximum)
+
+	result := &AccessCheckResult{PrivilegesUsed: e.privilegesUsed, Trace: e.trace}
+	result.Status, result.GrantedAccess, result.Missing = accessStatus(desired, maximum, grants[0])
+	if staged != nil {
+		result.Proposed = &ProposedAccessResult{}
+		result.Proposed.Status, result.Proposed.GrantedAccess, result.Proposed.Missing = accessStatus(desired, maximum, staged[0])
+	}
+	if resultList {
+		for i, granted := range grants {
+			node := ObjectTypeResult{ObjectType: e.objectTypes[i].ObjectType}
+			node.Status, node.GrantedAccess, node.Missing = accessStatus(desired, maximum, granted)
+			result.ResultList = append(result.ResultList, node)
+		}
+	}
+	return result
+}
+
+// AccessCheck evaluates the DACL for token like the AccessCheck function.
+// Deny ACEs take effect only where they precede the allow ACEs of the same rights,
+// a NULL DACL grants everything and an empty DACL nothing. The owner is granted
+// READ_CONTROL and WRITE_DAC unless the DACL has an OWNER RIGHTS ACE.
+// The mandatory label of the SACL first denies rights to tokens of a lower integrity level.
+// SE_TAKE_OWNERSHIP_NAME grants WRITE_OWNER and SE_SECURITY_NAME ACCESS_SYSTEM_SECURITY,
+// see AccessCheckOptions.BackupIntent for the backup privileges.
+// AppContainer and restricted tokens get only the rights that a second pass over the DACL
+// with their package and capability SIDs, or their restricting SIDs, grants as well.
+// Conditional ACEs apply if their expression is TRUE, deny ACEs also if it is UNKNOWN,
+// with the RA ACEs of the SACL as resource attributes, see Token.EvaluateCondition.
+// The central access rules of the policy an SP ACE refers to further limit the rights
+// the DACL grants, see AccessCheckOptions.CentralAccessPolicies.
+//
+// With MAXIMUM_ALLOWED in desired, access is granted if the token has any right and
+// all other desired rights, and GrantedAccess holds every right the token has.
+//
+// Object ACEs apply only if they have no object type, see AccessCheckByType.
+func (sd *SecurityDescriptor) AccessCheck(token *Token, desired AccessMask, opts *AccessCheckOptions) (*AccessCheckResult, error) {
+	e, err := newAccessEvaluator(sd, token, opts)
+	if err != nil {
+		return nil, err
+	}
+	return e.check(desired, false), nil
+}
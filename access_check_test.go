@@ -0,0 +1,172 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSecurityDescriptor_AccessCheck(t *testing.T) {
+	const user = "S-1-5-21-1-2-3-1001"
+	users := &Token{User: user, Groups: []TokenGroup{
+		{Sid: "WD", Attributes: SE_GROUP_ENABLED},
+		{Sid: "BU", Attributes: SE_GROUP_ENABLED},
+	}}
+	admin := &Token{User: user, Groups: []TokenGroup{
+		{Sid: "WD", Attributes: SE_GROUP_ENABLED},
+		{Sid: "BA", Attributes: SE_GROUP_USE_FOR_DENY_ONLY},
+	}}
+
+	tests := []struct {
+		name    string
+		sddl    string
+		token   *Token
+		desired AccessMask
+		opts    *AccessCheckOptions
+		status  AccessStatus
+		missing AccessMask
+	}{
+		{"null dacl grants everything", "O:BAG:SYD:NO_ACCESS_CONTROL", users, FILE_ALL_ACCESS, nil, AccessGranted, 0},
+		{"empty dacl grants nothing", "O:BAG:SYD:", users, READ_CONTROL, nil, AccessDenied, READ_CONTROL},
+		{"allow", "O:BAG:SYD:(A;;FR;;;BU)", users, FILE_READ_DATA, nil, AccessGranted, 0},
+		{"generic desired access is mapped", "O:BAG:SYD:(A;;FR;;;BU)", users, GENERIC_READ, nil, AccessGranted, 0},
+		{"generic ace is not mapped", "O:BAG:SYD:(A;;GR;;;BU)", users, FILE_READ_DATA, nil, AccessDenied, FILE_READ_DATA},
+		{"generic ace mapped on request", "O:BAG:SYD:(A;;GR;;;BU)", users, FILE_READ_DATA, &AccessCheckOptions{MapAceGenericRights: true}, AccessGranted, 0},
+		{"rights add up across aces", "O:BAG:SYD:(A;;0x100001;;;BU)(A;;0x100002;;;WD)", users, FILE_READ_DATA | FILE_WRITE_DATA, nil, AccessGranted, 0},
+		{"partial grant is denied", "O:BAG:SYD:(A;;FR;;;BU)", users, FILE_READ_DATA | FILE_WRITE_DATA, nil, AccessDenied, 0x2},
+		{"deny before allow", "O:BAG:SYD:(D;;0x2;;;WD)(A;;FA;;;BU)", users, FILE_WRITE_DATA, nil, AccessDenied, 0x2},
+		{"allow before deny wins", "O:BAG:SYD:(A;;FA;;;BU)(D;;0x2;;;WD)", users, FILE_WRITE_DATA, nil, AccessGranted, 0},
+		{"deny of other rights", "O:BAG:SYD:(D;;0x2;;;WD)(A;;FA;;;BU)", users, FILE_READ_DATA, nil, AccessGranted, 0},
+		{"disabled group", "O:BAG:SYD:(A;;FA;;;BA)", &Token{User: user, Groups: []TokenGroup{{Sid: "BA"}}}, FILE_READ_DATA, nil, AccessDenied, FILE_READ_DATA},
+		{"deny-only group does not allow", "O:SYG:SYD:(A;;FA;;;BA)", admin, FILE_READ_DATA, nil, AccessDenied, FILE_READ_DATA},
+		{"deny-only group denies", "O:SYG:SYD:(D;;0x1;;;BA)(A;;FA;;;WD)", admin, FILE_READ_DATA, nil, AccessDenied, 0x1},
+		{"inherit-only ace is skipped", "O:SYG:SYD:(A;OICIIO;FA;;;BU)", users, FILE_READ_DATA, nil, AccessDenied, FILE_READ_DATA},
+		{"object ace for the whole object", "O:SYG:SYD:(OA;;RP;;;BU)", users, 0x10, &AccessCheckOptions{Mapping: &DirectoryServiceGenericMapping}, AccessGranted, 0},
+		{"object ace for a property", "O:SYG:SYD:(OA;;RP;bf967a86-0de6-11d0-a285-00aa003049e2;;BU)", users, 0x10, nil, AccessDenied, 0x10},
+		{"owner gets read control and write dac", "O:" + user + "G:SYD:", users, READ_CONTROL | WRITE_DAC, nil, AccessGranted, 0},
+		{"owner rights cannot be denied", "O:" + user + "G:SYD:(D;;WD;;;WD)", users, WRITE_DAC, nil, AccessGranted, 0},
+		{"owner does not get other rights", "O:" + user + "G:SYD:", users, WRITE_OWNER, nil, AccessDenied, WRITE_OWNER},
+		{"owner rights ace replaces implicit rights", "O:" + user + "G:SYD:(A;;RC;;;OW)", users, WRITE_DAC, nil, AccessDenied, WRITE_DAC},
+		{"owner rights ace grants owner", "O:" + user + "G:SYD:(A;;0x100001;;;OW)", users, READ_CONTROL | FILE_READ_DATA, nil, AccessDenied, READ_CONTROL},
+		{"owner rights ace ignores others", "O:SYG:SYD:(A;;FA;;;OW)", users, FILE_READ_DATA, nil, AccessDenied, FILE_READ_DATA},
+		{"inherit-only owner rights ace", "O:" + user + "G:SYD:(A;OICIIO;RC;;;OW)", users, WRITE_DAC, nil, AccessGranted, 0},
+		{"access system security needs privilege", "O:BAG:SYD:(A;;0x11f01ff;;;BU)", users, ACCESS_SYSTEM_SECURITY | FILE_READ_DATA, nil, AccessPrivilegeNotHeld, ACCESS_SYSTEM_SECURITY},
+		{"no desired access", "O:BAG:SYD:(A;;FA;;;BU)", users, 0, nil, AccessDenied, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := ParseSDDL(tt.sddl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := sd.AccessCheck(tt.token, tt.desired, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.status, result.Status)
+			assert.Equal(t, tt.missing, result.Missing)
+			if tt.status == AccessGranted {
+				mapping := FileGenericMapping
+				assert.Equal(t, mapping.Map(tt.desired), result.GrantedAccess)
+			} else {
+				assert.Equal(t, AccessMask(0), result.GrantedAccess)
+			}
+		})
+	}
+}
+
+func TestSecurityDescriptor_AccessCheck_Errors(t *testing.T) {
+	sd, err := ParseSDDL("D:(A;;FA;;;WD)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = sd.AccessCheck(&Token{User: "SY"}, FILE_READ_DATA, nil)
+	assert.Error(t, err)
+
+	sd.Owner, sd.Group = "S-1-5-18", "S-1-5-18"
+	_, err = sd.AccessCheck(&Token{}, FILE_READ_DATA, nil)
+	assert.Error(t, err)
+}
+
+func TestGenericMapping_Map(t *testing.T) {
+	assert.Equal(t, AccessMask(0x00120089|DELETE), FileGenericMapping.Map(GENERIC_READ|DELETE))
+	assert.Equal(t, AccessMask(0x000f003f), RegistryGenericMapping.Map(GENERIC_ALL))
+}
+
+func TestSecurityDescriptor_AccessCheck_MaximumAllowed(t *testing.T) {
+	const user = "S-1-5-21-1-2-3-1001"
+	token := &Token{User: user, Groups: []TokenGroup{
+		{Sid: "WD", Attributes: SE_GROUP_ENABLED},
+		{Sid: "BU", Attributes: SE_GROUP_ENABLED},
+	}}
+
+	tests := []struct {
+		name    string
+		sddl    string
+		desired AccessMask
+		status  AccessStatus
+		granted AccessMask
+	}{
+		{"null dacl", "O:BAG:SYD:NO_ACCESS_CONTROL", MAXIMUM_ALLOWED, AccessGranted, FILE_ALL_ACCESS},
+		{"empty dacl", "O:BAG:SYD:", MAXIMUM_ALLOWED, AccessDenied, 0},
+		{"empty dacl owner", "O:" + user + "G:SYD:", MAXIMUM_ALLOWED, AccessGranted, READ_CONTROL | WRITE_DAC},
+		{"deny removes bits", "O:BAG:SYD:(D;;0x40002;;;WD)(A;;FA;;;BU)", MAXIMUM_ALLOWED, AccessGranted, FILE_ALL_ACCESS &^ (0x2 | WRITE_DAC)},
+		{"late deny has no effect", "O:BAG:SYD:(A;;FR;;;BU)(D;;FA;;;WD)", MAXIMUM_ALLOWED, AccessGranted, FILE_READ_ACCESS},
+		{"with other desired rights", "O:BAG:SYD:(A;;FR;;;BU)", MAXIMUM_ALLOWED | FILE_READ_DATA, AccessGranted, FILE_READ_ACCESS},
+		{"missing other desired rights", "O:BAG:SYD:(A;;FR;;;BU)", MAXIMUM_ALLOWED | FILE_WRITE_DATA, AccessDenied, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := ParseSDDL(tt.sddl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := sd.AccessCheck(token, tt.desired, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.status, result.Status)
+			assert.Equal(t, tt.granted, result.GrantedAccess)
+		})
+	}
+}
+
+func TestSecurityDescriptor_AccessCheck_Trace(t *testing.T) {
+	const user = "S-1-5-21-1-2-3-1001"
+	token := &Token{User: user, Groups: []TokenGroup{
+		{Sid: "WD", Attributes: SE_GROUP_ENABLED},
+		{Sid: "BU", Attributes: SE_GROUP_ENABLED},
+	}}
+	sd, err := ParseSDDL("O:" + user + "G:SYD:(A;;0x120089;;;BU)(D;;WD;;;BU)(A;;FA;;;BA)(D;;0x100002;;;WD)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := sd.AccessCheck(token, MAXIMUM_ALLOWED, &AccessCheckOptions{Trace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, AccessMask(FILE_READ_ACCESS|WRITE_DAC), result.GrantedAccess)
+	assert.Equal(t, []AccessTraceStep{
+		{
+			AceIndex: -1,
+			Granted:  READ_CONTROL | WRITE_DAC,
+			Message:  "the owner is granted READ_CONTROL, WRITE_DAC",
+		},
+		{
+			AceIndex: 0,
+			Ace:      "(A;;FR;;;BU)",
+			Granted:  FILE_READ_ACCESS &^ READ_CONTROL,
+			Message:  "ACE #0 (A;;FR;;;BU) granted FILE_READ_DATA, FILE_READ_EA, FILE_READ_ATTRIBUTES, SYNCHRONIZE because the token holds BUILTIN\\Users",
+		},
+		{
+			AceIndex: 1,
+			Ace:      "(D;;WD;;;BU)",
+			Message:  "ACE #1 (D;;WD;;;BU) applies because the token holds BUILTIN\\Users, but earlier entries decided all of its rights",
+		},
+		{
+			AceIndex: 3,
+			Ace:      "(D;;0x100002;;;WD)",
+			Denied:   0x2,
+			Message:  "ACE #3 (D;;0x100002;;;WD) denied FILE_WRITE_DATA because the token holds Everyone",
+		},
+	}, result.Trace)
+}
@@ -34,7 +34,55 @@ const (
 	GENERIC_READ    = 0x80000000
 )
 
+// registryRightAliases are the tokens Windows writes for whole registry masks.
+// KX has the bits of KR and is read back as such.
+var registryRightAliases = map[uint32]string{
+	0x000f003f: "KA",
+	0x00020019: "KR",
+	0x00020006: "KW",
+}
+
+// objectRightTokens are the tokens of the object specific rights in the order Windows
+// writes them. They are the directory service names, which Windows uses for all objects.
+var objectRightTokens = []accessRightName{
+	{0x0001, "CC"},
+	{0x0002, "DC"},
+	{0x0004, "LC"},
+	{0x0008, "SW"},
+	{0x0010, "RP"},
+	{0x0020, "WP"},
+	{0x0040, "DT"},
+	{0x0080, "LO"},
+	{0x0100, "CR"},
+}
+
+// labelRightTokens are the tokens of the mandatory label policy.
+var labelRightTokens = []accessRightName{
+	{0x0001, "NW"},
+	{0x0002, "NR"},
+	{0x0004, "NX"},
+}
+
+// labelMaskTokens splits the mask of a mandatory label ACE into its policy tokens.
+// It reports false if the mask has other bits.
+func labelMaskTokens(mask uint32) ([]string, bool) {
+	var flags []string
+	for _, right := range labelRightTokens {
+		if mask&right.mask != 0 {
+			flags = append(flags, right.name)
+			mask &^= right.mask
+		}
+	}
+	return flags, mask == 0
+}
+
 func ParseAccessMask(mask uint32) AccessMaskDetail {
+	return parseAccessMask(mask, false)
+}
+
+// parseAccessMask splits a mask into SDDL tokens. allTokens also uses the registry
+// aliases and the directory service tokens of the object specific rights.
+func parseAccessMask(mask uint32, allTokens bool) AccessMaskDetail {
 	var flags []string
 
 	maskCurrent := mask
@@ -45,7 +93,18 @@ func ParseAccessMask(mask uint32) AccessMaskDetail {
 	} else if maskCurrent&FILE_ALL_ACCESS == FILE_READ_ACCESS {
 		flags = append(flags, "FR")
 		maskCurrent &= bitNot(FILE_READ_ACCESS)
+	} else if alias, ok := registryRightAliases[maskCurrent&FILE_ALL_ACCESS]; allTokens && ok {
+		flags = append(flags, alias)
+		maskCurrent &= bitNot(FILE_ALL_ACCESS)
 	} else {
+		if allTokens {
+			for _, right := range objectRightTokens {
+				if maskCurrent&right.mask != 0 {
+					flags = append(flags, right.name)
+					maskCurrent &= bitNot(right.mask)
+				}
+			}
+		}
 		// Standard rights
 		if maskCurrent&DELETE != 0 {
 			flags = append(flags, "SD")
@@ -103,40 +162,49 @@ func ParseAccessMask(mask uint32) AccessMaskDetail {
 	}
 }
 
+// accessRightTokens are the SDDL access right tokens.
+// The object specific tokens of several kinds of objects share bits.
+var accessRightTokens = map[string]uint32{
+	"FA": FILE_ALL_ACCESS,
+	"FR": FILE_READ_ACCESS,
+	"FW": 0x00120116,
+	"FX": 0x001200a0,
+	"KA": 0x000f003f,
+	"KR": 0x00020019,
+	"KW": 0x00020006,
+	"KX": 0x00020019,
+	"CC": 0x00000001,
+	"DC": 0x00000002,
+	"LC": 0x00000004,
+	"SW": 0x00000008,
+	"RP": 0x00000010,
+	"WP": 0x00000020,
+	"DT": 0x00000040,
+	"LO": 0x00000080,
+	"CR": 0x00000100,
+	"NW": 0x00000001,
+	"NR": 0x00000002,
+	"NX": 0x00000004,
+	"SD": DELETE,
+	"RC": READ_CONTROL,
+	"WD": WRITE_DAC,
+	"WO": WRITE_OWNER,
+	"SY": SYNCHRONIZE,
+	"GX": GENERIC_EXECUTE,
+	"GW": GENERIC_WRITE,
+	"GR": GENERIC_READ,
+	"GA": GENERIC_ALL,
+	"AS": ACCESS_SYSTEM_SECURITY,
+	"MA": MAXIMUM_ALLOWED,
+}
+
 func EncodeAccessMask(detail *AccessMaskDetail) uint32 {
 	var mask uint32
 	if detail.HasUnknown {
 		mask = detail.Mask
 	}
 	for _, flag := range detail.Flags {
-		switch flag {
-		case "FA":
-			mask |= FILE_ALL_ACCESS
-		case "FR":
-			mask |= FILE_READ_ACCESS
-		case "SD":
-			mask |= DELETE
-		case "RC":
-			mask |= READ_CONTROL
-		case "WD":
-			mask |= WRITE_DAC
-		case "WO":
-			mask |= WRITE_OWNER
-		case "SY":
-			mask |= SYNCHRONIZE
-		case "GX":
-			mask |= GENERIC_EXECUTE
-		case "GW":
-			mask |= GENERIC_WRITE
-		case "GR":
-			mask |= GENERIC_READ
-		case "GA":
-			mask |= GENERIC_ALL
-		case "AS":
-			mask |= ACCESS_SYSTEM_SECURITY
-		case "MA":
-			mask |= MAXIMUM_ALLOWED
-		}
+		mask |= accessRightTokens[flag]
 	}
 	return mask
 }
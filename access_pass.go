@@ -0,0 +1,47 @@
+package winsddlconverter
+
+// Well-known SIDs matched by AppContainer tokens
+const (
+	allApplicationPackagesSid           = "S-1-15-2-1"
+	allRestrictedApplicationPackagesSid = "S-1-15-2-2"
+)
+
+// accessPass is one walk over the DACL with a set of SIDs. Access is granted only for the
+// rights every pass grants.
+type accessPass struct {
+	// name is empty for the pass with the user and groups
+	name  string
+	sids  tokenSids
+	owner bool
+	// writeOnly grants all rights but write rights without consulting the DACL
+	writeOnly bool
+}
+
+// newAccessPasses returns the passes of token: the user and groups, the AppContainer
+// package and capabilities, and the restricting SIDs.
+func newAccessPasses(token *Token, owner string) []accessPass {
+	newPass := func(name string, sids tokenSids) accessPass {
+		return accessPass{name: name, sids: sids, owner: sids.contains(owner, false)}
+	}
+	passes := []accessPass{newPass("", newTokenSids(token.User, token.Groups))}
+
+	if token.AppContainerSid != "" {
+		sids := newTokenSids(token.AppContainerSid, token.Capabilities)
+		sids[allRestrictedApplicationPackagesSid] |= SE_GROUP_ENABLED
+		if !token.LessPrivilegedAppContainer {
+			sids[allApplicationPackagesSid] |= SE_GROUP_ENABLED
+		}
+		passes = append(passes, newPass("AppContainer", sids))
+	}
+
+	if len(token.RestrictingSids) > 0 {
+		sids := newTokenSids("", token.RestrictingSids)
+		for sid := range sids {
+			sids[sid] |= SE_GROUP_ENABLED
+		}
+		pass := newPass("restricted", sids)
+		pass.writeOnly = token.WriteRestricted
+		passes = append(passes, pass)
+	}
+	return passes
+}
@@ -0,0 +1,81 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSecurityDescriptor_AccessCheck_Sandboxed(t *testing.T) {
+	const (
+		user     = "S-1-5-21-1-2-3-1001"
+		pkg      = "S-1-15-2-1-2-3-4-5-6-7"
+		internet = "S-1-15-3-1"
+	)
+	groups := []TokenGroup{
+		{Sid: "WD", Attributes: SE_GROUP_ENABLED},
+		{Sid: "BU", Attributes: SE_GROUP_ENABLED},
+	}
+	app := &Token{User: user, Groups: groups, AppContainerSid: pkg,
+		Capabilities: []TokenGroup{{Sid: internet, Attributes: SE_GROUP_ENABLED}}}
+	lpac := &Token{User: user, Groups: groups, AppContainerSid: pkg, LessPrivilegedAppContainer: true}
+	restricted := &Token{User: user, Groups: groups, RestrictingSids: []TokenGroup{{Sid: "RC"}}}
+	writeRestricted := &Token{User: user, Groups: groups, RestrictingSids: []TokenGroup{{Sid: "S-1-5-33"}}, WriteRestricted: true}
+
+	tests := []struct {
+		name    string
+		sddl    string
+		token   *Token
+		desired AccessMask
+		granted AccessMask
+	}{
+		{"user folder is not reachable", "O:" + user + "G:SYD:(A;;FA;;;" + user + ")", app, MAXIMUM_ALLOWED, 0},
+		{"package sid", "O:BAG:SYD:(A;;FA;;;BU)(A;;FR;;;" + pkg + ")", app, MAXIMUM_ALLOWED, FILE_READ_ACCESS},
+		{"package needs the user as well", "O:BAG:SYD:(A;;FR;;;BU)(A;;FA;;;" + pkg + ")", app, MAXIMUM_ALLOWED, FILE_READ_ACCESS},
+		{"all application packages", "O:BAG:SYD:(A;;FA;;;BU)(A;;0x1200a9;;;AC)", app, MAXIMUM_ALLOWED, 0x1200a9},
+		{"all restricted application packages", "O:BAG:SYD:(A;;FA;;;BU)(A;;0x1200a9;;;S-1-15-2-2)", app, MAXIMUM_ALLOWED, 0x1200a9},
+		{"capability", "O:BAG:SYD:(A;;FA;;;BU)(A;;FR;;;" + internet + ")", app, MAXIMUM_ALLOWED, FILE_READ_ACCESS},
+		{"capability without container", "O:BAG:SYD:(A;;FR;;;" + internet + ")", &Token{User: user, Groups: groups}, FILE_READ_DATA, 0},
+		{"deny to package", "O:BAG:SYD:(D;;0x100002;;;" + pkg + ")(A;;FA;;;BU)(A;;FA;;;AC)", app, MAXIMUM_ALLOWED, FILE_ALL_ACCESS &^ 0x100002},
+		{"less privileged container ignores AC", "O:BAG:SYD:(A;;FA;;;BU)(A;;FA;;;AC)", lpac, FILE_READ_DATA, 0},
+		{"less privileged container with package sid", "O:BAG:SYD:(A;;FA;;;BU)(A;;FA;;;" + pkg + ")", lpac, FILE_READ_DATA, FILE_READ_DATA},
+		{"restricted token", "O:BAG:SYD:(A;;FA;;;BU)(A;;FR;;;RC)", restricted, MAXIMUM_ALLOWED, FILE_READ_ACCESS},
+		{"restricting sid alone", "O:BAG:SYD:(A;;FA;;;RC)", restricted, FILE_READ_DATA, 0},
+		{"write restricted token reads", "O:BAG:SYD:(A;;FA;;;BU)", writeRestricted, FILE_READ_DATA, FILE_READ_DATA},
+		{"write restricted token writes", "O:BAG:SYD:(A;;FA;;;BU)", writeRestricted, FILE_WRITE_DATA, 0},
+		{"write restricted token with grant", "O:BAG:SYD:(A;;FA;;;BU)(A;;0x120116;;;S-1-5-33)", writeRestricted, FILE_WRITE_DATA, FILE_WRITE_DATA},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := ParseSDDL(tt.sddl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := sd.AccessCheck(tt.token, tt.desired, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.granted, result.GrantedAccess)
+			assert.Equal(t, tt.granted != 0, result.Status == AccessGranted)
+		})
+	}
+}
+
+func TestSecurityDescriptor_AccessCheck_SandboxedTrace(t *testing.T) {
+	sd, err := ParseSDDL("O:BAG:SYD:(A;;FA;;;BU)(A;;FR;;;AC)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &Token{User: "S-1-5-21-1-2-3-1001", Groups: []TokenGroup{{Sid: "BU", Attributes: SE_GROUP_ENABLED}},
+		AppContainerSid: "S-1-15-2-1-2-3-4-5-6-7"}
+	result, err := sd.AccessCheck(token, FILE_READ_DATA, &AccessCheckOptions{Trace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, AccessGranted, result.Status)
+	if assert.Len(t, result.Trace, 2) {
+		assert.Equal(t, "", result.Trace[0].Pass)
+		assert.Equal(t, "AppContainer", result.Trace[1].Pass)
+		assert.Equal(t, "AppContainer pass: ACE #1 (A;;FR;;;AC) granted FILE_READ_DATA, FILE_READ_EA, FILE_READ_ATTRIBUTES, "+
+			"READ_CONTROL, SYNCHRONIZE because the token holds APPLICATION PACKAGE AUTHORITY\\ALL APPLICATION PACKAGES", result.Trace[1].Message)
+	}
+}
@@ -0,0 +1,183 @@
+package winsddlconverter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AccessMask is the ACCESS_MASK of an ACE.
+type AccessMask uint32
+
+// RightsProfile selects the meaning of the object specific rights, the low 16 bits of an AccessMask.
+type RightsProfile uint8
+
+const (
+	FileRights RightsProfile = iota
+	RegistryRights
+	DirectoryServiceRights
+	MandatoryLabelRights
+	// ShareRights are the rights of SMB share permissions, which use the file rights
+	ShareRights
+)
+
+type accessRightName struct {
+	mask uint32
+	name string
+}
+
+var fileRightNames = []accessRightName{
+	{0x0001, "FILE_READ_DATA"},
+	{0x0002, "FILE_WRITE_DATA"},
+	{0x0004, "FILE_APPEND_DATA"},
+	{0x0008, "FILE_READ_EA"},
+	{0x0010, "FILE_WRITE_EA"},
+	{0x0020, "FILE_EXECUTE"},
+	{0x0040, "FILE_DELETE_CHILD"},
+	{0x0080, "FILE_READ_ATTRIBUTES"},
+	{0x0100, "FILE_WRITE_ATTRIBUTES"},
+}
+
+var specificRightNames = map[RightsProfile][]accessRightName{
+	FileRights:  fileRightNames,
+	ShareRights: fileRightNames,
+	RegistryRights: {
+		{0x0001, "KEY_QUERY_VALUE"},
+		{0x0002, "KEY_SET_VALUE"},
+		{0x0004, "KEY_CREATE_SUB_KEY"},
+		{0x0008, "KEY_ENUMERATE_SUB_KEYS"},
+		{0x0010, "KEY_NOTIFY"},
+		{0x0020, "KEY_CREATE_LINK"},
+		{0x0100, "KEY_WOW64_64KEY"},
+		{0x0200, "KEY_WOW64_32KEY"},
+	},
+	DirectoryServiceRights: {
+		{0x0001, "ADS_RIGHT_DS_CREATE_CHILD"},
+		{0x0002, "ADS_RIGHT_DS_DELETE_CHILD"},
+		{0x0004, "ADS_RIGHT_ACTRL_DS_LIST"},
+		{0x0008, "ADS_RIGHT_DS_SELF"},
+		{0x0010, "ADS_RIGHT_DS_READ_PROP"},
+		{0x0020, "ADS_RIGHT_DS_WRITE_PROP"},
+		{0x0040, "ADS_RIGHT_DS_DELETE_TREE"},
+		{0x0080, "ADS_RIGHT_DS_LIST_OBJECT"},
+		{0x0100, "ADS_RIGHT_DS_CONTROL_ACCESS"},
+	},
+	MandatoryLabelRights: {
+		{0x0001, "SYSTEM_MANDATORY_LABEL_NO_WRITE_UP"},
+		{0x0002, "SYSTEM_MANDATORY_LABEL_NO_READ_UP"},
+		{0x0004, "SYSTEM_MANDATORY_LABEL_NO_EXECUTE_UP"},
+	},
+}
+
+var commonRightNames = []accessRightName{
+	{DELETE, "DELETE"},
+	{READ_CONTROL, "READ_CONTROL"},
+	{WRITE_DAC, "WRITE_DAC"},
+	{WRITE_OWNER, "WRITE_OWNER"},
+	{SYNCHRONIZE, "SYNCHRONIZE"},
+	{ACCESS_SYSTEM_SECURITY, "ACCESS_SYSTEM_SECURITY"},
+	{MAXIMUM_ALLOWED, "MAXIMUM_ALLOWED"},
+	{GENERIC_ALL, "GENERIC_ALL"},
+	{GENERIC_EXECUTE, "GENERIC_EXECUTE"},
+	{GENERIC_WRITE, "GENERIC_WRITE"},
+	{GENERIC_READ, "GENERIC_READ"},
+}
+
+// Has reports whether all rights of mask are set.
+func (m AccessMask) Has(mask AccessMask) bool {
+	return m&mask == mask
+}
+
+func (m AccessMask) Add(mask AccessMask) AccessMask {
+	return m | mask
+}
+
+func (m AccessMask) Remove(mask AccessMask) AccessMask {
+	return m &^ mask
+}
+
+// Detail returns the SDDL tokens of the mask, see ParseAccessMask.
+func (m AccessMask) Detail() AccessMaskDetail {
+	return ParseAccessMask(uint32(m))
+}
+
+// Tokens returns the SDDL tokens for the bits that have one, see Unknown for the rest.
+func (m AccessMask) Tokens() []string {
+	return m.Detail().Flags
+}
+
+// Unknown returns the bits that Tokens cannot express.
+func (m AccessMask) Unknown() AccessMask {
+	return m &^ AccessMask(EncodeAccessMask(&AccessMaskDetail{Flags: m.Tokens()}))
+}
+
+// Names returns the Windows constant name of each set bit, reading the object specific
+// bits according to profile. Bits without a name are returned in hex.
+func (m AccessMask) Names(profile RightsProfile) []string {
+	var names []string
+	remaining := uint32(m)
+	for _, list := range [][]accessRightName{specificRightNames[profile], commonRightNames} {
+		for _, right := range list {
+			if remaining&right.mask != 0 {
+				names = append(names, right.name)
+				remaining &^= right.mask
+			}
+		}
+	}
+	if remaining != 0 {
+		names = append(names, fmt.Sprintf("0x%x", remaining))
+	}
+	return names
+}
+
+// String returns the mask as written in SDDL.
+func (m AccessMask) String() string {
+	if m.Unknown() != 0 {
+		return fmt.Sprintf("0x%x", uint32(m))
+	}
+	return strings.Join(m.Tokens(), "")
+}
+
+// ParseAccessRights parses the rights field of an SDDL ACE, either hex or a list of tokens.
+func ParseAccessRights(rights string) (AccessMask, error) {
+	if len(rights) >= 2 && rights[0] == '0' && (rights[1] == 'x' || rights[1] == 'X') {
+		mask, err := strconv.ParseUint(rights[2:], 16, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid hexadecimal access mask: %v", err)
+		}
+		return AccessMask(mask), nil
+	}
+
+	if len(rights)%2 != 0 {
+		return 0, fmt.Errorf("invalid access rights: %q", rights)
+	}
+	var mask AccessMask
+	for i := 0; i < len(rights); i += 2 {
+		right, ok := accessRightTokens[rights[i:i+2]]
+		if !ok {
+			return 0, fmt.Errorf("unknown access right: %q", rights[i:i+2])
+		}
+		mask |= AccessMask(right)
+	}
+	return mask, nil
+}
+
+// MarshalJSON writes the mask as an AccessMaskDetail.
+func (m AccessMask) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Detail())
+}
+
+// UnmarshalJSON reads an AccessMaskDetail. The mask is used when set, otherwise the flags.
+func (m *AccessMask) UnmarshalJSON(data []byte) error {
+	var detail AccessMaskDetail
+	if err := json.Unmarshal(data, &detail); err != nil {
+		return err
+	}
+	if detail.Mask == 0 {
+		*m = AccessMask(EncodeAccessMask(&detail))
+	} else {
+		*m = AccessMask(detail.Mask)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAccessMask(t *testing.T) {
+	mask, err := ParseAccessRights("RPWPCR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, AccessMask(0x130), mask)
+	assert.Equal(t, []string{"ADS_RIGHT_DS_READ_PROP", "ADS_RIGHT_DS_WRITE_PROP", "ADS_RIGHT_DS_CONTROL_ACCESS"}, mask.Names(DirectoryServiceRights))
+	assert.Equal(t, AccessMask(0x130), mask.Unknown())
+	assert.Equal(t, "0x130", mask.String())
+
+	mask = AccessMask(FILE_ALL_ACCESS).Remove(DELETE | WRITE_DAC)
+	assert.True(t, mask.Has(READ_CONTROL|SYNCHRONIZE))
+	assert.False(t, mask.Has(DELETE))
+	assert.Equal(t, []string{"RC", "WO", "SY"}, mask.Tokens())
+	assert.Equal(t, "0x1a01ff", mask.String())
+	assert.Equal(t, []string{"KEY_QUERY_VALUE", "KEY_SET_VALUE", "KEY_CREATE_SUB_KEY", "KEY_ENUMERATE_SUB_KEYS",
+		"KEY_NOTIFY", "KEY_CREATE_LINK", "KEY_WOW64_64KEY", "READ_CONTROL", "WRITE_OWNER", "SYNCHRONIZE", "0xc0"},
+		mask.Names(RegistryRights))
+	assert.Equal(t, "GA", AccessMask(0).Add(GENERIC_ALL).String())
+
+	_, err = ParseAccessRights("FAX")
+	assert.Error(t, err)
+	_, err = ParseAccessRights("ZZ")
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package winsddlconverter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AccessTraceStep is one decision of an access check, see AccessCheckOptions.Trace.
+type AccessTraceStep struct {
+	// AceIndex is the index of the deciding ACE in the DACL, or -1 for rules without an ACE
+	AceIndex int `json:"aceIndex"`
+	// Pass is "AppContainer" or "restricted" for the extra passes of such tokens
+	Pass string `json:"pass,omitempty"`
+	// Rule is the central access rule whose permissions were evaluated, see CentralAccessRule
+	Rule string `json:"rule,omitempty"`
+	// Ace is the deciding ACE in SDDL
+	Ace     string     `json:"ace,omitempty"`
+	Granted AccessMask `json:"granted"`
+	Denied  AccessMask `json:"denied"`
+	Message string     `json:"message"`
+}
+
+func (s AccessTraceStep) String() string {
+	return s.Message
+}
+
+// rightNames returns the names of the rights for messages.
+func (e *accessEvaluator) rightNames(mask AccessMask) string {
+	if mask == 0 {
+		return "nothing"
+	}
+	return strings.Join(mask.Names(e.opts.Profile), ", ")
+}
+
+// record adds a step, naming the current central access rule and pass.
+func (e *accessEvaluator) record(step AccessTraceStep) {
+	var scope []string
+	if e.rule != "" {
+		step.Rule = e.rule
+		scope = append(scope, fmt.Sprintf("central access rule %q", e.rule))
+	}
+	if e.pass != nil && e.pass.name != "" {
+		step.Pass = e.pass.name
+		scope = append(scope, e.pass.name+" pass")
+	}
+	if len(scope) > 0 {
+		step.Message = strings.Join(scope, ", ") + ": " + step.Message
+	}
+	e.trace = append(e.trace, step)
+}
+
+// traceStep records a decision that is not caused by an ACE.
+func (e *accessEvaluator) traceStep(granted AccessMask, denied AccessMask, format string, args ...interface{}) {
+	if !e.opts.Trace {
+		return
+	}
+	e.record(AccessTraceStep{
+		AceIndex: -1,
+		Granted:  granted,
+		Denied:   denied,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// traceAce records what a matching ACE decided. condition is the result of the condition
+// of a callback ACE, or empty.
+func (e *accessEvaluator) traceAce(index int, ace *Ace, granted AccessMask, denied AccessMask, condition string) {
+	if !e.opts.Trace {
+		return
+	}
+	text := DefaultFormatOptions().FormatAce(ace)
+	reason := "the token holds " + SidDisplayName(ace.Sid)
+	if GetRawSid(ace.Sid) == "S-1-3-4" {
+		reason = "the token owns the object"
+	}
+	if condition != "" {
+		reason += " and its condition is " + condition
+	}
+	var message string
+	switch {
+	case granted != 0:
+		message = fmt.Sprintf("ACE #%d %s granted %s because %s", index, text, e.rightNames(granted), reason)
+	case denied != 0:
+		message = fmt.Sprintf("ACE #%d %s denied %s because %s", index, text, e.rightNames(denied), reason)
+	default:
+		message = fmt.Sprintf("ACE #%d %s applies because %s, but earlier entries decided all of its rights", index, text, reason)
+	}
+	e.record(AccessTraceStep{
+		AceIndex: index,
+		Ace:      text,
+		Granted:  granted,
+		Denied:   denied,
+		Message:  message,
+	})
+}
+
+// traceCondition records a callback ACE whose condition kept it from applying.
+func (e *accessEvaluator) traceCondition(index int, ace *Ace, result ConditionResult) {
+	if !e.opts.Trace {
+		return
+	}
+	text := DefaultFormatOptions().FormatAce(ace)
+	message := fmt.Sprintf("ACE #%d %s does not apply because its condition is %s", index, text, result)
+	if !ace.IsConditional() {
+		message = fmt.Sprintf("ACE #%d %s does not apply because it has no conditional expression", index, text)
+	}
+	e.record(AccessTraceStep{
+		AceIndex: index,
+		Ace:      text,
+		Message:  message,
+	})
+}
@@ -0,0 +1,110 @@
+package winsddlconverter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// AceFlags is the AceFlags byte of an ACE header.
+type AceFlags uint8
+
+var aceFlagTokens = []struct {
+	flag  AceFlags
+	token string
+	name  string
+}{
+	{OBJECT_INHERIT_ACE, "OI", "OBJECT_INHERIT_ACE"},
+	{CONTAINER_INHERIT_ACE, "CI", "CONTAINER_INHERIT_ACE"},
+	{NO_PROPAGATE_INHERIT_ACE, "NP", "NO_PROPAGATE_INHERIT_ACE"},
+	{INHERIT_ONLY_ACE, "IO", "INHERIT_ONLY_ACE"},
+	{INHERITED_ACE, "ID", "INHERITED_ACE"},
+	{CRITICAL_ACE_FLAG, "CR", "CRITICAL_ACE_FLAG"},
+	{SUCCESSFUL_ACCESS_ACE_FLAG, "SA", "SUCCESSFUL_ACCESS_ACE_FLAG"},
+	{FAILED_ACCESS_ACE_FLAG, "FA", "FAILED_ACCESS_ACE_FLAG"},
+}
+
+// Has reports whether all of flags are set.
+func (f AceFlags) Has(flags AceFlags) bool {
+	return f&flags == flags
+}
+
+func (f AceFlags) Add(flags AceFlags) AceFlags {
+	return f | flags
+}
+
+func (f AceFlags) Remove(flags AceFlags) AceFlags {
+	return f &^ flags
+}
+
+// Tokens returns the SDDL tokens in the order Windows writes them.
+func (f AceFlags) Tokens() []string {
+	var tokens []string
+	for _, t := range aceFlagTokens {
+		if f&t.flag != 0 {
+			tokens = append(tokens, t.token)
+		}
+	}
+	return tokens
+}
+
+// Names returns the Windows constant names.
+func (f AceFlags) Names() []string {
+	var names []string
+	for _, t := range aceFlagTokens {
+		if f&t.flag != 0 {
+			names = append(names, t.name)
+		}
+	}
+	return names
+}
+
+func (f AceFlags) String() string {
+	return strings.Join(f.Tokens(), "")
+}
+
+func parseAceFlagToken(token string) (AceFlags, error) {
+	for _, t := range aceFlagTokens {
+		if t.token == token {
+			return t.flag, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown ACE flag: %q", token)
+}
+
+// ParseAceFlags parses the flags field of an SDDL ACE, e.g. "OICIID".
+func ParseAceFlags(tokens string) (AceFlags, error) {
+	if len(tokens)%2 != 0 {
+		return 0, fmt.Errorf("invalid ACE flags: %q", tokens)
+	}
+	var flags AceFlags
+	for i := 0; i < len(tokens); i += 2 {
+		flag, err := parseAceFlagToken(tokens[i : i+2])
+		if err != nil {
+			return 0, err
+		}
+		flags |= flag
+	}
+	return flags, nil
+}
+
+// MarshalJSON writes the flags as a list of SDDL tokens.
+func (f AceFlags) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Tokens())
+}
+
+func (f *AceFlags) UnmarshalJSON(data []byte) error {
+	var tokens []string
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return err
+	}
+	*f = 0
+	for _, token := range tokens {
+		flag, err := parseAceFlagToken(token)
+		if err != nil {
+			return err
+		}
+		*f |= flag
+	}
+	return nil
+}
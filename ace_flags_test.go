@@ -0,0 +1,37 @@
+package winsddlconverter
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAceFlags(t *testing.T) {
+	flags, err := ParseAceFlags("CIOIID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, flags.Has(OBJECT_INHERIT_ACE|CONTAINER_INHERIT_ACE))
+	assert.Equal(t, []string{"OI", "CI", "ID"}, flags.Tokens())
+	assert.Equal(t, []string{"OBJECT_INHERIT_ACE", "CONTAINER_INHERIT_ACE"}, flags.Remove(INHERITED_ACE).Names())
+	assert.Equal(t, "OICIIOID", flags.Add(INHERIT_ONLY_ACE).String())
+
+	_, err = ParseAceFlags("OC")
+	assert.Error(t, err)
+	_, err = ParseAceFlags("OIC")
+	assert.Error(t, err)
+}
+
+func TestAceFlags_JSON(t *testing.T) {
+	raw, err := json.Marshal(Ace{AceFlags: OBJECT_INHERIT_ACE | INHERITED_ACE, AccessMask: GENERIC_READ | GENERIC_EXECUTE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `{"aceType":0,"aceFlags":["OI","ID"],"accessMask":{"mask":2684354560,"flags":["GX","GR"],"hasUnknown":false},"sid":""}`, string(raw))
+
+	var ace Ace
+	assert.NoError(t, json.Unmarshal([]byte(`{"aceFlags":["CI"],"accessMask":{"mask":0,"flags":["FA"],"hasUnknown":false}}`), &ace))
+	assert.Equal(t, AceFlags(CONTAINER_INHERIT_ACE), ace.AceFlags)
+	assert.Equal(t, AccessMask(FILE_ALL_ACCESS), ace.AccessMask)
+	assert.Error(t, json.Unmarshal([]byte(`{"aceFlags":["OC"]}`), &ace))
+}
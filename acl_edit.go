@@ -0,0 +1,269 @@
+package winsddlconverter
+
+import "fmt"
+
+// AcePredicate selects ACEs for Find, Filter, Remove and Replace.
+type AcePredicate func(ace *Ace) bool
+
+// BySid matches ACEs of a SID, comparing aliases and SID strings alike.
+func BySid(sid string) AcePredicate {
+	raw := GetRawSid(sid)
+	return func(ace *Ace) bool {
+		return GetRawSid(ace.Sid) == raw
+	}
+}
+
+// ByType matches ACEs of any of the types.
+func ByType(types ...AceType) AcePredicate {
+	return func(ace *Ace) bool {
+		for _, t := range types {
+			if ace.AceType == t {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Inherited matches ACEs with INHERITED_ACE.
+func Inherited() AcePredicate {
+	return isInheritedAce
+}
+
+// Explicit matches ACEs without INHERITED_ACE.
+func Explicit() AcePredicate {
+	return Not(isInheritedAce)
+}
+
+// And matches ACEs matched by all of the predicates.
+func And(predicates ...AcePredicate) AcePredicate {
+	return func(ace *Ace) bool {
+		for _, match := range predicates {
+			if !match(ace) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Not matches ACEs not matched by the predicate.
+func Not(match AcePredicate) AcePredicate {
+	return func(ace *Ace) bool {
+		return !match(ace)
+	}
+}
+
+// Clone returns a deep copy. The clone of nil is nil.
+func (acl *Acl) Clone() *Acl {
+	if acl == nil {
+		return nil
+	}
+	result := &Acl{AclRevision: acl.AclRevision, Aces: make([]Ace, 0, len(acl.Aces))}
+	for _, ace := range acl.Aces {
+		result.Aces = append(result.Aces, cloneAce(ace))
+	}
+	return result
+}
+
+func cloneAce(ace Ace) Ace {
+	if ace.padding != nil {
+		ace.padding = append([]byte{}, ace.padding...)
+	}
+	if ace.ApplicationData != nil {
+		ace.ApplicationData = append([]byte{}, ace.ApplicationData...)
+	}
+	return ace
+}
+
+// Find returns the index of the first matching ACE, or -1.
+func (acl *Acl) Find(match AcePredicate) int {
+	for i := range acl.Aces {
+		if match(&acl.Aces[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Filter returns a copy holding only the matching ACEs.
+func (acl *Acl) Filter(match AcePredicate) *Acl {
+	result := &Acl{AclRevision: acl.AclRevision, Aces: []Ace{}}
+	for i := range acl.Aces {
+		if match(&acl.Aces[i]) {
+			result.Aces = append(result.Aces, cloneAce(acl.Aces[i]))
+		}
+	}
+	return result
+}
+
+// Remove deletes the matching ACEs and returns how many were removed.
+func (acl *Acl) Remove(match AcePredicate) int {
+	aces := make([]Ace, 0, len(acl.Aces))
+	for i := range acl.Aces {
+		if !match(&acl.Aces[i]) {
+			aces = append(aces, acl.Aces[i])
+		}
+	}
+	removed := len(acl.Aces) - len(aces)
+	acl.Aces = aces
+	return removed
+}
+
+// Replace overwrites the matching ACEs with ace and returns how many were replaced.
+func (acl *Acl) Replace(match AcePredicate, ace Ace) int {
+	replaced := 0
+	for i := range acl.Aces {
+		if match(&acl.Aces[i]) {
+			acl.Aces[i] = cloneAce(ace)
+			replaced++
+		}
+	}
+	acl.raiseRevision()
+	return replaced
+}
+
+// Insert adds ace at its canonical position: after the ACEs of the same or a lower
+// canonical rank and before the rest, so explicit deny ACEs stay before explicit allow
+// ACEs and inherited ACEs stay last.
+func (acl *Acl) Insert(ace Ace) {
+	rank := canonicalRank(&ace)
+	index := len(acl.Aces)
+	for i := range acl.Aces {
+		if canonicalRank(&acl.Aces[i]) > rank {
+			index = i
+			break
+		}
+	}
+	acl.Aces = append(acl.Aces, Ace{})
+	copy(acl.Aces[index+1:], acl.Aces[index:])
+	acl.Aces[index] = cloneAce(ace)
+	acl.raiseRevision()
+}
+
+// ReplaceSid changes the SID of the ACEs of old to sid and returns how many were changed.
+func (acl *Acl) ReplaceSid(old string, sid string) int {
+	match := BySid(old)
+	replaced := 0
+	for i := range acl.Aces {
+		if match(&acl.Aces[i]) {
+			acl.Aces[i].Sid = sid
+			replaced++
+		}
+	}
+	return replaced
+}
+
+// raiseRevision sets ACL_REVISION_DS once the ACL holds object ACEs.
+func (acl *Acl) raiseRevision() {
+	if required := acl.RequiredRevision(); required > acl.AclRevision {
+		acl.AclRevision = required
+	}
+}
+
+// Clone returns a deep copy. Layout and Syntax are shared, they are not modified after parsing.
+func (sd *SecurityDescriptor) Clone() *SecurityDescriptor {
+	result := *sd
+	result.DiscretionaryAcl = sd.DiscretionaryAcl.Clone()
+	result.SystemAcl = sd.SystemAcl.Clone()
+	return &result
+}
+
+// ReplaceSid changes old to sid in the owner, the group and both ACLs.
+// It returns how many ACEs were changed.
+func (sd *SecurityDescriptor) ReplaceSid(old string, sid string) int {
+	raw := GetRawSid(old)
+	if GetRawSid(sd.Owner) == raw {
+		sd.Owner = GetRawSid(sid)
+	}
+	if GetRawSid(sd.Group) == raw {
+		sd.Group = GetRawSid(sid)
+	}
+	replaced := 0
+	for _, acl := range []*Acl{sd.DiscretionaryAcl, sd.SystemAcl} {
+		if acl != nil {
+			replaced += acl.ReplaceSid(old, sid)
+		}
+	}
+	return replaced
+}
+
+// editAcl returns the DACL or SACL, creating an empty one when create is set.
+func (sd *SecurityDescriptor) editAcl(part SecurityDescriptorPart, create bool) (*Acl, error) {
+	var acl **Acl
+	switch part {
+	case PartDacl:
+		acl = &sd.DiscretionaryAcl
+	case PartSacl:
+		acl = &sd.SystemAcl
+	default:
+		return nil, fmt.Errorf("%s is not an ACL", part)
+	}
+	if *acl == nil && create {
+		*acl = &Acl{AclRevision: ACL_REVISION, Aces: []Ace{}}
+	}
+	return *acl, nil
+}
+
+// DescriptorEdit is one change of a batch applied by SecurityDescriptor.Apply.
+type DescriptorEdit func(sd *SecurityDescriptor) error
+
+// InsertAce inserts ace into the DACL or SACL, see Acl.Insert. A NULL ACL becomes an ACL holding only ace.
+func InsertAce(part SecurityDescriptorPart, ace Ace) DescriptorEdit {
+	return func(sd *SecurityDescriptor) error {
+		acl, err := sd.editAcl(part, true)
+		if err != nil {
+			return err
+		}
+		acl.Insert(ace)
+		return nil
+	}
+}
+
+// RemoveAces removes the matching ACEs of the DACL or SACL.
+func RemoveAces(part SecurityDescriptorPart, match AcePredicate) DescriptorEdit {
+	return func(sd *SecurityDescriptor) error {
+		acl, err := sd.editAcl(part, false)
+		if err != nil || acl == nil {
+			return err
+		}
+		acl.Remove(match)
+		return nil
+	}
+}
+
+// ReplaceAces overwrites the matching ACEs of the DACL or SACL with ace.
+func ReplaceAces(part SecurityDescriptorPart, match AcePredicate, ace Ace) DescriptorEdit {
+	return func(sd *SecurityDescriptor) error {
+		acl, err := sd.editAcl(part, false)
+		if err != nil || acl == nil {
+			return err
+		}
+		acl.Replace(match, ace)
+		return nil
+	}
+}
+
+// ReplaceSid changes old to sid everywhere, see SecurityDescriptor.ReplaceSid.
+func ReplaceSid(old string, sid string) DescriptorEdit {
+	return func(sd *SecurityDescriptor) error {
+		sd.ReplaceSid(old, sid)
+		return nil
+	}
+}
+
+// Apply runs the edits on a copy and keeps the result only if every edit succeeds
+// and Validate reports no errors. On error sd is unchanged.
+func (sd *SecurityDescriptor) Apply(edits ...DescriptorEdit) error {
+	result := sd.Clone()
+	for i, edit := range edits {
+		if err := edit(result); err != nil {
+			return fmt.Errorf("edit %d: %v", i, err)
+		}
+	}
+	if err := validationError(result.Validate()); err != nil {
+		return err
+	}
+	*sd = *result
+	return nil
+}
@@ -0,0 +1,93 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAcl_Insert(t *testing.T) {
+	tests := []struct {
+		name string
+		ace  Ace
+		want string
+	}{
+		{
+			"deny after explicit deny",
+			Ace{AceType: ACCESS_DENIED_ACE_TYPE, AccessMask: FILE_ALL_ACCESS, Sid: "AN"},
+			"D:(D;;FA;;;BG)(D;;FA;;;AN)(A;;FA;;;BA)(A;ID;FA;;;SY)",
+		},
+		{
+			"allow after explicit allow",
+			Ace{AceType: ACCESS_ALLOWED_ACE_TYPE, AccessMask: FILE_ALL_ACCESS, Sid: "BU"},
+			"D:(D;;FA;;;BG)(A;;FA;;;BA)(A;;FA;;;BU)(A;ID;FA;;;SY)",
+		},
+		{
+			"inherited last",
+			Ace{AceType: ACCESS_DENIED_ACE_TYPE, AceFlags: INHERITED_ACE, AccessMask: FILE_ALL_ACCESS, Sid: "AN"},
+			"D:(D;;FA;;;BG)(A;;FA;;;BA)(A;ID;FA;;;SY)(D;ID;FA;;;AN)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := ParseSDDL("D:(D;;FA;;;BG)(A;;FA;;;BA)(A;ID;FA;;;SY)")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sd.DiscretionaryAcl.Insert(tt.ace)
+			assert.Equal(t, tt.want, sd.ToSddl())
+		})
+	}
+}
+
+func TestAcl_Edit(t *testing.T) {
+	sd, err := ParseSDDL("D:(A;;FA;;;BA)(A;;FR;;;WD)(A;ID;FR;;;S-1-1-0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acl := sd.DiscretionaryAcl
+
+	assert.Equal(t, 1, acl.Find(BySid("S-1-1-0")))
+	assert.Equal(t, -1, acl.Find(BySid("BU")))
+	assert.Len(t, acl.Filter(And(BySid("WD"), Explicit())).Aces, 1)
+	assert.Equal(t, 2, acl.ReplaceSid("WD", "BU"))
+	assert.Equal(t, 1, acl.Replace(Inherited(), Ace{AceType: ACCESS_ALLOWED_ACE_TYPE, AceFlags: INHERITED_ACE, AccessMask: FILE_ALL_ACCESS, Sid: "SY"}))
+	assert.Equal(t, 1, acl.Remove(BySid("BA")))
+	assert.Equal(t, "D:(A;;FR;;;BU)(A;ID;FA;;;SY)", sd.ToSddl())
+}
+
+func TestSecurityDescriptor_Clone(t *testing.T) {
+	sd, err := ParseSDDL("O:BAG:SYD:(A;;FA;;;BA)S:(AU;SA;FA;;;WD)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone := sd.Clone()
+	clone.DiscretionaryAcl.Aces[0].Sid = "BU"
+	clone.SystemAcl.Remove(ByType(SYSTEM_AUDIT_ACE_TYPE))
+	assert.Equal(t, "O:BAG:SYD:(A;;FA;;;BA)S:(AU;SA;FA;;;WD)", sd.ToSddl())
+	assert.Equal(t, "O:BAG:SYD:(A;;FA;;;BU)S:", clone.ToSddl())
+}
+
+func TestSecurityDescriptor_Apply(t *testing.T) {
+	sd, err := ParseSDDL("O:BAG:SYD:(A;;FA;;;BA)(A;;FR;;;WD)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = sd.Apply(
+		ReplaceSid("BA", "S-1-5-18"),
+		RemoveAces(PartDacl, BySid("WD")),
+		InsertAce(PartDacl, Ace{AceType: ACCESS_DENIED_ACE_TYPE, AccessMask: FILE_WRITE_DATA, Sid: "BG"}),
+		InsertAce(PartSacl, Ace{AceType: SYSTEM_AUDIT_ACE_TYPE, AceFlags: FAILED_ACCESS_ACE_FLAG, AccessMask: FILE_ALL_ACCESS, Sid: "WD"}),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "O:SYG:SYD:(D;;0x100002;;;BG)(A;;FA;;;S-1-5-18)S:(AU;FA;FA;;;WD)", sd.ToSddl())
+
+	err = sd.Apply(
+		RemoveAces(PartDacl, BySid("BG")),
+		InsertAce(PartDacl, Ace{AceType: ACCESS_ALLOWED_ACE_TYPE, AccessMask: FILE_ALL_ACCESS, Sid: "not-a-sid"}),
+	)
+	assert.Error(t, err)
+	assert.Equal(t, "O:SYG:SYD:(D;;0x100002;;;BG)(A;;FA;;;S-1-5-18)S:(AU;FA;FA;;;WD)", sd.ToSddl())
+
+	assert.Error(t, sd.Apply(InsertAce(PartOwner, Ace{})))
+}
@@ -0,0 +1,137 @@
+package winsddlconverter
+
+// AuditOptions controls AuditCheck.
+type AuditOptions struct {
+	// Profile names rights and selects the generic mapping when Mapping is nil
+	Profile RightsProfile
+	// Mapping maps generic rights of the desired access
+	Mapping *GenericMapping
+	// MapAceGenericRights also maps generic rights in ACEs, see AccessCheckOptions
+	MapAceGenericRights bool
+	// ObjectTypes is the object type list of the access, see AccessCheckByType. Object ACEs
+	// with an object type audit only if it is in the list.
+	ObjectTypes []ObjectTypeNode
+	// GlobalSacl is the global object access auditing SACL of the kind of object, as set with
+	// auditpol /resourceSACL. It is evaluated after the SACL of the object.
+	GlobalSacl *Acl
+}
+
+// AuditEntry is an audit ACE that generates an event.
+type AuditEntry struct {
+	// Global is set for an ACE of AuditOptions.GlobalSacl
+	Global   bool   `json:"global,omitempty"`
+	AceIndex int    `json:"aceIndex"`
+	Ace      string `json:"ace"`
+	// Success is set for a SUCCESSFUL_ACCESS_ACE_FLAG match, and clear for a FAILED_ACCESS_ACE_FLAG one
+	Success bool `json:"success"`
+	// AccessMask are the audited rights: the granted rights of the ACE on success, and its
+	// desired rights on failure
+	AccessMask AccessMask `json:"accessMask"`
+}
+
+// AuditResult is the outcome of AuditCheck.
+type AuditResult struct {
+	// Success tells whether the access succeeded, which selects the success or failure audits
+	Success bool         `json:"success"`
+	Entries []AuditEntry `json:"entries,omitempty"`
+	// AuditedAccess are the rights of all entries, the accesses an event such as 4663 lists
+	AuditedAccess AccessMask `json:"auditedAccess"`
+}
+
+// auditAce returns the rights an audit ACE of the SACL logs for the access, or 0.
+func (e *accessEvaluator) auditAce(index int, ace *Ace, success bool, audited AccessMask) AccessMask {
+	if isInheritOnlyAce(ace) {
+		return 0
+	}
+	switch ace.AceType {
+	case SYSTEM_AUDIT_ACE_TYPE, SYSTEM_AUDIT_CALLBACK_ACE_TYPE:
+	case ACCESS_AUDIT_OBJECT_ACE_TYPE, SYSTEM_AUDIT_CALLBACK_OBJECT_ACE_TYPE:
+		if ace.ObjectType != "" && e.findObjectType(ace.ObjectType) < 0 {
+			return 0
+		}
+	default:
+		return 0
+	}
+	if success && !ace.AceFlags.Has(SUCCESSFUL_ACCESS_ACE_FLAG) || !success && !ace.AceFlags.Has(FAILED_ACCESS_ACE_FLAG) {
+		return 0
+	}
+	if !e.aceSidMatches(ace, false) {
+		return 0
+	}
+	mask := ace.AccessMask
+	if e.opts.MapAceGenericRights {
+		mask = e.mapping.Map(mask)
+	}
+	if mask&audited == 0 {
+		return 0
+	}
+	if ace.AceType.IsCallback() {
+		if _, applies := e.aceCondition(index, ace, false); !applies {
+			return 0
+		}
+	}
+	return mask & audited
+}
+
+// auditAcl appends the entries of the audit ACEs of a SACL that generate events.
+func (e *accessEvaluator) auditAcl(result *AuditResult, acl *Acl, global bool, audited AccessMask) {
+	if acl == nil {
+		return
+	}
+	for i := range acl.Aces {
+		ace := &acl.Aces[i]
+		mask := e.auditAce(i, ace, result.Success, audited)
+		if mask == 0 {
+			continue
+		}
+		result.Entries = append(result.Entries, AuditEntry{
+			Global:     global,
+			AceIndex:   i,
+			Ace:        DefaultFormatOptions().FormatAce(ace),
+			Success:    result.Success,
+			AccessMask: mask,
+		})
+		result.AuditedAccess |= mask
+	}
+}
+
+// AuditCheck returns the audit ACEs of the SACL that generate an event when token requests
+// desired access and is granted granted, like the object access auditing of AccessCheck.
+// The access succeeds if granted holds all desired rights, or any right for MAXIMUM_ALLOWED,
+// which is the GrantedAccess of an AccessCheckResult.
+//
+// An audit ACE with SUCCESSFUL_ACCESS_ACE_FLAG logs the granted rights it names when the access
+// succeeds, one with FAILED_ACCESS_ACE_FLAG the desired rights it names when it fails. It must
+// apply to a SID the token has enabled, and conditional ACEs to be TRUE. Inherit-only ACEs
+// do not apply to the object, and object ACEs only to their object type, see AuditOptions.
+func (sd *SecurityDescriptor) AuditCheck(token *Token, desired AccessMask, granted AccessMask, opts *AuditOptions) (*AuditResult, error) {
+	if opts == nil {
+		opts = &AuditOptions{}
+	}
+	e, err := newAccessEvaluator(sd, token, &AccessCheckOptions{
+		Profile:             opts.Profile,
+		Mapping:             opts.Mapping,
+		MapAceGenericRights: opts.MapAceGenericRights,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if opts.ObjectTypes != nil {
+		if err := e.setObjectTypes(opts.ObjectTypes); err != nil {
+			return nil, err
+		}
+	}
+	e.pass = &e.passes[0]
+
+	desired = e.mapping.Map(desired &^ MAXIMUM_ALLOWED)
+	granted = e.mapping.Map(granted)
+	result := &AuditResult{Success: granted != 0 && desired&^granted == 0}
+
+	audited := desired
+	if result.Success {
+		audited = granted
+	}
+	e.auditAcl(result, sd.SystemAcl, false, audited)
+	e.auditAcl(result, opts.GlobalSacl, true, audited)
+	return result, nil
+}
@@ -0,0 +1,137 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSecurityDescriptor_AuditCheck(t *testing.T) {
+	const (
+		user       = "S-1-5-21-1-2-3-1001"
+		userClass  = "bf967aba-0de6-11d0-a285-00aa003049e2"
+		otherClass = "bf967a86-0de6-11d0-a285-00aa003049e2"
+	)
+	token := &Token{User: user, Groups: []TokenGroup{
+		{Sid: "WD", Attributes: SE_GROUP_ENABLED},
+		{Sid: "BA", Attributes: SE_GROUP_USE_FOR_DENY_ONLY},
+	}, UserClaims: []Claim{{Name: "Title", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_STRING, Values: []interface{}{"PM"}}}}
+
+	tests := []struct {
+		name    string
+		sacl    string
+		desired AccessMask
+		granted AccessMask
+		success bool
+		entries []AuditEntry
+	}{
+		{
+			"success audit logs granted rights it names",
+			"(AU;SA;0x6;;;WD)",
+			0x3, 0x3, true,
+			[]AuditEntry{{AceIndex: 0, Ace: "(AU;SA;0x6;;;WD)", Success: true, AccessMask: 0x2}},
+		},
+		{
+			"success audit ignores failure",
+			"(AU;SA;FA;;;WD)",
+			FILE_WRITE_DATA, 0, false,
+			nil,
+		},
+		{
+			"failure audit logs desired rights",
+			"(AU;FA;FA;;;WD)",
+			0x3, 0, false,
+			[]AuditEntry{{AceIndex: 0, Ace: "(AU;FA;FA;;;WD)", AccessMask: 0x3}},
+		},
+		{
+			"partial grant is a failure",
+			"(AU;SAFA;0x2;;;WD)",
+			0x3, 0x1, false,
+			[]AuditEntry{{AceIndex: 0, Ace: "(AU;SAFA;0x2;;;WD)", AccessMask: 0x2}},
+		},
+		{
+			"maximum allowed logs granted rights",
+			"(AU;SA;FA;;;WD)",
+			MAXIMUM_ALLOWED, FILE_READ_ACCESS, true,
+			[]AuditEntry{{AceIndex: 0, Ace: "(AU;SA;FA;;;WD)", Success: true, AccessMask: FILE_READ_ACCESS}},
+		},
+		{
+			"generic desired rights are mapped",
+			"(AU;SA;0x1;;;WD)",
+			GENERIC_READ, FILE_READ_ACCESS, true,
+			[]AuditEntry{{AceIndex: 0, Ace: "(AU;SA;0x1;;;WD)", Success: true, AccessMask: 0x1}},
+		},
+		{
+			"rights not named are not audited",
+			"(AU;SA;0x6;;;WD)",
+			0x1, 0x1, true,
+			nil,
+		},
+		{
+			"inherit-only and deny-only sids do not audit",
+			"(AU;OICIIOSA;FA;;;WD)(AU;SA;FA;;;BA)(AU;SA;FA;;;S-1-5-21-1-2-3-1002)",
+			0x1, 0x1, true,
+			nil,
+		},
+		{
+			"object aces audit only their object type",
+			"(OU;SA;0x10;" + otherClass + ";;WD)(OU;SA;0x10;" + userClass + ";;WD)(OU;SA;0x20;;;WD)",
+			0x30, 0x30, true,
+			[]AuditEntry{
+				{AceIndex: 1, Ace: "(OU;SA;0x10;" + userClass + ";;WD)", Success: true, AccessMask: 0x10},
+				{AceIndex: 2, Ace: "(OU;SA;0x20;;;WD)", Success: true, AccessMask: 0x20},
+			},
+		},
+		{
+			"conditional audit",
+			`(XU;SA;0x1;;;WD;(@User.Title == "PM"))(XU;SA;0x1;;;WD;(@User.Title == "Dev"))`,
+			0x1, 0x1, true,
+			[]AuditEntry{{AceIndex: 0, Ace: `(XU;SA;0x1;;;WD;(@User.Title == "PM"))`, Success: true, AccessMask: 0x1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := ParseSDDL("O:BAG:SYD:S:" + tt.sacl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := &AuditOptions{ObjectTypes: []ObjectTypeNode{{Level: ACCESS_OBJECT_GUID, ObjectType: userClass}}}
+			result, err := sd.AuditCheck(token, tt.desired, tt.granted, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.success, result.Success)
+			assert.Equal(t, tt.entries, result.Entries)
+		})
+	}
+}
+
+func TestSecurityDescriptor_AuditCheck_GlobalSacl(t *testing.T) {
+	sd, err := ParseSDDL("O:BAG:SYD:(A;;FA;;;AU)S:(AU;SA;FW;;;AU)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	global, err := ParseSDDL("S:(AU;SAFA;FA;;;WD)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &Token{User: "S-1-5-21-1-2-3-1001", Groups: []TokenGroup{
+		{Sid: "WD", Attributes: SE_GROUP_ENABLED},
+		{Sid: "AU", Attributes: SE_GROUP_ENABLED},
+	}}
+	access, err := sd.AccessCheck(token, GENERIC_WRITE, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := sd.AuditCheck(token, GENERIC_WRITE, access.GrantedAccess, &AuditOptions{GlobalSacl: global.SystemAcl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, result.Success)
+	if assert.Len(t, result.Entries, 2) {
+		assert.False(t, result.Entries[0].Global)
+		assert.Equal(t, FileGenericMapping.GenericWrite, result.Entries[0].AccessMask)
+		assert.True(t, result.Entries[1].Global)
+		assert.Equal(t, FileGenericMapping.GenericWrite, result.Entries[1].AccessMask)
+	}
+	assert.Equal(t, FileGenericMapping.GenericWrite, result.AuditedAccess)
+}
@@ -0,0 +1,124 @@
+package winsddlconverter
+
+import "sort"
+
+// SecurityDescriptorPart identifies a variable-length part of a self-relative security descriptor.
+type SecurityDescriptorPart uint8
+
+const (
+	PartOwner SecurityDescriptorPart = iota
+	PartGroup
+	PartSacl
+	PartDacl
+)
+
+func (v SecurityDescriptorPart) String() string {
+	switch v {
+	case PartOwner:
+		return "owner"
+	case PartGroup:
+		return "group"
+	case PartSacl:
+		return "sacl"
+	case PartDacl:
+		return "dacl"
+	default:
+		return "?"
+	}
+}
+
+// BinaryLayout controls how ToBinary arranges the parts of a self-relative security descriptor.
+//
+// ParseBinary stores the layout it found in SecurityDescriptor.Layout, including any padding
+// between the parts, so that ToBinary reproduces the original bytes.
+type BinaryLayout struct {
+	// Order in which the parts are written. Missing parts are appended in NTFS order.
+	Order []SecurityDescriptorPart
+	// AlignDword starts each part on a 4-byte boundary.
+	AlignDword bool
+	// AclRevision, when non-zero, is written as the revision of every ACL.
+	AclRevision uint8
+
+	// Bytes preserved by ParseBinary. sbz1 is written when SE_RM_CONTROL_VALID is not set.
+	sbz1     uint8
+	gaps     map[SecurityDescriptorPart][]byte
+	aclSlack map[SecurityDescriptorPart][]byte
+	trailing []byte
+}
+
+// NtfsLayout writes SACL, DACL, owner and group, as NTFS stores descriptors.
+func NtfsLayout() *BinaryLayout {
+	return &BinaryLayout{
+		Order:      []SecurityDescriptorPart{PartSacl, PartDacl, PartOwner, PartGroup},
+		AlignDword: true,
+	}
+}
+
+// SecurityInfoLayout writes owner, group, SACL and DACL, as returned by
+// GetSecurityInfo and GetNamedSecurityInfo.
+func SecurityInfoLayout() *BinaryLayout {
+	return &BinaryLayout{
+		Order:      []SecurityDescriptorPart{PartOwner, PartGroup, PartSacl, PartDacl},
+		AlignDword: true,
+	}
+}
+
+func (l *BinaryLayout) parts() []SecurityDescriptorPart {
+	var result []SecurityDescriptorPart
+	seen := make(map[SecurityDescriptorPart]bool)
+	for _, part := range l.Order {
+		if !seen[part] && part <= PartDacl {
+			seen[part] = true
+			result = append(result, part)
+		}
+	}
+	for _, part := range NtfsLayout().Order {
+		if !seen[part] {
+			result = append(result, part)
+		}
+	}
+	return result
+}
+
+func (l *BinaryLayout) padding(part SecurityDescriptorPart, offset int) []byte {
+	if gap, ok := l.gaps[part]; ok {
+		return gap
+	}
+	if l.AlignDword && offset%4 != 0 {
+		return make([]byte, 4-offset%4)
+	}
+	return nil
+}
+
+type layoutSpan struct {
+	part       SecurityDescriptorPart
+	start, end int
+}
+
+// newParsedLayout records the order of the parts and the bytes between them.
+// It returns nil when the parts overlap and cannot be reproduced.
+func newParsedLayout(data []byte, spans []layoutSpan, aclSlack map[SecurityDescriptorPart][]byte) *BinaryLayout {
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+
+	layout := &BinaryLayout{
+		AlignDword: true,
+		sbz1:       data[1],
+		gaps:       make(map[SecurityDescriptorPart][]byte),
+		aclSlack:   aclSlack,
+	}
+	end := 20
+	for _, span := range spans {
+		if span.start < end || span.end > len(data) {
+			return nil
+		}
+		layout.Order = append(layout.Order, span.part)
+		layout.gaps[span.part] = append([]byte(nil), data[end:span.start]...)
+		end = span.end
+	}
+	if end < len(data) {
+		layout.trailing = append([]byte(nil), data[end:]...)
+	}
+	return layout
+}
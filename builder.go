@@ -0,0 +1,166 @@
+package winsddlconverter
+
+import "fmt"
+
+// InheritanceScope is the "Applies to" of an ACE on a folder.
+type InheritanceScope uint8
+
+const (
+	ScopeThisFolder InheritanceScope = 1 << iota
+	ScopeSubfolders
+	ScopeFiles
+	// ScopeNoPropagate applies the ACE to direct children only
+	ScopeNoPropagate
+
+	ScopeThisFolderOnly               = ScopeThisFolder
+	ScopeThisFolderSubfoldersAndFiles = ScopeThisFolder | ScopeSubfolders | ScopeFiles
+	ScopeThisFolderAndSubfolders      = ScopeThisFolder | ScopeSubfolders
+	ScopeThisFolderAndFiles           = ScopeThisFolder | ScopeFiles
+	ScopeSubfoldersAndFilesOnly       = ScopeSubfolders | ScopeFiles
+	ScopeSubfoldersOnly               = ScopeSubfolders
+	ScopeFilesOnly                    = ScopeFiles
+)
+
+// AceFlags returns the inheritance flags of the scope.
+func (s InheritanceScope) AceFlags() (AceFlags, error) {
+	var flags AceFlags
+	if s&ScopeSubfolders != 0 {
+		flags |= CONTAINER_INHERIT_ACE
+	}
+	if s&ScopeFiles != 0 {
+		flags |= OBJECT_INHERIT_ACE
+	}
+	if flags == 0 && s&ScopeThisFolder == 0 {
+		return 0, fmt.Errorf("inheritance scope applies to nothing")
+	}
+	if flags == 0 && s&ScopeNoPropagate != 0 {
+		return 0, fmt.Errorf("inheritance scope is not inherited but has ScopeNoPropagate")
+	}
+	if s&ScopeThisFolder == 0 {
+		flags |= INHERIT_ONLY_ACE
+	}
+	if s&ScopeNoPropagate != 0 {
+		flags |= NO_PROPAGATE_INHERIT_ACE
+	}
+	return flags, nil
+}
+
+// Builder assembles a SecurityDescriptor. The first error is kept and returned by Build.
+//
+//	sd, err := NewBuilder().
+//		Owner("BA").Group("SY").
+//		Allow("BA", FILE_ALL_ACCESS, ScopeThisFolderSubfoldersAndFiles).
+//		Allow("BU", FILE_READ_ACCESS|FILE_EXECUTE, ScopeThisFolderSubfoldersAndFiles).
+//		Protect().
+//		Build()
+type Builder struct {
+	sd  *SecurityDescriptor
+	err error
+}
+
+// NewBuilder returns a builder for a descriptor with an empty DACL, which grants no access.
+func NewBuilder() *Builder {
+	return &Builder{sd: &SecurityDescriptor{DiscretionaryAcl: &Acl{Aces: []Ace{}}}}
+}
+
+func (b *Builder) fail(format string, args ...interface{}) *Builder {
+	if b.err == nil {
+		b.err = fmt.Errorf(format, args...)
+	}
+	return b
+}
+
+func (b *Builder) Owner(sid string) *Builder {
+	b.sd.Owner = GetRawSid(sid)
+	return b
+}
+
+func (b *Builder) Group(sid string) *Builder {
+	b.sd.Group = GetRawSid(sid)
+	return b
+}
+
+func (b *Builder) addAce(acl **Acl, aceType AceType, principal string, rights AccessMask, flags AceFlags, scope InheritanceScope) *Builder {
+	scopeFlags, err := scope.AceFlags()
+	if err != nil {
+		return b.fail("%s ACE for %s: %v", aceType, principal, err)
+	}
+	if *acl == nil {
+		*acl = &Acl{Aces: []Ace{}}
+	}
+	(*acl).Aces = append((*acl).Aces, Ace{
+		AceType:    aceType,
+		AceFlags:   scopeFlags | flags,
+		AccessMask: rights,
+		Sid:        principal,
+	})
+	return b
+}
+
+// Allow grants rights to principal, a SID or alias.
+func (b *Builder) Allow(principal string, rights AccessMask, scope InheritanceScope) *Builder {
+	return b.addAce(&b.sd.DiscretionaryAcl, ACCESS_ALLOWED_ACE_TYPE, principal, rights, 0, scope)
+}
+
+// Deny denies rights to principal, a SID or alias.
+func (b *Builder) Deny(principal string, rights AccessMask, scope InheritanceScope) *Builder {
+	return b.addAce(&b.sd.DiscretionaryAcl, ACCESS_DENIED_ACE_TYPE, principal, rights, 0, scope)
+}
+
+// Audit logs uses of rights by principal. events is SUCCESSFUL_ACCESS_ACE_FLAG, FAILED_ACCESS_ACE_FLAG or both.
+func (b *Builder) Audit(principal string, rights AccessMask, scope InheritanceScope, events AceFlags) *Builder {
+	if events == 0 || events&^(SUCCESSFUL_ACCESS_ACE_FLAG|FAILED_ACCESS_ACE_FLAG) != 0 {
+		return b.fail("audit ACE for %s: events must be SUCCESSFUL_ACCESS_ACE_FLAG and/or FAILED_ACCESS_ACE_FLAG", principal)
+	}
+	return b.addAce(&b.sd.SystemAcl, SYSTEM_AUDIT_ACE_TYPE, principal, rights, events, scope)
+}
+
+// Protect blocks inheritance of ACEs from the parent into the DACL.
+func (b *Builder) Protect() *Builder {
+	b.sd.Control |= SE_DACL_PROTECTED
+	return b
+}
+
+// Label sets the mandatory integrity label. policy is a combination of
+// SYSTEM_MANDATORY_LABEL_NO_WRITE_UP, NO_READ_UP and NO_EXECUTE_UP.
+func (b *Builder) Label(level IntegrityLevel, policy AccessMask, scope InheritanceScope) *Builder {
+	if policy&^(SYSTEM_MANDATORY_LABEL_NO_WRITE_UP|SYSTEM_MANDATORY_LABEL_NO_READ_UP|SYSTEM_MANDATORY_LABEL_NO_EXECUTE_UP) != 0 {
+		return b.fail("label policy 0x%x has bits other than NW, NR and NX", uint32(policy))
+	}
+	if b.sd.SystemAcl != nil {
+		aces := b.sd.SystemAcl.Aces[:0]
+		for _, ace := range b.sd.SystemAcl.Aces {
+			if ace.AceType != SYSTEM_MANDATORY_LABEL_ACE_TYPE {
+				aces = append(aces, ace)
+			}
+		}
+		b.sd.SystemAcl.Aces = aces
+	}
+	return b.addAce(&b.sd.SystemAcl, SYSTEM_MANDATORY_LABEL_ACE_TYPE, level.alias(), policy, 0, scope)
+}
+
+// Build returns the descriptor with the DACL in canonical order, deny ACEs first,
+// or the first error of the builder or of Validate.
+func (b *Builder) Build() (*SecurityDescriptor, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	sd := &SecurityDescriptor{
+		Control:          b.sd.Control,
+		Owner:            b.sd.Owner,
+		Group:            b.sd.Group,
+		DiscretionaryAcl: b.sd.DiscretionaryAcl.Clone(),
+		SystemAcl:        b.sd.SystemAcl.Clone(),
+	}
+	sd.DiscretionaryAcl.Canonicalize()
+	sd.DiscretionaryAcl.AclRevision = sd.DiscretionaryAcl.RequiredRevision()
+	if sd.SystemAcl != nil {
+		sd.SystemAcl.AclRevision = sd.SystemAcl.RequiredRevision()
+	}
+
+	if err := validationError(sd.Validate()); err != nil {
+		return nil, err
+	}
+	return sd, nil
+}
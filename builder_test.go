@@ -0,0 +1,49 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	sd, err := NewBuilder().
+		Owner("BA").
+		Group("SY").
+		Allow("BA", FILE_ALL_ACCESS, ScopeThisFolderSubfoldersAndFiles).
+		Allow("BU", GENERIC_READ|GENERIC_EXECUTE, ScopeSubfoldersAndFilesOnly).
+		Deny("S-1-5-21-1-2-3-1001", DELETE, ScopeThisFolderOnly).
+		Allow("CO", FILE_ALL_ACCESS, ScopeFiles|ScopeNoPropagate).
+		Audit("WD", DELETE, ScopeThisFolderSubfoldersAndFiles, FAILED_ACCESS_ACE_FLAG).
+		Label(MediumIntegrity, SYSTEM_MANDATORY_LABEL_NO_READ_UP, ScopeThisFolder).
+		Label(HighIntegrity, SYSTEM_MANDATORY_LABEL_NO_WRITE_UP, ScopeThisFolderSubfoldersAndFiles).
+		Protect().
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "O:BAG:SYD:P(D;;SD;;;S-1-5-21-1-2-3-1001)(A;OICI;FA;;;BA)(A;OICIIO;GXGR;;;BU)(A;OINPIO;FA;;;CO)"+
+		"S:(AU;OICIFA;SD;;;WD)(ML;OICI;0x1;;;HI)", sd.ToSddl())
+	tokens := &FormatOptions{MaskStyle: MaskStyleTokens}
+	assert.Equal(t, "(ML;OICI;NW;;;HI)", tokens.FormatAce(&sd.SystemAcl.Aces[1]))
+	_, err = sd.ToBinary()
+	assert.NoError(t, err)
+}
+
+func TestBuilder_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		builder *Builder
+	}{
+		{"empty scope", NewBuilder().Allow("BA", FILE_ALL_ACCESS, 0)},
+		{"no propagate without inheritance", NewBuilder().Allow("BA", FILE_ALL_ACCESS, ScopeThisFolder|ScopeNoPropagate)},
+		{"audit without events", NewBuilder().Audit("WD", DELETE, ScopeThisFolder, 0)},
+		{"label policy", NewBuilder().Label(LowIntegrity, FILE_ALL_ACCESS, ScopeThisFolder)},
+		{"invalid principal", NewBuilder().Deny("S-1-x", DELETE, ScopeThisFolder)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.builder.Build()
+			assert.Error(t, err)
+		})
+	}
+}
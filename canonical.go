@@ -0,0 +1,89 @@
+package winsddlconverter
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Canonical DACL groups, in the order Windows expects them.
+// Object and callback ACEs take the precedence of their plain counterpart: OD and XD are deny ACEs,
+// OA and XA allow ACEs.
+const (
+	rankExplicitDeny = iota
+	rankExplicitAllow
+	rankInherited
+)
+
+var canonicalRankNames = []string{"explicit deny", "explicit allow", "inherited"}
+
+// canonicalRank returns the group of an ACE in a canonical DACL.
+func canonicalRank(ace *Ace) int {
+	if isInheritedAce(ace) {
+		return rankInherited
+	}
+	switch ace.AceType {
+	case ACCESS_DENIED_ACE_TYPE, ACCESS_DENIED_OBJECT_ACE_TYPE,
+		ACCESS_DENIED_CALLBACK_ACE_TYPE, ACCESS_DENIED_CALLBACK_OBJECT_ACE_TYPE:
+		return rankExplicitDeny
+	default:
+		return rankExplicitAllow
+	}
+}
+
+// CanonicalViolation is an ACE placed after an ACE it must precede.
+type CanonicalViolation struct {
+	// Index of the misplaced ACE
+	Index int `json:"index"`
+	// Precedes is the index of the first earlier ACE that belongs after it
+	Precedes int    `json:"precedes"`
+	Message  string `json:"message"`
+}
+
+func (v CanonicalViolation) String() string {
+	return fmt.Sprintf("aces[%d]: %s", v.Index, v.Message)
+}
+
+// CanonicalViolations reports the ACEs out of canonical order: explicit deny ACEs,
+// then explicit allow ACEs, then inherited ACEs. The order within a group is free.
+func (acl *Acl) CanonicalViolations() []CanonicalViolation {
+	var violations []CanonicalViolation
+	format := DefaultFormatOptions()
+	// first index of each group seen so far
+	first := []int{-1, -1, -1}
+	for i := range acl.Aces {
+		rank := canonicalRank(&acl.Aces[i])
+		// report against the earliest ACE of any later group
+		precedes := -1
+		for r := rank + 1; r < len(first); r++ {
+			if first[r] >= 0 && (precedes < 0 || first[r] < precedes) {
+				precedes = first[r]
+			}
+		}
+		if precedes >= 0 {
+			violations = append(violations, CanonicalViolation{
+				Index:    i,
+				Precedes: precedes,
+				Message: fmt.Sprintf("%s ACE %s after %s ACE %d %s", canonicalRankNames[rank], format.FormatAce(&acl.Aces[i]),
+					canonicalRankNames[canonicalRank(&acl.Aces[precedes])], precedes, format.FormatAce(&acl.Aces[precedes])),
+			})
+		}
+		if first[rank] < 0 {
+			first[rank] = i
+		}
+	}
+	return violations
+}
+
+// IsCanonical reports whether the ACL has no CanonicalViolations.
+func (acl *Acl) IsCanonical() bool {
+	return len(acl.CanonicalViolations()) == 0
+}
+
+// Canonicalize moves explicit deny ACEs before explicit allow ACEs and inherited ACEs last.
+// ACEs keep their relative order within each group, so the inherited order is unchanged.
+func (acl *Acl) Canonicalize() {
+	aces := acl.Aces
+	sort.SliceStable(aces, func(i, j int) bool {
+		return canonicalRank(&aces[i]) < canonicalRank(&aces[j])
+	})
+}
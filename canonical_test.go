@@ -0,0 +1,77 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAcl_Canonicalize(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		violations []CanonicalViolation
+		want       string
+	}{
+		{
+			"canonical",
+			"D:(D;;FA;;;BG)(OD;;0x100;00299570-246d-11d0-a768-00aa006e0529;;BU)(A;;FA;;;BA)(OA;;0x100;00299570-246d-11d0-a768-00aa006e0529;;AU)(A;ID;FA;;;SY)",
+			nil,
+			"D:(D;;FA;;;BG)(OD;;0x100;00299570-246d-11d0-a768-00aa006e0529;;BU)(A;;FA;;;BA)(OA;;0x100;00299570-246d-11d0-a768-00aa006e0529;;AU)(A;ID;FA;;;SY)",
+		},
+		{
+			"deny after allow",
+			"D:(A;;FA;;;BA)(OD;;0x100;00299570-246d-11d0-a768-00aa006e0529;;BU)",
+			[]CanonicalViolation{{
+				Index:    1,
+				Precedes: 0,
+				Message:  "explicit deny ACE (OD;;0x100;00299570-246d-11d0-a768-00aa006e0529;;BU) after explicit allow ACE 0 (A;;FA;;;BA)",
+			}},
+			"D:(OD;;0x100;00299570-246d-11d0-a768-00aa006e0529;;BU)(A;;FA;;;BA)",
+		},
+		{
+			"conditional deny after allow",
+			"D:(A;;FA;;;WD)(XD;;FA;;;WD;(@User.Title == \"Contractor\"))",
+			[]CanonicalViolation{{
+				Index:    1,
+				Precedes: 0,
+				Message:  "explicit deny ACE (XD;;FA;;;WD;(@User.Title == \"Contractor\")) after explicit allow ACE 0 (A;;FA;;;WD)",
+			}},
+			"D:(XD;;FA;;;WD;(@User.Title == \"Contractor\"))(A;;FA;;;WD)",
+		},
+		{
+			"explicit after inherited",
+			"D:(A;ID;FR;;;WD)(A;;FA;;;BA)(D;ID;FA;;;BG)(D;;FA;;;AN)(A;ID;FA;;;SY)",
+			[]CanonicalViolation{
+				{Index: 1, Precedes: 0, Message: "explicit allow ACE (A;;FA;;;BA) after inherited ACE 0 (A;ID;FR;;;WD)"},
+				{Index: 3, Precedes: 0, Message: "explicit deny ACE (D;;FA;;;AN) after inherited ACE 0 (A;ID;FR;;;WD)"},
+			},
+			"D:(D;;FA;;;AN)(A;;FA;;;BA)(A;ID;FR;;;WD)(D;ID;FA;;;BG)(A;ID;FA;;;SY)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := ParseSDDL(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			acl := sd.DiscretionaryAcl
+			assert.Equal(t, tt.violations, acl.CanonicalViolations())
+			assert.Equal(t, tt.violations == nil, acl.IsCanonical())
+			acl.Canonicalize()
+			assert.True(t, acl.IsCanonical())
+			assert.Equal(t, tt.want, sd.ToSddl())
+		})
+	}
+}
+
+func TestAcl_Canonicalize_CallbackObjectDeny(t *testing.T) {
+	acl := &Acl{AclRevision: ACL_REVISION_DS, Aces: []Ace{
+		{AceType: ACCESS_ALLOWED_ACE_TYPE, AccessMask: FILE_ALL_ACCESS, Sid: "WD"},
+		{AceType: ACCESS_DENIED_CALLBACK_OBJECT_ACE_TYPE, AccessMask: 0x100, Sid: "WD",
+			ObjectType: "00299570-246d-11d0-a768-00aa006e0529"},
+	}}
+	assert.False(t, acl.IsCanonical())
+	acl.Canonicalize()
+	assert.Equal(t, ACCESS_DENIED_CALLBACK_OBJECT_ACE_TYPE, acl.Aces[0].AceType)
+	assert.True(t, acl.IsCanonical())
+}
@@ -0,0 +1,184 @@
+package winsddlconverter
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// CentralAccessRule is a rule of a central access policy, as configured in Active Directory.
+type CentralAccessRule struct {
+	Name string `json:"name"`
+	// AppliesTo is a conditional expression over resource attributes, such as
+	// (@Resource.Department == "Finance"). The rule applies to objects for which it is TRUE,
+	// or to all objects if it is empty.
+	AppliesTo string `json:"appliesTo,omitempty"`
+	// Permissions is SDDL with the DACL that limits access to the objects, such as
+	// D:(A;;FA;;;BA)(XA;;FA;;;AU;(@User.Department == @Resource.Department))
+	Permissions string `json:"permissions"`
+	// ProposedPermissions stages a change of Permissions. It is evaluated along with Permissions
+	// but only reported, see AccessCheckResult.Proposed.
+	ProposedPermissions string `json:"proposedPermissions,omitempty"`
+}
+
+// CentralAccessPolicy is a set of central access rules, referred to by the SP ACEs of
+// objects through its ID, a SID of the form S-1-17-...
+type CentralAccessPolicy struct {
+	Name  string              `json:"name"`
+	Sid   string              `json:"sid"`
+	Rules []CentralAccessRule `json:"rules"`
+}
+
+// CentralAccessPolicyStore holds the central access policies known to access checks,
+// like the policies a file server receives through group policy.
+type CentralAccessPolicyStore struct {
+	Policies []CentralAccessPolicy `json:"policies"`
+}
+
+// RecoveryCentralAccessPolicy applies to objects whose SP ACE refers to a policy that is not
+// in the store. Like on Windows, it grants full control to administrators, SYSTEM and the owner.
+var RecoveryCentralAccessPolicy = CentralAccessPolicy{
+	Name: "Recovery Policy",
+	Rules: []CentralAccessRule{{
+		Name:        "Recovery Rule",
+		Permissions: "D:(A;;FA;;;BA)(A;;FA;;;SY)(A;;FA;;;OW)",
+	}},
+}
+
+// ParseCentralAccessPolicies reads a store written as JSON and validates it.
+func ParseCentralAccessPolicies(data []byte) (*CentralAccessPolicyStore, error) {
+	store := &CentralAccessPolicyStore{}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("invalid central access policy JSON: %v", err)
+	}
+	if err := store.Validate(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// LoadCentralAccessPolicies reads a store from a JSON file, see ParseCentralAccessPolicies.
+func LoadCentralAccessPolicies(path string) (*CentralAccessPolicyStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCentralAccessPolicies(data)
+}
+
+// Validate checks the policy IDs, conditions and permissions of the store.
+func (s *CentralAccessPolicyStore) Validate() error {
+	seen := map[string]bool{}
+	for _, policy := range s.Policies {
+		if _, err := MarshalSidFromString(policy.Sid); err != nil {
+			return fmt.Errorf("central access policy %q: %v", policy.Name, err)
+		}
+		sid := GetRawSid(policy.Sid)
+		if seen[sid] {
+			return fmt.Errorf("duplicate central access policy %s", sid)
+		}
+		seen[sid] = true
+		for _, rule := range policy.Rules {
+			if _, err := compileCentralAccessRule(&rule); err != nil {
+				return fmt.Errorf("central access policy %q: %v", policy.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Policy returns the policy with an ID, or nil.
+func (s *CentralAccessPolicyStore) Policy(sid string) *CentralAccessPolicy {
+	sid = GetRawSid(sid)
+	for i := range s.Policies {
+		if GetRawSid(s.Policies[i].Sid) == sid {
+			return &s.Policies[i]
+		}
+	}
+	return nil
+}
+
+// centralAccessRule is a rule that applies to the object being checked.
+type centralAccessRule struct {
+	name        string
+	appliesTo   []condToken
+	permissions *Acl
+	// proposed is nil unless the rule stages other permissions
+	proposed *Acl
+}
+
+func parseRulePermissions(rule *CentralAccessRule, sddl string) (*Acl, error) {
+	sd, err := ParseSDDL(sddl)
+	if err != nil {
+		return nil, fmt.Errorf("rule %q: %v", rule.Name, err)
+	}
+	if sd.DiscretionaryAcl == nil && sd.Control&SE_DACL_PRESENT == 0 {
+		return nil, fmt.Errorf("rule %q: permissions without a DACL", rule.Name)
+	}
+	return sd.DiscretionaryAcl, nil
+}
+
+func compileCentralAccessRule(rule *CentralAccessRule) (*centralAccessRule, error) {
+	compiled := &centralAccessRule{name: rule.Name}
+	var err error
+	if rule.AppliesTo != "" {
+		if compiled.appliesTo, err = parseCondition(rule.AppliesTo); err != nil {
+			return nil, fmt.Errorf("rule %q: %v", rule.Name, err)
+		}
+	}
+	if compiled.permissions, err = parseRulePermissions(rule, rule.Permissions); err != nil {
+		return nil, err
+	}
+	if rule.ProposedPermissions != "" {
+		if compiled.proposed, err = parseRulePermissions(rule, rule.ProposedPermissions); err != nil {
+			return nil, err
+		}
+	}
+	return compiled, nil
+}
+
+// applyCentralAccessPolicies collects the rules of the policies the effective SP ACEs of the
+// SACL refer to whose applies-to condition is TRUE for the object.
+func (e *accessEvaluator) applyCentralAccessPolicies() error {
+	store := e.opts.CentralAccessPolicies
+	if store == nil || e.sd.SystemAcl == nil {
+		return nil
+	}
+	for i := range e.sd.SystemAcl.Aces {
+		ace := &e.sd.SystemAcl.Aces[i]
+		if ace.AceType != SYSTEM_SCOPED_POLICY_ID_ACE_TYPE || isInheritOnlyAce(ace) {
+			continue
+		}
+		policy := store.Policy(ace.Sid)
+		if policy == nil {
+			e.traceStep(0, 0, "central access policy %s is not in the store, the recovery policy applies", GetRawSid(ace.Sid))
+			policy = &RecoveryCentralAccessPolicy
+		}
+		for _, rule := range policy.Rules {
+			compiled, err := compileCentralAccessRule(&rule)
+			if err != nil {
+				return fmt.Errorf("central access policy %q: %v", policy.Name, err)
+			}
+			if compiled.appliesTo != nil {
+				context := newConditionContext(e.token, e.passes[0].sids, e.resource)
+				result, _ := context.evaluate(compiled.appliesTo)
+				if result != ConditionTrue {
+					e.traceStep(0, 0, "central access rule %q does not apply because its applies-to condition is %s", rule.Name, result)
+					continue
+				}
+			}
+			e.rules = append(e.rules, *compiled)
+		}
+	}
+	return nil
+}
+
+// staging reports whether a rule that applies has proposed permissions.
+func (e *accessEvaluator) staging() bool {
+	for _, rule := range e.rules {
+		if rule.proposed != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testCentralAccessPolicies = `{"policies": [{
+	"name": "Finance Policy",
+	"sid": "S-1-17-1",
+	"rules": [
+		{
+			"name": "Finance Documents",
+			"appliesTo": "(@Resource.Department == \"Finance\")",
+			"permissions": "D:(A;;FA;;;BA)(XA;;FA;;;AU;(@User.Department == @Resource.Department))",
+			"proposedPermissions": "D:(A;;FA;;;BA)(XA;;FR;;;AU;(@User.Department == @Resource.Department))"
+		},
+		{
+			"name": "Read Only Archive",
+			"appliesTo": "(@Resource.Archived == 1)",
+			"permissions": "D:(A;;FR;;;AU)"
+		}
+	]
+}]}`
+
+func TestLoadCentralAccessPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.json")
+	if err := os.WriteFile(path, []byte(testCentralAccessPolicies), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store, err := LoadCentralAccessPolicies(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.NotNil(t, store.Policy("S-1-17-1")) {
+		assert.Equal(t, "Finance Policy", store.Policy("S-1-17-1").Name)
+		assert.Len(t, store.Policy("S-1-17-1").Rules, 2)
+	}
+	assert.Nil(t, store.Policy("S-1-17-2"))
+
+	for _, data := range []string{
+		`{"policies": [{"name": "x", "sid": "S-1-x", "rules": []}]}`,
+		`{"policies": [{"name": "x", "sid": "S-1-17-1"}, {"name": "y", "sid": "S-1-17-1"}]}`,
+		`{"policies": [{"name": "x", "sid": "S-1-17-1", "rules": [{"name": "r", "permissions": "O:BA"}]}]}`,
+		`{"policies": [{"name": "x", "sid": "S-1-17-1", "rules": [{"name": "r", "appliesTo": "(@Resource.x ==)", "permissions": "D:"}]}]}`,
+		`{"policies": [`,
+	} {
+		_, err := ParseCentralAccessPolicies([]byte(data))
+		assert.Error(t, err, data)
+	}
+}
+
+func TestSecurityDescriptor_AccessCheck_CentralAccessPolicy(t *testing.T) {
+	store, err := ParseCentralAccessPolicies([]byte(testCentralAccessPolicies))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const user = "S-1-5-21-1-2-3-1001"
+	newToken := func(department string) *Token {
+		return &Token{User: user, Groups: []TokenGroup{{Sid: "AU", Attributes: SE_GROUP_ENABLED}},
+			UserClaims: []Claim{{Name: "Department", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_STRING, Values: []interface{}{department}}}}
+	}
+	readAccess, noAccess := AccessMask(FILE_READ_ACCESS), AccessMask(0)
+	const finance = `S:(SP;;;;;S-1-17-1)(RA;;;;;WD;("Department",TS,0x0,"Finance"))`
+	const archive = `S:(SP;;;;;S-1-17-1)(RA;;;;;WD;("Department",TS,0x0,"Sales"))(RA;;;;;WD;("Archived",TU,0x0,1))`
+
+	tests := []struct {
+		name     string
+		sddl     string
+		token    *Token
+		store    *CentralAccessPolicyStore
+		granted  AccessMask
+		proposed *AccessMask
+	}{
+		{"rule grants the department", "O:BAG:SYD:(A;;FA;;;AU)" + finance, newToken("Finance"), store, FILE_ALL_ACCESS, &readAccess},
+		{"rule limits other departments", "O:BAG:SYD:(A;;FA;;;AU)" + finance, newToken("Sales"), store, 0, &noAccess},
+		{"rule does not widen the dacl", "O:BAG:SYD:(A;;FR;;;AU)" + finance, newToken("Finance"), store, FILE_READ_ACCESS, &readAccess},
+		{"rule that does not apply", "O:BAG:SYD:(A;;FA;;;AU)" + archive, newToken("Sales"), store, FILE_READ_ACCESS, nil},
+		{"sp ace without store is ignored", "O:BAG:SYD:(A;;FA;;;AU)" + finance, newToken("Sales"), nil, FILE_ALL_ACCESS, nil},
+		{"unknown policy uses recovery policy", "O:BAG:SYD:(A;;FA;;;AU)S:(SP;;;;;S-1-17-9)", newToken("Finance"), store, 0, nil},
+		{"recovery policy grants the owner", "O:" + user + "G:SYD:(A;;FA;;;AU)S:(SP;;;;;S-1-17-9)", newToken("Finance"), store, FILE_ALL_ACCESS, nil},
+		{"inherit-only sp ace", "O:BAG:SYD:(A;;FA;;;AU)S:(SP;OICIIO;;;;S-1-17-9)", newToken("Finance"), store, FILE_ALL_ACCESS, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := ParseSDDL(tt.sddl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := sd.AccessCheck(tt.token, MAXIMUM_ALLOWED, &AccessCheckOptions{CentralAccessPolicies: tt.store})
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.granted, result.GrantedAccess)
+			if tt.proposed == nil {
+				assert.Nil(t, result.Proposed)
+			} else if assert.NotNil(t, result.Proposed) {
+				assert.Equal(t, *tt.proposed, result.Proposed.GrantedAccess)
+			}
+		})
+	}
+}
+
+func TestSecurityDescriptor_AccessCheck_CentralAccessPolicyTrace(t *testing.T) {
+	store, err := ParseCentralAccessPolicies([]byte(testCentralAccessPolicies))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := ParseSDDL(`O:BAG:SYD:(A;;FA;;;AU)S:(SP;;;;;S-1-17-1)(RA;;;;;WD;("Department",TS,0x0,"Finance"))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &Token{User: "S-1-5-21-1-2-3-1001", Groups: []TokenGroup{{Sid: "AU", Attributes: SE_GROUP_ENABLED}}}
+	result, err := sd.AccessCheck(token, FILE_READ_DATA, &AccessCheckOptions{CentralAccessPolicies: store, Trace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, AccessDenied, result.Status)
+	var messages []string
+	for _, step := range result.Trace {
+		messages = append(messages, step.Message)
+	}
+	assert.Equal(t, []string{
+		`central access rule "Read Only Archive" does not apply because its applies-to condition is UNKNOWN`,
+		"ACE #0 (A;;FA;;;AU) granted FILE_READ_DATA, FILE_WRITE_DATA, FILE_APPEND_DATA, FILE_READ_EA, FILE_WRITE_EA, FILE_EXECUTE, " +
+			"FILE_DELETE_CHILD, FILE_READ_ATTRIBUTES, FILE_WRITE_ATTRIBUTES, DELETE, READ_CONTROL, WRITE_DAC, WRITE_OWNER, SYNCHRONIZE " +
+			"because the token holds NT AUTHORITY\\Authenticated Users",
+		`central access rule "Finance Documents": ACE #1 (XA;;FA;;;AU;(@User.Department == @Resource.Department)) does not apply because its condition is UNKNOWN`,
+		`central access rule "Finance Documents (proposed)": ACE #1 (XA;;FR;;;AU;(@User.Department == @Resource.Department)) does not apply because its condition is UNKNOWN`,
+	}, messages)
+	assert.Equal(t, "Finance Documents", result.Trace[2].Rule)
+}
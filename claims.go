@@ -0,0 +1,455 @@
+package winsddlconverter
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// ClaimType is the CLAIM_SECURITY_ATTRIBUTE_TYPE_* value type of a claim.
+type ClaimType uint16
+
+const (
+	CLAIM_SECURITY_ATTRIBUTE_TYPE_INT64        ClaimType = 0x0001
+	CLAIM_SECURITY_ATTRIBUTE_TYPE_UINT64       ClaimType = 0x0002
+	CLAIM_SECURITY_ATTRIBUTE_TYPE_STRING       ClaimType = 0x0003
+	CLAIM_SECURITY_ATTRIBUTE_TYPE_SID          ClaimType = 0x0005
+	CLAIM_SECURITY_ATTRIBUTE_TYPE_BOOLEAN      ClaimType = 0x0006
+	CLAIM_SECURITY_ATTRIBUTE_TYPE_OCTET_STRING ClaimType = 0x0010
+)
+
+// ClaimFlags are the CLAIM_SECURITY_ATTRIBUTE_* flags of a claim.
+type ClaimFlags uint32
+
+const (
+	CLAIM_SECURITY_ATTRIBUTE_NON_INHERITABLE      ClaimFlags = 0x0001
+	CLAIM_SECURITY_ATTRIBUTE_VALUE_CASE_SENSITIVE ClaimFlags = 0x0002
+	CLAIM_SECURITY_ATTRIBUTE_USE_FOR_DENY_ONLY    ClaimFlags = 0x0004
+	CLAIM_SECURITY_ATTRIBUTE_DISABLED_BY_DEFAULT  ClaimFlags = 0x0008
+	CLAIM_SECURITY_ATTRIBUTE_DISABLED             ClaimFlags = 0x0010
+	CLAIM_SECURITY_ATTRIBUTE_MANDATORY            ClaimFlags = 0x0020
+)
+
+// Claim is a user or device claim of a token, or a resource attribute of an RA ACE.
+type Claim struct {
+	Name  string     `json:"name"`
+	Type  ClaimType  `json:"type"`
+	Flags ClaimFlags `json:"flags,omitempty"`
+	// Values are int64, uint64, string, bool or []byte values as Type requires.
+	// SIDs are strings, octet strings may also be hex strings.
+	Values []interface{} `json:"values"`
+}
+
+// claimTypeTokens are the SDDL spellings of the claim types in RA ACEs.
+var claimTypeTokens = map[ClaimType]string{
+	CLAIM_SECURITY_ATTRIBUTE_TYPE_INT64:        "TI",
+	CLAIM_SECURITY_ATTRIBUTE_TYPE_UINT64:       "TU",
+	CLAIM_SECURITY_ATTRIBUTE_TYPE_STRING:       "TS",
+	CLAIM_SECURITY_ATTRIBUTE_TYPE_SID:          "TD",
+	CLAIM_SECURITY_ATTRIBUTE_TYPE_BOOLEAN:      "TB",
+	CLAIM_SECURITY_ATTRIBUTE_TYPE_OCTET_STRING: "TX",
+}
+
+// sidValue is a SID value of an expression or claim, distinct from strings.
+type sidValue string
+
+// value converts a claim value to the Go type of the claim type. Values decoded from
+// JSON arrive as float64 or json.Number.
+func (c *Claim) value(v interface{}) (interface{}, error) {
+	var number json.Number
+	switch x := v.(type) {
+	case int:
+		number = json.Number(strconv.Itoa(x))
+	case int64:
+		number = json.Number(strconv.FormatInt(x, 10))
+	case uint64:
+		number = json.Number(strconv.FormatUint(x, 10))
+	case float64:
+		if x != math.Trunc(x) {
+			return nil, fmt.Errorf("claim %q: %v is not an integer", c.Name, x)
+		}
+		number = json.Number(strconv.FormatFloat(x, 'f', -1, 64))
+	case json.Number:
+		number = x
+	}
+
+	switch c.Type {
+	case CLAIM_SECURITY_ATTRIBUTE_TYPE_INT64:
+		if number != "" {
+			if n, err := strconv.ParseInt(string(number), 10, 64); err == nil {
+				return n, nil
+			}
+		}
+	case CLAIM_SECURITY_ATTRIBUTE_TYPE_UINT64:
+		if number != "" {
+			if n, err := strconv.ParseUint(string(number), 10, 64); err == nil {
+				return n, nil
+			}
+		}
+	case CLAIM_SECURITY_ATTRIBUTE_TYPE_BOOLEAN:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		if number != "" {
+			return number != "0", nil
+		}
+	case CLAIM_SECURITY_ATTRIBUTE_TYPE_STRING:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case CLAIM_SECURITY_ATTRIBUTE_TYPE_SID:
+		if s, ok := v.(string); ok {
+			if _, err := MarshalSidFromString(s); err != nil {
+				return nil, fmt.Errorf("claim %q: %v", c.Name, err)
+			}
+			return sidValue(GetRawSid(s)), nil
+		}
+	case CLAIM_SECURITY_ATTRIBUTE_TYPE_OCTET_STRING:
+		switch x := v.(type) {
+		case []byte:
+			return x, nil
+		case string:
+			if b, err := hex.DecodeString(x); err == nil {
+				return b, nil
+			}
+		}
+	default:
+		return nil, fmt.Errorf("claim %q has unsupported type 0x%x", c.Name, uint16(c.Type))
+	}
+	return nil, fmt.Errorf("claim %q: invalid value %v for type %s", c.Name, v, claimTypeTokens[c.Type])
+}
+
+// values returns the values of the claim converted by value.
+func (c *Claim) values() ([]interface{}, error) {
+	values := make([]interface{}, 0, len(c.Values))
+	for _, v := range c.Values {
+		value, err := c.value(v)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func utf16Bytes(s string) []byte {
+	var b []byte
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return b
+}
+
+func utf16String(b []byte) (string, error) {
+	if len(b)%2 != 0 {
+		return "", fmt.Errorf("odd UTF-16 string length %d", len(b))
+	}
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// encodeResourceAttribute writes a claim as CLAIM_SECURITY_ATTRIBUTE_RELATIVE_V1, the
+// application data of RA ACEs. Offsets are relative to the start of the structure.
+func encodeResourceAttribute(claim *Claim) ([]byte, error) {
+	values, err := claim.values()
+	if err != nil {
+		return nil, err
+	}
+	header := 16 + 4*len(values)
+	data := make([]byte, header)
+	binary.LittleEndian.PutUint16(data[4:], uint16(claim.Type))
+	binary.LittleEndian.PutUint32(data[8:], uint32(claim.Flags))
+	binary.LittleEndian.PutUint32(data[12:], uint32(len(values)))
+
+	binary.LittleEndian.PutUint32(data[0:], uint32(len(data)))
+	data = append(data, utf16Bytes(claim.Name+"\x00")...)
+	for i, v := range values {
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+		binary.LittleEndian.PutUint32(data[16+4*i:], uint32(len(data)))
+		switch x := v.(type) {
+		case int64:
+			data = binary.LittleEndian.AppendUint64(data, uint64(x))
+		case uint64:
+			data = binary.LittleEndian.AppendUint64(data, x)
+		case bool:
+			var b uint64
+			if x {
+				b = 1
+			}
+			data = binary.LittleEndian.AppendUint64(data, b)
+		case string:
+			data = append(data, utf16Bytes(x+"\x00")...)
+		case sidValue:
+			sid, err := MarshalSidFromString(string(x))
+			if err != nil {
+				return nil, err
+			}
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(sid)))
+			data = append(data, sid...)
+		case []byte:
+			data = binary.LittleEndian.AppendUint32(data, uint32(len(x)))
+			data = append(data, x...)
+		}
+	}
+	return data, nil
+}
+
+// decodeResourceAttribute reads a CLAIM_SECURITY_ATTRIBUTE_RELATIVE_V1.
+func decodeResourceAttribute(data []byte) (*Claim, error) {
+	if len(data) < 16 {
+		return nil, fmt.Errorf("resource attribute needs 16 bytes, %d available", len(data))
+	}
+	stringAt := func(offset uint32) (string, error) {
+		if int(offset) > len(data) {
+			return "", fmt.Errorf("resource attribute string offset %d out of bounds", offset)
+		}
+		for end := int(offset); end+1 < len(data); end += 2 {
+			if data[end] == 0 && data[end+1] == 0 {
+				return utf16String(data[offset:end])
+			}
+		}
+		return "", fmt.Errorf("unterminated resource attribute string at %d", offset)
+	}
+	bytesAt := func(offset uint32, size uint32) ([]byte, error) {
+		if uint64(offset)+uint64(size) > uint64(len(data)) {
+			return nil, fmt.Errorf("resource attribute value at %d exceeds the data", offset)
+		}
+		return data[offset : offset+size], nil
+	}
+
+	name, err := stringAt(binary.LittleEndian.Uint32(data[0:]))
+	if err != nil {
+		return nil, err
+	}
+	claim := &Claim{
+		Name:  name,
+		Type:  ClaimType(binary.LittleEndian.Uint16(data[4:])),
+		Flags: ClaimFlags(binary.LittleEndian.Uint32(data[8:])),
+	}
+	count := binary.LittleEndian.Uint32(data[12:])
+	if uint64(16)+4*uint64(count) > uint64(len(data)) {
+		return nil, fmt.Errorf("resource attribute has %d values but only %d bytes", count, len(data))
+	}
+	for i := 0; i < int(count); i++ {
+		offset := binary.LittleEndian.Uint32(data[16+4*i:])
+		var value interface{}
+		switch claim.Type {
+		case CLAIM_SECURITY_ATTRIBUTE_TYPE_INT64, CLAIM_SECURITY_ATTRIBUTE_TYPE_UINT64, CLAIM_SECURITY_ATTRIBUTE_TYPE_BOOLEAN:
+			b, err := bytesAt(offset, 8)
+			if err != nil {
+				return nil, err
+			}
+			n := binary.LittleEndian.Uint64(b)
+			switch claim.Type {
+			case CLAIM_SECURITY_ATTRIBUTE_TYPE_INT64:
+				value = int64(n)
+			case CLAIM_SECURITY_ATTRIBUTE_TYPE_UINT64:
+				value = n
+			default:
+				value = n != 0
+			}
+		case CLAIM_SECURITY_ATTRIBUTE_TYPE_STRING:
+			if value, err = stringAt(offset); err != nil {
+				return nil, err
+			}
+		case CLAIM_SECURITY_ATTRIBUTE_TYPE_SID, CLAIM_SECURITY_ATTRIBUTE_TYPE_OCTET_STRING:
+			b, err := bytesAt(offset, 4)
+			if err != nil {
+				return nil, err
+			}
+			if b, err = bytesAt(offset+4, binary.LittleEndian.Uint32(b)); err != nil {
+				return nil, err
+			}
+			if claim.Type == CLAIM_SECURITY_ATTRIBUTE_TYPE_OCTET_STRING {
+				value = append([]byte{}, b...)
+				break
+			}
+			if len(b) < 8 || len(b) != 8+4*int(b[1]) {
+				return nil, fmt.Errorf("invalid SID in resource attribute %q", claim.Name)
+			}
+			if value, err = (&securityDescriptorParser{data: b}).parseSid(0); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("resource attribute %q has unsupported type 0x%x", claim.Name, uint16(claim.Type))
+		}
+		claim.Values = append(claim.Values, value)
+	}
+	return claim, nil
+}
+
+// formatResourceAttribute writes a claim in the SDDL of RA ACEs: ("name",TS,0x0,"value",...).
+func formatResourceAttribute(claim *Claim) (string, error) {
+	values, err := claim.values()
+	if err != nil {
+		return "", err
+	}
+	fields := []string{strconv.Quote(claim.Name), claimTypeTokens[claim.Type], fmt.Sprintf("0x%x", uint32(claim.Flags))}
+	for i, v := range values {
+		switch x := v.(type) {
+		case bool:
+			if x {
+				fields = append(fields, "1")
+			} else {
+				fields = append(fields, "0")
+			}
+		case string:
+			fields = append(fields, `"`+x+`"`)
+		case sidValue:
+			fields = append(fields, "SID("+claim.Values[i].(string)+")")
+		case []byte:
+			fields = append(fields, hex.EncodeToString(x))
+		default:
+			fields = append(fields, fmt.Sprintf("%d", x))
+		}
+	}
+	return "(" + strings.Join(fields, ",") + ")", nil
+}
+
+// splitSddlList splits at the commas that are outside of quotes and parentheses.
+func splitSddlList(s string) []string {
+	var fields []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			if end := strings.IndexByte(s[i+1:], '"'); end >= 0 {
+				i += end + 1
+			}
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				fields = append(fields, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(fields, strings.TrimSpace(s[start:]))
+}
+
+func unquoteSddl(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return "", fmt.Errorf("expected a quoted string: %s", s)
+	}
+	return s[1 : len(s)-1], nil
+}
+
+// parseResourceAttribute reads the SDDL of an RA ACE attribute.
+func parseResourceAttribute(text string) (*Claim, error) {
+	if len(text) < 2 || text[0] != '(' || text[len(text)-1] != ')' {
+		return nil, fmt.Errorf("invalid resource attribute: %s", text)
+	}
+	fields := splitSddlList(text[1 : len(text)-1])
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("invalid resource attribute: %s", text)
+	}
+	name, err := unquoteSddl(fields[0])
+	if err != nil {
+		return nil, err
+	}
+	claim := &Claim{Name: name}
+	for claimType, token := range claimTypeTokens {
+		if strings.EqualFold(fields[1], token) {
+			claim.Type = claimType
+		}
+	}
+	if claim.Type == 0 {
+		return nil, fmt.Errorf("unsupported resource attribute type: %s", fields[1])
+	}
+	flags, err := strconv.ParseUint(fields[2], 0, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resource attribute flags: %s", fields[2])
+	}
+	claim.Flags = ClaimFlags(flags)
+
+	for _, field := range fields[3:] {
+		var value interface{}
+		switch claim.Type {
+		case CLAIM_SECURITY_ATTRIBUTE_TYPE_INT64:
+			value, err = strconv.ParseInt(field, 0, 64)
+		case CLAIM_SECURITY_ATTRIBUTE_TYPE_UINT64:
+			value, err = strconv.ParseUint(field, 0, 64)
+		case CLAIM_SECURITY_ATTRIBUTE_TYPE_BOOLEAN:
+			var n uint64
+			n, err = strconv.ParseUint(field, 0, 64)
+			value = n != 0
+		case CLAIM_SECURITY_ATTRIBUTE_TYPE_STRING:
+			value, err = unquoteSddl(field)
+		case CLAIM_SECURITY_ATTRIBUTE_TYPE_SID:
+			if len(field) < 5 || !strings.EqualFold(field[:4], "SID(") || field[len(field)-1] != ')' {
+				return nil, fmt.Errorf("invalid SID value: %s", field)
+			}
+			value = strings.TrimSpace(field[4 : len(field)-1])
+		case CLAIM_SECURITY_ATTRIBUTE_TYPE_OCTET_STRING:
+			value, err = hex.DecodeString(strings.TrimPrefix(field, "#"))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource attribute value %s: %v", field, err)
+		}
+		claim.Values = append(claim.Values, value)
+	}
+	return claim, nil
+}
+
+// ResourceAttribute returns the attribute of an RA ACE.
+func (ace *Ace) ResourceAttribute() (*Claim, error) {
+	if ace.AceType != SYSTEM_RESOURCE_ATTRIBUTE_ACE_TYPE {
+		return nil, fmt.Errorf("%s ACE has no resource attribute", ace.AceType)
+	}
+	return decodeResourceAttribute(ace.ApplicationData)
+}
+
+// SetResourceAttribute stores the attribute of an RA ACE in ApplicationData.
+func (ace *Ace) SetResourceAttribute(claim *Claim) error {
+	if ace.AceType != SYSTEM_RESOURCE_ATTRIBUTE_ACE_TYPE {
+		return fmt.Errorf("%s ACE has no resource attribute", ace.AceType)
+	}
+	data, err := encodeResourceAttribute(claim)
+	if err != nil {
+		return err
+	}
+	ace.ApplicationData = data
+	return nil
+}
+
+func (ace *Ace) setResourceAttributeSddl(text string) error {
+	claim, err := parseResourceAttribute(text)
+	if err != nil {
+		return err
+	}
+	return ace.SetResourceAttribute(claim)
+}
+
+// ResourceAttributes returns the attributes of the effective RA ACEs in the SACL, which
+// conditional expressions read as @Resource.
+func (sd *SecurityDescriptor) ResourceAttributes() ([]Claim, error) {
+	if sd.SystemAcl == nil {
+		return nil, nil
+	}
+	var claims []Claim
+	for i := range sd.SystemAcl.Aces {
+		ace := &sd.SystemAcl.Aces[i]
+		if ace.AceType != SYSTEM_RESOURCE_ATTRIBUTE_ACE_TYPE || isInheritOnlyAce(ace) {
+			continue
+		}
+		claim, err := ace.ResourceAttribute()
+		if err != nil {
+			return nil, fmt.Errorf("SACL ACE #%d: %v", i, err)
+		}
+		claims = append(claims, *claim)
+	}
+	return claims, nil
+}
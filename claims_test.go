@@ -0,0 +1,72 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseSDDL_ResourceAttributes(t *testing.T) {
+	tests := []struct {
+		sddl  string
+		claim Claim
+	}{
+		{`S:(RA;;;;;WD;("Secrecy",TU,0x0,3))`, Claim{Name: "Secrecy", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_UINT64, Values: []interface{}{uint64(3)}}},
+		{`S:(RA;;;;;WD;("Level",TI,0x0,-1,2))`, Claim{Name: "Level", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_INT64, Values: []interface{}{int64(-1), int64(2)}}},
+		{`S:(RA;CI;;;;WD;("Dept",TS,0x2,"Sales","R,D"))`, Claim{Name: "Dept", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_STRING,
+			Flags: CLAIM_SECURITY_ATTRIBUTE_VALUE_CASE_SENSITIVE, Values: []interface{}{"Sales", "R,D"}}},
+		{`S:(RA;;;;;WD;("Owners",TD,0x0,SID(BA),SID(S-1-5-21-1-2-3-4)))`, Claim{Name: "Owners", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_SID, Values: []interface{}{"BA", "S-1-5-21-1-2-3-4"}}},
+		{`S:(RA;;;;;WD;("Hash",TX,0x0,00ff))`, Claim{Name: "Hash", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_OCTET_STRING, Values: []interface{}{[]byte{0, 0xff}}}},
+		{`S:(RA;;;;;WD;("Flag",TB,0x0,1,0))`, Claim{Name: "Flag", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_BOOLEAN, Values: []interface{}{true, false}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sddl, func(t *testing.T) {
+			sd, err := ParseSDDL(tt.sddl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.sddl, sd.ToSddl())
+			claims, err := sd.ResourceAttributes()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, []Claim{tt.claim}, claims)
+
+			raw, err := sd.ToBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := ParseBinary(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.sddl, parsed.ToSddl())
+		})
+	}
+
+	for _, sddl := range []string{
+		`S:(RA;;;;;WD;(Secrecy,TU,0x0,3))`,
+		`S:(RA;;;;;WD;("Secrecy",TQ,0x0,3))`,
+		`S:(RA;;;;;WD;("Secrecy",TU,0x0,-3))`,
+		`S:(RA;;;;;WD;("Owner",TD,0x0,BA))`,
+	} {
+		_, err := ParseSDDL(sddl)
+		assert.Error(t, err, sddl)
+	}
+}
+
+func TestSecurityDescriptor_Validate_ApplicationData(t *testing.T) {
+	sd, err := ParseSDDL(`D:(XA;;FA;;;WD;(@User.x == 1))S:(RA;;;;;WD;("x",TU,0x0,1))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, sd.Validate())
+
+	sd.DiscretionaryAcl.Aces[0].ApplicationData = []byte("artx\xff\x00\x00\x00")
+	sd.SystemAcl.Aces[0].ApplicationData = []byte{1, 2}
+	findings := sd.Validate()
+	if assert.Len(t, findings, 2) {
+		assert.Equal(t, FindingApplicationData, findings[0].Code)
+		assert.Equal(t, "dacl.aces[0].applicationData", findings[0].Path)
+		assert.Equal(t, "sacl.aces[0].applicationData", findings[1].Path)
+	}
+}
@@ -0,0 +1,659 @@
+package winsddlconverter
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// Tokens of the binary conditional expression format, MS-DTYP 2.4.4.17
+const (
+	condPadding     byte = 0x00
+	condInt8        byte = 0x01
+	condInt16       byte = 0x02
+	condInt32       byte = 0x03
+	condInt64       byte = 0x04
+	condString      byte = 0x10
+	condOctetString byte = 0x18
+	condComposite   byte = 0x50
+	condSid         byte = 0x51
+
+	condEqual                byte = 0x80
+	condNotEqual             byte = 0x81
+	condLess                 byte = 0x82
+	condLessOrEqual          byte = 0x83
+	condGreater              byte = 0x84
+	condGreaterOrEqual       byte = 0x85
+	condContains             byte = 0x86
+	condExists               byte = 0x87
+	condAnyOf                byte = 0x88
+	condMemberOf             byte = 0x89
+	condDeviceMemberOf       byte = 0x8a
+	condMemberOfAny          byte = 0x8b
+	condDeviceMemberOfAny    byte = 0x8c
+	condNotExists            byte = 0x8d
+	condNotContains          byte = 0x8e
+	condNotAnyOf             byte = 0x8f
+	condNotMemberOf          byte = 0x90
+	condNotDeviceMemberOf    byte = 0x91
+	condNotMemberOfAny       byte = 0x92
+	condNotDeviceMemberOfAny byte = 0x93
+	condAnd                  byte = 0xa0
+	condOr                   byte = 0xa1
+	condNot                  byte = 0xa2
+
+	condLocalAttribute    byte = 0xf8
+	condUserAttribute     byte = 0xf9
+	condResourceAttribute byte = 0xfa
+	condDeviceAttribute   byte = 0xfb
+)
+
+// Sign and base of integer literals
+const (
+	condSignPlus    byte = 0x01
+	condSignMinus   byte = 0x02
+	condSignNone    byte = 0x03
+	condBaseOctal   byte = 0x01
+	condBaseDecimal byte = 0x02
+	condBaseHex     byte = 0x03
+)
+
+// conditionSignature starts the application data of conditional ACEs.
+const conditionSignature = "artx"
+
+var conditionOperators = map[byte]string{
+	condEqual:                "==",
+	condNotEqual:             "!=",
+	condLess:                 "<",
+	condLessOrEqual:          "<=",
+	condGreater:              ">",
+	condGreaterOrEqual:       ">=",
+	condContains:             "Contains",
+	condExists:               "Exists",
+	condAnyOf:                "Any_of",
+	condMemberOf:             "Member_of",
+	condDeviceMemberOf:       "Device_Member_of",
+	condMemberOfAny:          "Member_of_Any",
+	condDeviceMemberOfAny:    "Device_Member_of_Any",
+	condNotExists:            "Not_Exists",
+	condNotContains:          "Not_Contains",
+	condNotAnyOf:             "Not_Any_of",
+	condNotMemberOf:          "Not_Member_of",
+	condNotDeviceMemberOf:    "Not_Device_Member_of",
+	condNotMemberOfAny:       "Not_Member_of_Any",
+	condNotDeviceMemberOfAny: "Not_Device_Member_of_Any",
+	condAnd:                  "&&",
+	condOr:                   "||",
+	condNot:                  "!",
+}
+
+var conditionAttributePrefixes = map[byte]string{
+	condLocalAttribute:    "",
+	condUserAttribute:     "@User.",
+	condResourceAttribute: "@Resource.",
+	condDeviceAttribute:   "@Device.",
+}
+
+// condToken is a token of a conditional expression. Expressions are stored in postfix order.
+type condToken struct {
+	code byte
+	// value, sign and base of integers
+	value int64
+	sign  byte
+	base  byte
+	// text of strings, SIDs and attribute names
+	text   string
+	octets []byte
+	// items of composites
+	items []condToken
+}
+
+// conditionArity returns the number of operands of an operator, 0 for operands.
+func conditionArity(code byte) int {
+	switch {
+	case code == condExists || code == condNotExists || code == condNot:
+		return 1
+	case code >= condMemberOf && code <= condDeviceMemberOfAny, code >= condNotMemberOf && code <= condNotDeviceMemberOfAny:
+		return 1
+	case code >= condEqual && code <= condNotAnyOf, code == condAnd, code == condOr:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func isConditionAttribute(code byte) bool {
+	return code >= condLocalAttribute && code <= condDeviceAttribute
+}
+
+func isConditionalData(data []byte) bool {
+	return len(data) >= 4 && string(data[:4]) == conditionSignature
+}
+
+func appendConditionBytes(data []byte, b []byte) []byte {
+	data = binary.LittleEndian.AppendUint32(data, uint32(len(b)))
+	return append(data, b...)
+}
+
+func appendConditionTokens(data []byte, tokens []condToken) ([]byte, error) {
+	for _, t := range tokens {
+		data = append(data, t.code)
+		switch {
+		case t.code >= condInt8 && t.code <= condInt64:
+			data = binary.LittleEndian.AppendUint64(data, uint64(t.value))
+			data = append(data, t.sign, t.base)
+		case t.code == condString || isConditionAttribute(t.code):
+			data = appendConditionBytes(data, utf16Bytes(t.text))
+		case t.code == condOctetString:
+			data = appendConditionBytes(data, t.octets)
+		case t.code == condSid:
+			sid, err := MarshalSidFromString(t.text)
+			if err != nil {
+				return nil, err
+			}
+			data = appendConditionBytes(data, sid)
+		case t.code == condComposite:
+			items, err := appendConditionTokens(nil, t.items)
+			if err != nil {
+				return nil, err
+			}
+			data = appendConditionBytes(data, items)
+		}
+	}
+	return data, nil
+}
+
+// encodeCondition writes an expression as the application data of a conditional ACE.
+func encodeCondition(tokens []condToken) ([]byte, error) {
+	data, err := appendConditionTokens([]byte(conditionSignature), tokens)
+	if err != nil {
+		return nil, err
+	}
+	for len(data)%4 != 0 {
+		data = append(data, condPadding)
+	}
+	return data, nil
+}
+
+func decodeConditionTokens(data []byte) ([]condToken, error) {
+	var tokens []condToken
+	for i := 0; i < len(data); {
+		t := condToken{code: data[i]}
+		i++
+		switch {
+		case t.code == condPadding:
+			continue
+		case t.code >= condInt8 && t.code <= condInt64:
+			if i+10 > len(data) {
+				return nil, fmt.Errorf("truncated integer at %d", i-1)
+			}
+			t.value = int64(binary.LittleEndian.Uint64(data[i:]))
+			t.sign, t.base = data[i+8], data[i+9]
+			i += 10
+		case t.code == condString, t.code == condOctetString, t.code == condSid, t.code == condComposite, isConditionAttribute(t.code):
+			if i+4 > len(data) {
+				return nil, fmt.Errorf("truncated token 0x%x at %d", t.code, i-1)
+			}
+			size := int(binary.LittleEndian.Uint32(data[i:]))
+			i += 4
+			if size < 0 || i+size > len(data) {
+				return nil, fmt.Errorf("token 0x%x at %d exceeds the expression", t.code, i-5)
+			}
+			value := data[i : i+size]
+			i += size
+			var err error
+			switch t.code {
+			case condOctetString:
+				t.octets = append([]byte{}, value...)
+			case condSid:
+				if len(value) < 8 || len(value) != 8+4*int(value[1]) {
+					return nil, fmt.Errorf("invalid SID at %d", i-size)
+				}
+				t.text, err = (&securityDescriptorParser{data: value}).parseSid(0)
+			case condComposite:
+				t.items, err = decodeConditionTokens(value)
+			default:
+				t.text, err = utf16String(value)
+			}
+			if err != nil {
+				return nil, err
+			}
+		case conditionArity(t.code) > 0:
+		default:
+			return nil, fmt.Errorf("unknown token 0x%x at %d", t.code, i-1)
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, nil
+}
+
+// decodeCondition reads the application data of a conditional ACE.
+func decodeCondition(data []byte) ([]condToken, error) {
+	if !isConditionalData(data) {
+		return nil, fmt.Errorf("application data is not a conditional expression")
+	}
+	return decodeConditionTokens(data[len(conditionSignature):])
+}
+
+func isAttributeNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == ':' || c == '.' || c == '/' || c == '_'
+}
+
+// formatAttributeName escapes the characters SDDL does not allow in names as %xxxx.
+func formatAttributeName(name string) string {
+	var builder strings.Builder
+	for _, u := range utf16.Encode([]rune(name)) {
+		if u < 0x80 && isAttributeNameChar(byte(u)) {
+			builder.WriteByte(byte(u))
+		} else {
+			fmt.Fprintf(&builder, "%%%04x", u)
+		}
+	}
+	return builder.String()
+}
+
+func formatConditionOperand(t condToken) string {
+	switch {
+	case t.code >= condInt8 && t.code <= condInt64:
+		var sign string
+		magnitude := uint64(t.value)
+		if t.value < 0 {
+			sign = "-"
+			magnitude = -magnitude
+		} else if t.sign == condSignPlus {
+			sign = "+"
+		}
+		switch t.base {
+		case condBaseOctal:
+			if magnitude == 0 {
+				return sign + "0"
+			}
+			return sign + "0" + strconv.FormatUint(magnitude, 8)
+		case condBaseHex:
+			return sign + "0x" + strconv.FormatUint(magnitude, 16)
+		default:
+			return sign + strconv.FormatUint(magnitude, 10)
+		}
+	case t.code == condString:
+		return `"` + t.text + `"`
+	case t.code == condOctetString:
+		return "#" + hex.EncodeToString(t.octets)
+	case t.code == condSid:
+		return "SID(" + t.text + ")"
+	case t.code == condComposite:
+		items := make([]string, len(t.items))
+		for i, item := range t.items {
+			items[i] = formatConditionOperand(item)
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	default:
+		return conditionAttributePrefixes[t.code] + formatAttributeName(t.text)
+	}
+}
+
+// formatCondition writes an expression in SDDL, each operation in parentheses.
+func formatCondition(tokens []condToken) (string, error) {
+	var stack []string
+	for _, t := range tokens {
+		arity := conditionArity(t.code)
+		if len(stack) < arity {
+			return "", fmt.Errorf("operator %s without operand", conditionOperators[t.code])
+		}
+		operands := stack[len(stack)-arity:]
+		stack = stack[:len(stack)-arity]
+		switch {
+		case arity == 0:
+			stack = append(stack, formatConditionOperand(t))
+		case t.code == condNot:
+			stack = append(stack, "(!"+operands[0]+")")
+		case arity == 1:
+			stack = append(stack, "("+conditionOperators[t.code]+" "+operands[0]+")")
+		default:
+			stack = append(stack, "("+operands[0]+" "+conditionOperators[t.code]+" "+operands[1]+")")
+		}
+	}
+	if len(stack) != 1 {
+		return "", fmt.Errorf("expression has %d results", len(stack))
+	}
+	if !strings.HasPrefix(stack[0], "(") {
+		return "(" + stack[0] + ")", nil
+	}
+	return stack[0], nil
+}
+
+// conditionParser reads the SDDL of a conditional expression into postfix tokens.
+// && binds tighter than ||, and ! tighter than both.
+type conditionParser struct {
+	s      string
+	pos    int
+	tokens []condToken
+}
+
+func parseCondition(text string) ([]condToken, error) {
+	p := &conditionParser{s: text}
+	err := p.parseOr()
+	if err == nil {
+		p.skipSpace()
+		if p.pos < len(p.s) {
+			err = fmt.Errorf("unexpected %q at %d", p.s[p.pos:], p.pos)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid condition %s: %v", text, err)
+	}
+	return p.tokens, nil
+}
+
+func (p *conditionParser) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\r' || p.s[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+func (p *conditionParser) consume(text string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], text) {
+		p.pos += len(text)
+		return true
+	}
+	return false
+}
+
+// word returns the keyword at the current position without consuming it.
+func (p *conditionParser) word() string {
+	p.skipSpace()
+	end := p.pos
+	for end < len(p.s) && isAttributeNameChar(p.s[end]) {
+		end++
+	}
+	return p.s[p.pos:end]
+}
+
+func (p *conditionParser) keyword() (byte, bool) {
+	word := p.word()
+	for code, name := range conditionOperators {
+		if strings.EqualFold(word, name) {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+func (p *conditionParser) emit(t condToken) {
+	p.tokens = append(p.tokens, t)
+}
+
+func (p *conditionParser) parseOr() error {
+	if err := p.parseAnd(); err != nil {
+		return err
+	}
+	for p.consume("||") {
+		if err := p.parseAnd(); err != nil {
+			return err
+		}
+		p.emit(condToken{code: condOr})
+	}
+	return nil
+}
+
+func (p *conditionParser) parseAnd() error {
+	if err := p.parseUnary(); err != nil {
+		return err
+	}
+	for p.consume("&&") {
+		if err := p.parseUnary(); err != nil {
+			return err
+		}
+		p.emit(condToken{code: condAnd})
+	}
+	return nil
+}
+
+func (p *conditionParser) parseUnary() error {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], "!") && !strings.HasPrefix(p.s[p.pos:], "!=") {
+		p.pos++
+		if err := p.parseUnary(); err != nil {
+			return err
+		}
+		p.emit(condToken{code: condNot})
+		return nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *conditionParser) parsePrimary() error {
+	if p.consume("(") {
+		if err := p.parseOr(); err != nil {
+			return err
+		}
+		if !p.consume(")") {
+			return fmt.Errorf("missing ) at %d", p.pos)
+		}
+		return nil
+	}
+
+	if code, ok := p.keyword(); ok && conditionArity(code) == 1 {
+		p.pos += len(p.word())
+		var err error
+		if code == condExists || code == condNotExists {
+			err = p.parseAttribute()
+		} else {
+			err = p.parseOperand()
+		}
+		if err != nil {
+			return err
+		}
+		p.emit(condToken{code: code})
+		return nil
+	}
+
+	if err := p.parseAttribute(); err != nil {
+		return err
+	}
+	code, ok := p.keyword()
+	if ok && conditionArity(code) == 2 && code != condAnd && code != condOr {
+		p.pos += len(p.word())
+	} else {
+		ok = false
+		for _, op := range []byte{condEqual, condNotEqual, condLessOrEqual, condGreaterOrEqual, condLess, condGreater} {
+			if p.consume(conditionOperators[op]) {
+				code, ok = op, true
+				break
+			}
+		}
+	}
+	if !ok {
+		// an attribute alone is true if it is a non-zero integer or boolean
+		return nil
+	}
+	if err := p.parseOperand(); err != nil {
+		return err
+	}
+	p.emit(condToken{code: code})
+	return nil
+}
+
+func (p *conditionParser) parseAttribute() error {
+	p.skipSpace()
+	code := condLocalAttribute
+	for _, prefixed := range []byte{condUserAttribute, condDeviceAttribute, condResourceAttribute} {
+		prefix := conditionAttributePrefixes[prefixed]
+		if len(p.s)-p.pos >= len(prefix) && strings.EqualFold(p.s[p.pos:p.pos+len(prefix)], prefix) {
+			code = prefixed
+			p.pos += len(prefix)
+			break
+		}
+	}
+	var units []uint16
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if c == '%' && p.pos+5 <= len(p.s) {
+			u, err := strconv.ParseUint(p.s[p.pos+1:p.pos+5], 16, 16)
+			if err != nil {
+				return fmt.Errorf("invalid escape %q at %d", p.s[p.pos:p.pos+5], p.pos)
+			}
+			units = append(units, uint16(u))
+			p.pos += 5
+			continue
+		}
+		if !isAttributeNameChar(c) {
+			break
+		}
+		units = append(units, uint16(c))
+		p.pos++
+	}
+	if len(units) == 0 {
+		return fmt.Errorf("expected an attribute at %d", p.pos)
+	}
+	p.emit(condToken{code: code, text: string(utf16.Decode(units))})
+	return nil
+}
+
+// parseOperand reads an attribute, a literal or a composite of literals.
+func (p *conditionParser) parseOperand() error {
+	p.skipSpace()
+	if p.consume("{") {
+		composite := condToken{code: condComposite, items: []condToken{}}
+		if !p.consume("}") {
+			for {
+				item, err := p.parseLiteral()
+				if err != nil {
+					return err
+				}
+				composite.items = append(composite.items, item)
+				if p.consume("}") {
+					break
+				}
+				if !p.consume(",") {
+					return fmt.Errorf("expected , or } at %d", p.pos)
+				}
+			}
+		}
+		p.emit(composite)
+		return nil
+	}
+	if p.pos < len(p.s) && (p.s[p.pos] == '@' || isAttributeNameChar(p.s[p.pos]) && !(p.s[p.pos] >= '0' && p.s[p.pos] <= '9')) &&
+		!strings.EqualFold(p.word(), "SID") {
+		return p.parseAttribute()
+	}
+	literal, err := p.parseLiteral()
+	if err != nil {
+		return err
+	}
+	p.emit(literal)
+	return nil
+}
+
+func (p *conditionParser) parseLiteral() (condToken, error) {
+	p.skipSpace()
+	rest := p.s[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, `"`):
+		end := strings.IndexByte(rest[1:], '"')
+		if end < 0 {
+			return condToken{}, fmt.Errorf("unterminated string at %d", p.pos)
+		}
+		p.pos += end + 2
+		return condToken{code: condString, text: rest[1 : end+1]}, nil
+	case strings.HasPrefix(rest, "#"):
+		end := 1
+		for end < len(rest) && strings.IndexByte("0123456789abcdefABCDEF", rest[end]) >= 0 {
+			end++
+		}
+		octets, err := hex.DecodeString(rest[1:end])
+		if err != nil {
+			return condToken{}, fmt.Errorf("invalid octet string at %d: %v", p.pos, err)
+		}
+		p.pos += end
+		return condToken{code: condOctetString, octets: octets}, nil
+	case len(rest) >= 4 && strings.EqualFold(rest[:4], "SID("):
+		end := strings.IndexByte(rest, ')')
+		if end < 0 {
+			return condToken{}, fmt.Errorf("unterminated SID at %d", p.pos)
+		}
+		sid := strings.TrimSpace(rest[4:end])
+		if len(sid) == 2 {
+			sid = strings.ToUpper(sid)
+		}
+		if _, err := MarshalSidFromString(sid); err != nil {
+			return condToken{}, fmt.Errorf("invalid SID at %d: %v", p.pos, err)
+		}
+		p.pos += end + 1
+		return condToken{code: condSid, text: sid}, nil
+	}
+
+	t := condToken{code: condInt64, sign: condSignNone, base: condBaseDecimal}
+	end := 0
+	if strings.HasPrefix(rest, "+") || strings.HasPrefix(rest, "-") {
+		t.sign = condSignPlus
+		if rest[0] == '-' {
+			t.sign = condSignMinus
+		}
+		end++
+	}
+	digits := "0123456789"
+	radix := 10
+	if strings.HasPrefix(strings.ToLower(rest[end:]), "0x") {
+		t.base, digits, radix = condBaseHex, "0123456789abcdefABCDEF", 16
+		end += 2
+	} else if len(rest) > end+1 && rest[end] == '0' && rest[end+1] >= '0' && rest[end+1] <= '9' {
+		t.base, radix = condBaseOctal, 8
+	}
+	start := end
+	for end < len(rest) && strings.IndexByte(digits, rest[end]) >= 0 {
+		end++
+	}
+	if start == end {
+		return condToken{}, fmt.Errorf("expected a value at %d", p.pos)
+	}
+	magnitude, err := strconv.ParseUint(rest[start:end], radix, 64)
+	if err == nil && magnitude > 1<<63 || magnitude == 1<<63 && t.sign != condSignMinus {
+		err = fmt.Errorf("integer out of range")
+	}
+	if err != nil {
+		return condToken{}, fmt.Errorf("invalid integer at %d: %v", p.pos, err)
+	}
+	t.value = int64(magnitude)
+	if t.sign == condSignMinus {
+		t.value = -t.value
+	}
+	p.pos += end
+	return t, nil
+}
+
+// IsConditional reports whether the ACE is a callback ACE with a conditional expression.
+func (ace *Ace) IsConditional() bool {
+	return ace.AceType.IsCallback() && isConditionalData(ace.ApplicationData)
+}
+
+// Condition returns the conditional expression of a callback ACE in SDDL.
+func (ace *Ace) Condition() (string, error) {
+	tokens, err := decodeCondition(ace.ApplicationData)
+	if err != nil {
+		return "", err
+	}
+	return formatCondition(tokens)
+}
+
+// SetCondition stores a conditional expression in SDDL, such as (@User.Department == "Sales"),
+// in the ApplicationData of a callback ACE.
+func (ace *Ace) SetCondition(condition string) error {
+	if !ace.AceType.IsCallback() {
+		return fmt.Errorf("%s ACE cannot have a condition", ace.AceType)
+	}
+	tokens, err := parseCondition(condition)
+	if err != nil {
+		return err
+	}
+	data, err := encodeCondition(tokens)
+	if err != nil {
+		return err
+	}
+	ace.ApplicationData = data
+	return nil
+}
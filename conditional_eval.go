@@ -0,0 +1,441 @@
+package winsddlconverter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// ConditionResult is the three-valued result of a conditional expression, MS-DTYP 2.4.4.17.
+type ConditionResult uint8
+
+const (
+	ConditionFalse ConditionResult = iota
+	ConditionTrue
+	// ConditionUnknown results from missing attributes and values of the wrong type
+	ConditionUnknown
+)
+
+func (r ConditionResult) String() string {
+	switch r {
+	case ConditionFalse:
+		return "FALSE"
+	case ConditionTrue:
+		return "TRUE"
+	case ConditionUnknown:
+		return "UNKNOWN"
+	default:
+		return "?"
+	}
+}
+
+func (r ConditionResult) not() ConditionResult {
+	switch r {
+	case ConditionTrue:
+		return ConditionFalse
+	case ConditionFalse:
+		return ConditionTrue
+	default:
+		return ConditionUnknown
+	}
+}
+
+func conditionResult(b bool) ConditionResult {
+	if b {
+		return ConditionTrue
+	}
+	return ConditionFalse
+}
+
+// conditionContext holds what a conditional expression reads.
+type conditionContext struct {
+	sids       tokenSids
+	deviceSids tokenSids
+	user       []Claim
+	device     []Claim
+	resource   []Claim
+	// deny evaluates for a deny ACE, where deny-only groups and claims apply
+	deny bool
+}
+
+func newConditionContext(token *Token, sids tokenSids, resource []Claim) *conditionContext {
+	return &conditionContext{
+		sids:       sids,
+		deviceSids: newTokenSids("", token.DeviceGroups),
+		user:       token.UserClaims,
+		device:     token.DeviceClaims,
+		resource:   resource,
+	}
+}
+
+// conditionOperand is an entry of the evaluation stack, a logical result or a set of values.
+type conditionOperand struct {
+	logical bool
+	result  ConditionResult
+
+	attribute bool
+	// null is an attribute the context does not have
+	null          bool
+	values        []interface{}
+	caseSensitive bool
+}
+
+func literalValue(t condToken) (interface{}, error) {
+	switch {
+	case t.code >= condInt8 && t.code <= condInt64:
+		return t.value, nil
+	case t.code == condString:
+		return t.text, nil
+	case t.code == condOctetString:
+		return t.octets, nil
+	case t.code == condSid:
+		return sidValue(GetRawSid(t.text)), nil
+	default:
+		return nil, fmt.Errorf("token 0x%x is not a literal", t.code)
+	}
+}
+
+func (c *conditionContext) operand(t condToken) (conditionOperand, error) {
+	if isConditionAttribute(t.code) {
+		return c.attribute(t.code, t.text)
+	}
+	if t.code == condComposite {
+		operand := conditionOperand{values: []interface{}{}}
+		for _, item := range t.items {
+			value, err := literalValue(item)
+			if err != nil {
+				return operand, err
+			}
+			operand.values = append(operand.values, value)
+		}
+		return operand, nil
+	}
+	value, err := literalValue(t)
+	return conditionOperand{values: []interface{}{value}}, err
+}
+
+// attribute looks up a claim. Local attributes are supplied by applications, so they never exist here.
+func (c *conditionContext) attribute(code byte, name string) (conditionOperand, error) {
+	var claims []Claim
+	switch code {
+	case condUserAttribute:
+		claims = c.user
+	case condDeviceAttribute:
+		claims = c.device
+	case condResourceAttribute:
+		claims = c.resource
+	}
+	for i := range claims {
+		claim := &claims[i]
+		if !strings.EqualFold(claim.Name, name) || claim.Flags&CLAIM_SECURITY_ATTRIBUTE_DISABLED != 0 ||
+			claim.Flags&CLAIM_SECURITY_ATTRIBUTE_USE_FOR_DENY_ONLY != 0 && !c.deny {
+			continue
+		}
+		values, err := claim.values()
+		if err != nil {
+			return conditionOperand{}, err
+		}
+		return conditionOperand{
+			attribute:     true,
+			null:          len(values) == 0,
+			values:        values,
+			caseSensitive: claim.Flags&CLAIM_SECURITY_ATTRIBUTE_VALUE_CASE_SENSITIVE != 0,
+		}, nil
+	}
+	return conditionOperand{attribute: true, null: true}, nil
+}
+
+// truth returns the truth of an operand. A single integer or boolean value is true if
+// it is not zero, other values are unknown.
+func (o conditionOperand) truth() ConditionResult {
+	if o.logical {
+		return o.result
+	}
+	if o.null || len(o.values) != 1 {
+		return ConditionUnknown
+	}
+	switch v := o.values[0].(type) {
+	case int64:
+		return conditionResult(v != 0)
+	case uint64:
+		return conditionResult(v != 0)
+	case bool:
+		return conditionResult(v)
+	default:
+		return ConditionUnknown
+	}
+}
+
+// numeric returns the sign and magnitude of integer and boolean values.
+func numeric(v interface{}) (bool, uint64, bool) {
+	switch x := v.(type) {
+	case int64:
+		if x < 0 {
+			return true, -uint64(x), true
+		}
+		return false, uint64(x), true
+	case uint64:
+		return false, x, true
+	case bool:
+		if x {
+			return false, 1, true
+		}
+		return false, 0, true
+	default:
+		return false, 0, false
+	}
+}
+
+// compareConditionValues orders two values of the same kind. Strings compare without case
+// unless caseSensitive. It returns false for values of different kinds.
+func compareConditionValues(a interface{}, b interface{}, caseSensitive bool) (int, bool) {
+	if aNegative, aMagnitude, ok := numeric(a); ok {
+		bNegative, bMagnitude, ok := numeric(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case aNegative != bNegative:
+			if aNegative {
+				return -1, true
+			}
+			return 1, true
+		case aMagnitude == bMagnitude:
+			return 0, true
+		case (aMagnitude < bMagnitude) != aNegative:
+			return -1, true
+		default:
+			return 1, true
+		}
+	}
+	switch x := a.(type) {
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		if !caseSensitive {
+			x, y = strings.ToLower(x), strings.ToLower(y)
+		}
+		return strings.Compare(x, y), true
+	case sidValue:
+		y, ok := b.(sidValue)
+		return strings.Compare(strings.ToUpper(string(x)), strings.ToUpper(string(y))), ok
+	case []byte:
+		y, ok := b.([]byte)
+		return bytes.Compare(x, y), ok
+	default:
+		return 0, false
+	}
+}
+
+// containsValue reports whether set has v, false if they cannot be compared.
+func containsValue(set []interface{}, v interface{}, caseSensitive bool) (bool, bool) {
+	found := false
+	for _, item := range set {
+		cmp, ok := compareConditionValues(item, v, caseSensitive)
+		if !ok {
+			return false, false
+		}
+		found = found || cmp == 0
+	}
+	return found, true
+}
+
+// countContained returns how many values of b are in a, false if they cannot be compared.
+func countContained(a []interface{}, b []interface{}, caseSensitive bool) (int, bool) {
+	count := 0
+	for _, v := range b {
+		found, ok := containsValue(a, v, caseSensitive)
+		if !ok {
+			return 0, false
+		}
+		if found {
+			count++
+		}
+	}
+	return count, true
+}
+
+func (c *conditionContext) relational(code byte, l conditionOperand, r conditionOperand) (ConditionResult, error) {
+	if l.logical || r.logical {
+		return ConditionUnknown, fmt.Errorf("%s needs values, not a logical result", conditionOperators[code])
+	}
+	if l.null || r.null {
+		return ConditionUnknown, nil
+	}
+	caseSensitive := l.caseSensitive || r.caseSensitive
+	negate := false
+	var result bool
+	switch code {
+	case condEqual, condNotEqual:
+		// sets are equal if each has the values of the other
+		inRight, ok := countContained(r.values, l.values, caseSensitive)
+		inLeft, ok2 := countContained(l.values, r.values, caseSensitive)
+		if !ok || !ok2 {
+			return ConditionUnknown, nil
+		}
+		result = inRight == len(l.values) && inLeft == len(r.values)
+		negate = code == condNotEqual
+	case condLess, condLessOrEqual, condGreater, condGreaterOrEqual:
+		if len(l.values) != 1 || len(r.values) != 1 {
+			return ConditionUnknown, nil
+		}
+		cmp, ok := compareConditionValues(l.values[0], r.values[0], caseSensitive)
+		if !ok {
+			return ConditionUnknown, nil
+		}
+		switch code {
+		case condLess:
+			result = cmp < 0
+		case condLessOrEqual:
+			result = cmp <= 0
+		case condGreater:
+			result = cmp > 0
+		default:
+			result = cmp >= 0
+		}
+	case condContains, condNotContains:
+		// the left set has all values of the right
+		count, ok := countContained(l.values, r.values, caseSensitive)
+		if !ok {
+			return ConditionUnknown, nil
+		}
+		result = count == len(r.values)
+		negate = code == condNotContains
+	case condAnyOf, condNotAnyOf:
+		// a value of the left set is in the right
+		count, ok := countContained(r.values, l.values, caseSensitive)
+		if !ok {
+			return ConditionUnknown, nil
+		}
+		result = count > 0
+		negate = code == condNotAnyOf
+	}
+	if negate {
+		return conditionResult(result).not(), nil
+	}
+	return conditionResult(result), nil
+}
+
+// memberOf evaluates Member_of and its variants, which test the token or device groups
+// for all or any of a set of SIDs.
+func (c *conditionContext) memberOf(code byte, o conditionOperand) (ConditionResult, error) {
+	if o.logical {
+		return ConditionUnknown, fmt.Errorf("%s needs SIDs, not a logical result", conditionOperators[code])
+	}
+	if o.null || len(o.values) == 0 {
+		return ConditionUnknown, nil
+	}
+	sids := c.sids
+	switch code {
+	case condDeviceMemberOf, condDeviceMemberOfAny, condNotDeviceMemberOf, condNotDeviceMemberOfAny:
+		sids = c.deviceSids
+	}
+	matched := 0
+	for _, v := range o.values {
+		sid, ok := v.(sidValue)
+		if !ok {
+			return ConditionUnknown, nil
+		}
+		if sids.contains(string(sid), c.deny) {
+			matched++
+		}
+	}
+	switch code {
+	case condMemberOf, condDeviceMemberOf:
+		return conditionResult(matched == len(o.values)), nil
+	case condMemberOfAny, condDeviceMemberOfAny:
+		return conditionResult(matched > 0), nil
+	case condNotMemberOf, condNotDeviceMemberOf:
+		return conditionResult(matched != len(o.values)), nil
+	default:
+		return conditionResult(matched == 0), nil
+	}
+}
+
+func (c *conditionContext) unary(code byte, o conditionOperand) (ConditionResult, error) {
+	switch code {
+	case condNot:
+		return o.truth().not(), nil
+	case condExists, condNotExists:
+		if !o.attribute {
+			return ConditionUnknown, fmt.Errorf("%s needs an attribute", conditionOperators[code])
+		}
+		return conditionResult(o.null == (code == condNotExists)), nil
+	default:
+		return c.memberOf(code, o)
+	}
+}
+
+func (c *conditionContext) binary(code byte, l conditionOperand, r conditionOperand) (ConditionResult, error) {
+	switch code {
+	case condAnd:
+		a, b := l.truth(), r.truth()
+		if a == ConditionFalse || b == ConditionFalse {
+			return ConditionFalse, nil
+		}
+		if a == ConditionTrue && b == ConditionTrue {
+			return ConditionTrue, nil
+		}
+		return ConditionUnknown, nil
+	case condOr:
+		a, b := l.truth(), r.truth()
+		if a == ConditionTrue || b == ConditionTrue {
+			return ConditionTrue, nil
+		}
+		if a == ConditionFalse && b == ConditionFalse {
+			return ConditionFalse, nil
+		}
+		return ConditionUnknown, nil
+	default:
+		return c.relational(code, l, r)
+	}
+}
+
+// evaluate runs a postfix expression.
+func (c *conditionContext) evaluate(tokens []condToken) (ConditionResult, error) {
+	var stack []conditionOperand
+	for _, t := range tokens {
+		arity := conditionArity(t.code)
+		if len(stack) < arity {
+			return ConditionUnknown, fmt.Errorf("operator %s without operand", conditionOperators[t.code])
+		}
+		operands := stack[len(stack)-arity:]
+		stack = stack[:len(stack)-arity]
+
+		var operand conditionOperand
+		var err error
+		switch arity {
+		case 0:
+			operand, err = c.operand(t)
+		case 1:
+			operand.logical = true
+			operand.result, err = c.unary(t.code, operands[0])
+		default:
+			operand.logical = true
+			operand.result, err = c.binary(t.code, operands[0], operands[1])
+		}
+		if err != nil {
+			return ConditionUnknown, err
+		}
+		stack = append(stack, operand)
+	}
+	if len(stack) != 1 {
+		return ConditionUnknown, fmt.Errorf("expression has %d results", len(stack))
+	}
+	return stack[0].truth(), nil
+}
+
+// EvaluateCondition evaluates a conditional expression in SDDL for the token with the
+// three-valued logic of MS-DTYP. Member_of tests the user and groups and Device_Member_of
+// the device groups, @User. and @Device. read the claims of the token and @Resource.
+// reads resource, see SecurityDescriptor.ResourceAttributes. A comparison with a missing
+// attribute or a value of another type is UNKNOWN.
+func (t *Token) EvaluateCondition(condition string, resource []Claim) (ConditionResult, error) {
+	tokens, err := parseCondition(condition)
+	if err != nil {
+		return ConditionUnknown, err
+	}
+	return newConditionContext(t, newTokenSids(t.User, t.Groups), resource).evaluate(tokens)
+}
@@ -0,0 +1,212 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAce_SetCondition(t *testing.T) {
+	ace := &Ace{AceType: ACCESS_ALLOWED_CALLBACK_ACE_TYPE, AccessMask: FILE_ALL_ACCESS, Sid: "WD"}
+	if err := ace.SetCondition(`(@User.Title == "PM")`); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []byte{
+		'a', 'r', 't', 'x',
+		0xf9, 0x0a, 0, 0, 0, 'T', 0, 'i', 0, 't', 0, 'l', 0, 'e', 0,
+		0x10, 0x04, 0, 0, 0, 'P', 0, 'M', 0,
+		0x80,
+		0, 0, 0,
+	}, ace.ApplicationData)
+	assert.True(t, ace.IsConditional())
+
+	assert.Error(t, (&Ace{AceType: ACCESS_ALLOWED_ACE_TYPE}).SetCondition(`(@User.Title == "PM")`))
+	for _, condition := range []string{
+		`(@User.Title == )`,
+		`(@User.Title == "PM"`,
+		`(Member_of {SID(XX)})`,
+		`(Exists "x")`,
+		`(@User.Title == "PM") extra`,
+	} {
+		assert.Error(t, ace.SetCondition(condition), condition)
+	}
+}
+
+func TestParseSDDL_ConditionalAces(t *testing.T) {
+	tests := []struct {
+		name string
+		sddl string
+		want string
+	}{
+		{
+			"operators get parentheses",
+			`D:(XA;;FA;;;WD;(@User.Title == "PM" && (Member_of {SID(BA), SID(S-1-5-21-1-2-3-500)} || !(@Device.Managed))))`,
+			`D:(XA;;FA;;;WD;((@User.Title == "PM") && ((Member_of {SID(BA), SID(S-1-5-21-1-2-3-500)}) || (!@Device.Managed))))`,
+		},
+		{
+			"and binds tighter than or",
+			`D:(XD;;FA;;;WD;(@User.a == 1 || @User.b == 2 && @User.c == 3))`,
+			`D:(XD;;FA;;;WD;((@User.a == 1) || ((@User.b == 2) && (@User.c == 3))))`,
+		},
+		{
+			"literals",
+			`D:(XA;;FA;;;WD;(Title Any_of {"a", -5, +7, 010, 0x1f, #0aff}))`,
+			`D:(XA;;FA;;;WD;(Title Any_of {"a", -5, +7, 010, 0x1f, #0aff}))`,
+		},
+		{
+			"keywords ignore case",
+			`D:(XA;;FA;;;WD;(not_exists @user.x))`,
+			`D:(XA;;FA;;;WD;(Not_Exists @User.x))`,
+		},
+		{
+			"escaped attribute names",
+			`D:(XA;;FA;;;WD;(@Resource.Project%0020Name Contains "a;b)"))`,
+			`D:(XA;;FA;;;WD;(@Resource.Project%0020Name Contains "a;b)"))`,
+		},
+		{
+			"object and audit callback aces",
+			`D:(ZA;;CR;ab721a53-1e2f-11d0-9819-00aa0040529b;;AU;(@User.clearance >= 2))S:(XU;SA;FA;;;WD;(@Resource.Secret))`,
+			`D:(ZA;;0x100;ab721a53-1e2f-11d0-9819-00aa0040529b;;AU;(@User.clearance >= 2))S:(XU;SA;FA;;;WD;(@Resource.Secret))`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := ParseSDDL(tt.sddl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, sd.ToSddl())
+
+			raw, err := sd.ToBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := ParseBinary(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, parsed.ToSddl())
+			assert.Empty(t, parsed.Validate())
+		})
+	}
+
+	_, err := ParseSDDLWithOptions("D:(A;;FA;;;WD;(@User.x))", StrictParseOptions())
+	assert.Error(t, err)
+	_, err = ParseSDDL(`D:(XA;;FA;;;WD;(@User.x == "a)`)
+	assert.Error(t, err)
+}
+
+func TestToken_EvaluateCondition(t *testing.T) {
+	token := &Token{
+		User:   "S-1-5-21-1-2-3-1001",
+		Groups: []TokenGroup{{Sid: "BU", Attributes: SE_GROUP_ENABLED}, {Sid: "BA", Attributes: SE_GROUP_USE_FOR_DENY_ONLY}},
+		UserClaims: []Claim{
+			{Name: "Title", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_STRING, Values: []interface{}{"PM"}},
+			{Name: "Projects", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_STRING, Values: []interface{}{"Alpha", "Beta"}},
+			{Name: "Clearance", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_INT64, Values: []interface{}{float64(3)}},
+			{Name: "Code", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_STRING, Flags: CLAIM_SECURITY_ATTRIBUTE_VALUE_CASE_SENSITIVE, Values: []interface{}{"Ab"}},
+			{Name: "Old", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_STRING, Flags: CLAIM_SECURITY_ATTRIBUTE_DISABLED, Values: []interface{}{"x"}},
+		},
+		DeviceClaims: []Claim{{Name: "Managed", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_BOOLEAN, Values: []interface{}{true}}},
+		DeviceGroups: []TokenGroup{{Sid: "S-1-5-21-1-2-3-515", Attributes: SE_GROUP_ENABLED}},
+	}
+	resource := []Claim{{Name: "Secrecy", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_UINT64, Values: []interface{}{uint64(2)}}}
+
+	tests := []struct {
+		condition string
+		want      ConditionResult
+	}{
+		{`(@User.Title == "pm")`, ConditionTrue},
+		{`(@User.Title != "PM")`, ConditionFalse},
+		{`(@User.Code == "ab")`, ConditionFalse},
+		{`(@User.Projects == {"beta", "alpha"})`, ConditionTrue},
+		{`(@User.Projects == "Alpha")`, ConditionFalse},
+		{`(@User.Projects Contains "Alpha")`, ConditionTrue},
+		{`(@User.Projects Contains {"Alpha", "Gamma"})`, ConditionFalse},
+		{`(@User.Projects Any_of {"Alpha", "Gamma"})`, ConditionTrue},
+		{`(@User.Projects Not_Any_of {"Gamma"})`, ConditionTrue},
+		{`(@User.Clearance >= @Resource.Secrecy)`, ConditionTrue},
+		{`(@User.Clearance < -1)`, ConditionFalse},
+		{`(@User.Clearance == "3")`, ConditionUnknown},
+		{`(@User.Missing == "x")`, ConditionUnknown},
+		{`(@User.Old == "x")`, ConditionUnknown},
+		{`(!(@User.Missing == "x"))`, ConditionUnknown},
+		{`(@User.Missing == "x" || @User.Title == "PM")`, ConditionTrue},
+		{`(@User.Missing == "x" && @User.Title == "PM")`, ConditionUnknown},
+		{`(@User.Missing == "x" && @User.Title == "QA")`, ConditionFalse},
+		{`(Exists @User.Missing)`, ConditionFalse},
+		{`(Not_Exists @User.Missing)`, ConditionTrue},
+		{`(@Device.Managed)`, ConditionTrue},
+		{`(@User.Title)`, ConditionUnknown},
+		{`(Member_of {SID(BU), SID(S-1-5-21-1-2-3-1001)})`, ConditionTrue},
+		{`(Member_of {SID(BU), SID(BA)})`, ConditionFalse},
+		{`(Member_of_Any {SID(BU), SID(BA)})`, ConditionTrue},
+		{`(Not_Member_of {SID(BA)})`, ConditionTrue},
+		{`(Member_of @User.Title)`, ConditionUnknown},
+		{`(Device_Member_of {SID(S-1-5-21-1-2-3-515)})`, ConditionTrue},
+		{`(Not_Device_Member_of_Any {SID(BU)})`, ConditionTrue},
+		{`(Title == "PM")`, ConditionUnknown},
+	}
+	for _, tt := range tests {
+		got, err := token.EvaluateCondition(tt.condition, resource)
+		if assert.NoError(t, err, tt.condition) {
+			assert.Equal(t, tt.want, got, tt.condition)
+		}
+	}
+}
+
+func TestSecurityDescriptor_AccessCheck_Conditional(t *testing.T) {
+	const user = "S-1-5-21-1-2-3-1001"
+	token := &Token{User: user, Groups: []TokenGroup{{Sid: "WD", Attributes: SE_GROUP_ENABLED}},
+		UserClaims: []Claim{
+			{Name: "Department", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_STRING, Values: []interface{}{"Finance"}},
+			{Name: "Clearance", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_UINT64, Values: []interface{}{uint64(2)}},
+		}}
+	const sacl = `S:(RA;;;;;WD;("Department",TS,0x0,"Finance"))(RA;;;;;WD;("Secrecy",TU,0x0,3))`
+
+	tests := []struct {
+		name    string
+		sddl    string
+		granted AccessMask
+	}{
+		{"matching department", `O:BAG:SYD:(XA;;FA;;;WD;(@User.Department == @Resource.Department))` + sacl, FILE_ALL_ACCESS},
+		{"false condition", `O:BAG:SYD:(XA;;FA;;;WD;(@User.Clearance >= @Resource.Secrecy))` + sacl, 0},
+		{"unknown condition does not allow", `O:BAG:SYD:(XA;;FA;;;WD;(@User.Project == "X"))` + sacl, 0},
+		{"true deny", `O:BAG:SYD:(XD;;0x100002;;;WD;(@User.Clearance < @Resource.Secrecy))(A;;FA;;;WD)` + sacl, FILE_ALL_ACCESS &^ 0x100002},
+		{"unknown deny applies", `O:BAG:SYD:(XD;;0x100002;;;WD;(@User.Project == "X"))(A;;FA;;;WD)` + sacl, FILE_ALL_ACCESS &^ 0x100002},
+		{"false deny", `O:BAG:SYD:(XD;;0x100002;;;WD;(@User.Department != "Finance"))(A;;FA;;;WD)` + sacl, FILE_ALL_ACCESS},
+		{"missing resource attribute", `O:BAG:SYD:(XA;;FA;;;WD;(@User.Department == @Resource.Department))`, 0},
+		{"inherit-only attribute", `O:BAG:SYD:(XA;;FA;;;WD;(Exists @Resource.Secrecy))S:(RA;IO;;;;WD;("Secrecy",TU,0x0,3))`, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := ParseSDDL(tt.sddl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := sd.AccessCheck(token, MAXIMUM_ALLOWED, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.granted, result.GrantedAccess)
+		})
+	}
+}
+
+func TestSecurityDescriptor_AccessCheck_ConditionalTrace(t *testing.T) {
+	sd, err := ParseSDDL(`O:BAG:SYD:(XA;;FA;;;WD;(@User.Title == "PM"))(XA;;FR;;;WD;(Exists @User.Title))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &Token{User: "S-1-5-21-1-2-3-1001", Groups: []TokenGroup{{Sid: "WD", Attributes: SE_GROUP_ENABLED}},
+		UserClaims: []Claim{{Name: "Title", Type: CLAIM_SECURITY_ATTRIBUTE_TYPE_STRING, Values: []interface{}{"QA"}}}}
+	result, err := sd.AccessCheck(token, FILE_READ_DATA, &AccessCheckOptions{Trace: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, AccessGranted, result.Status)
+	if assert.Len(t, result.Trace, 2) {
+		assert.Equal(t, `ACE #0 (XA;;FA;;;WD;(@User.Title == "PM")) does not apply because its condition is FALSE`, result.Trace[0].Message)
+		assert.Equal(t, "ACE #1 (XA;;FR;;;WD;(Exists @User.Title)) granted FILE_READ_DATA, FILE_READ_EA, FILE_READ_ATTRIBUTES, "+
+			"READ_CONTROL, SYNCHRONIZE because the token holds Everyone and its condition is TRUE", result.Trace[1].Message)
+	}
+}
@@ -1,6 +1,10 @@
 package winsddlconverter
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 type SECURITY_DESCRIPTOR_CONTROL uint16
 
@@ -12,6 +16,8 @@ const (
 	SE_DACL_DEFAULTED        SECURITY_DESCRIPTOR_CONTROL = 0x0008
 	SE_SACL_PRESENT          SECURITY_DESCRIPTOR_CONTROL = 0x0010
 	SE_SACL_DEFAULTED        SECURITY_DESCRIPTOR_CONTROL = 0x0020
+	SE_DACL_UNTRUSTED        SECURITY_DESCRIPTOR_CONTROL = 0x0040
+	SE_SERVER_SECURITY       SECURITY_DESCRIPTOR_CONTROL = 0x0080
 	SE_DACL_AUTO_INHERIT_REQ SECURITY_DESCRIPTOR_CONTROL = 0x0100
 	SE_SACL_AUTO_INHERIT_REQ SECURITY_DESCRIPTOR_CONTROL = 0x0200
 	SE_DACL_AUTO_INHERITED   SECURITY_DESCRIPTOR_CONTROL = 0x0400
@@ -22,6 +28,41 @@ const (
 	SE_SELF_RELATIVE         SECURITY_DESCRIPTOR_CONTROL = 0x8000
 )
 
+var securityDescriptorControlNames = []struct {
+	flag SECURITY_DESCRIPTOR_CONTROL
+	name string
+}{
+	{SE_OWNER_DEFAULTED, "SE_OWNER_DEFAULTED"},
+	{SE_GROUP_DEFAULTED, "SE_GROUP_DEFAULTED"},
+	{SE_DACL_PRESENT, "SE_DACL_PRESENT"},
+	{SE_DACL_DEFAULTED, "SE_DACL_DEFAULTED"},
+	{SE_SACL_PRESENT, "SE_SACL_PRESENT"},
+	{SE_SACL_DEFAULTED, "SE_SACL_DEFAULTED"},
+	{SE_DACL_UNTRUSTED, "SE_DACL_UNTRUSTED"},
+	{SE_SERVER_SECURITY, "SE_SERVER_SECURITY"},
+	{SE_DACL_AUTO_INHERIT_REQ, "SE_DACL_AUTO_INHERIT_REQ"},
+	{SE_SACL_AUTO_INHERIT_REQ, "SE_SACL_AUTO_INHERIT_REQ"},
+	{SE_DACL_AUTO_INHERITED, "SE_DACL_AUTO_INHERITED"},
+	{SE_SACL_AUTO_INHERITED, "SE_SACL_AUTO_INHERITED"},
+	{SE_DACL_PROTECTED, "SE_DACL_PROTECTED"},
+	{SE_SACL_PROTECTED, "SE_SACL_PROTECTED"},
+	{SE_RM_CONTROL_VALID, "SE_RM_CONTROL_VALID"},
+	{SE_SELF_RELATIVE, "SE_SELF_RELATIVE"},
+}
+
+func (v SECURITY_DESCRIPTOR_CONTROL) String() string {
+	var names []string
+	for _, item := range securityDescriptorControlNames {
+		if v&item.flag != 0 {
+			names = append(names, item.name)
+		}
+	}
+	if len(names) == 0 {
+		return "0"
+	}
+	return strings.Join(names, "|")
+}
+
 // Constants for ACE flags
 const (
 	OBJECT_INHERIT_ACE         = 0x01
@@ -29,10 +70,74 @@ const (
 	NO_PROPAGATE_INHERIT_ACE   = 0x04
 	INHERIT_ONLY_ACE           = 0x08
 	INHERITED_ACE              = 0x10
+	CRITICAL_ACE_FLAG          = 0x20
 	SUCCESSFUL_ACCESS_ACE_FLAG = 0x40
 	FAILED_ACCESS_ACE_FLAG     = 0x80
 )
 
+// Flags for the object ACE Flags field
+const (
+	ACE_OBJECT_TYPE_PRESENT           = 0x1
+	ACE_INHERITED_OBJECT_TYPE_PRESENT = 0x2
+)
+
+// IntegrityLevel is the RID of a mandatory label SID, S-1-16-<level>.
+type IntegrityLevel uint32
+
+const (
+	UntrustedIntegrity  IntegrityLevel = 0x0000
+	LowIntegrity        IntegrityLevel = 0x1000
+	MediumIntegrity     IntegrityLevel = 0x2000
+	MediumPlusIntegrity IntegrityLevel = 0x2100
+	HighIntegrity       IntegrityLevel = 0x3000
+	SystemIntegrity     IntegrityLevel = 0x4000
+	ProtectedIntegrity  IntegrityLevel = 0x5000
+)
+
+// Sid returns the mandatory label SID of the level.
+func (l IntegrityLevel) Sid() string {
+	return fmt.Sprintf("S-1-16-%d", uint32(l))
+}
+
+// alias returns the SDDL alias of the level, such as "HI", or its SID if it has none.
+func (l IntegrityLevel) alias() string {
+	sid := l.Sid()
+	for alias, value := range readOnlySidAliases {
+		if value == sid {
+			return alias
+		}
+	}
+	return sid
+}
+
+// ParseIntegrityLevel returns the level of a mandatory label SID or alias, such as "ME" or "S-1-16-8192".
+func ParseIntegrityLevel(sid string) (IntegrityLevel, error) {
+	rid, err := strconv.ParseUint(strings.TrimPrefix(GetRawSid(sid), "S-1-16-"), 10, 32)
+	if err != nil || !strings.HasPrefix(GetRawSid(sid), "S-1-16-") {
+		return 0, fmt.Errorf("not a mandatory label SID: %s", sid)
+	}
+	return IntegrityLevel(rid), nil
+}
+
+// SYSTEM_MANDATORY_LABEL ACE policies, the access mask of an ML ACE
+const (
+	SYSTEM_MANDATORY_LABEL_NO_WRITE_UP   = 0x1 // NW
+	SYSTEM_MANDATORY_LABEL_NO_READ_UP    = 0x2 // NR
+	SYSTEM_MANDATORY_LABEL_NO_EXECUTE_UP = 0x4 // NX
+)
+
+// SECURITY_DESCRIPTOR_REVISION is the only security descriptor revision
+const SECURITY_DESCRIPTOR_REVISION = 1
+
+// ACL revisions and limits
+const (
+	ACL_REVISION            = 2
+	ACL_REVISION_DS         = 4
+	MAX_ACL_SIZE            = 0xfffc // ACL size is a WORD and must be DWORD aligned
+	MAX_ACE_COUNT           = 0xffff
+	SID_MAX_SUB_AUTHORITIES = 15
+)
+
 type AceType uint8
 
 const (
@@ -71,21 +176,97 @@ func (v AceType) String() string {
 		return "A"
 	case ACCESS_DENIED_ACE_TYPE:
 		return "D"
+	case SYSTEM_AUDIT_ACE_TYPE:
+		return "AU"
+	case SYSTEM_ALARM_ACE_TYPE:
+		return "AL"
+	case ACCESS_ALLOWED_OBJECT_ACE_TYPE:
+		return "OA"
+	case ACCESS_DENIED_OBJECT_ACE_TYPE:
+		return "OD"
+	case ACCESS_AUDIT_OBJECT_ACE_TYPE:
+		return "OU"
+	case ACCESS_ALARM_OBJECT_ACE_TYPE:
+		return "OL"
+	case ACCESS_ALLOWED_CALLBACK_ACE_TYPE:
+		return "XA"
+	case ACCESS_DENIED_CALLBACK_ACE_TYPE:
+		return "XD"
+	case ACCESS_ALLOWED_CALLBACK_OBJECT_ACE_TYPE:
+		return "ZA"
+	case SYSTEM_AUDIT_CALLBACK_ACE_TYPE:
+		return "XU"
 	case SYSTEM_MANDATORY_LABEL_ACE_TYPE:
 		return "ML"
+	case SYSTEM_RESOURCE_ATTRIBUTE_ACE_TYPE:
+		return "RA"
+	case SYSTEM_SCOPED_POLICY_ID_ACE_TYPE:
+		return "SP"
 	default:
 		return "?"
 	}
 }
 
+// IsObject reports whether the ACE carries ObjectType and InheritedObjectType GUIDs.
+func (v AceType) IsObject() bool {
+	switch v {
+	case ACCESS_ALLOWED_OBJECT_ACE_TYPE,
+		ACCESS_DENIED_OBJECT_ACE_TYPE,
+		ACCESS_AUDIT_OBJECT_ACE_TYPE,
+		ACCESS_ALARM_OBJECT_ACE_TYPE,
+		ACCESS_ALLOWED_CALLBACK_OBJECT_ACE_TYPE,
+		ACCESS_DENIED_CALLBACK_OBJECT_ACE_TYPE,
+		SYSTEM_AUDIT_CALLBACK_OBJECT_ACE_TYPE,
+		SYSTEM_ALARM_CALLBACK_OBJECT_ACE_TYPE:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsCallback reports whether the ACE carries application data after its SID, a conditional
+// expression for the types written in SDDL.
+func (v AceType) IsCallback() bool {
+	return v >= ACCESS_ALLOWED_CALLBACK_ACE_TYPE && v <= SYSTEM_ALARM_CALLBACK_OBJECT_ACE_TYPE
+}
+
+// hasApplicationData reports whether the bytes after the SID are Ace.ApplicationData.
+func (v AceType) hasApplicationData() bool {
+	return v.IsCallback() || v == SYSTEM_RESOURCE_ATTRIBUTE_ACE_TYPE
+}
+
 func ParseAceType(v string) (AceType, error) {
 	switch v {
 	case "A":
 		return ACCESS_ALLOWED_ACE_TYPE, nil
 	case "D":
 		return ACCESS_DENIED_ACE_TYPE, nil
+	case "AU":
+		return SYSTEM_AUDIT_ACE_TYPE, nil
+	case "AL":
+		return SYSTEM_ALARM_ACE_TYPE, nil
+	case "OA":
+		return ACCESS_ALLOWED_OBJECT_ACE_TYPE, nil
+	case "OD":
+		return ACCESS_DENIED_OBJECT_ACE_TYPE, nil
+	case "OU":
+		return ACCESS_AUDIT_OBJECT_ACE_TYPE, nil
+	case "OL":
+		return ACCESS_ALARM_OBJECT_ACE_TYPE, nil
+	case "XA":
+		return ACCESS_ALLOWED_CALLBACK_ACE_TYPE, nil
+	case "XD":
+		return ACCESS_DENIED_CALLBACK_ACE_TYPE, nil
+	case "ZA":
+		return ACCESS_ALLOWED_CALLBACK_OBJECT_ACE_TYPE, nil
+	case "XU":
+		return SYSTEM_AUDIT_CALLBACK_ACE_TYPE, nil
 	case "ML":
 		return SYSTEM_MANDATORY_LABEL_ACE_TYPE, nil
+	case "RA":
+		return SYSTEM_RESOURCE_ATTRIBUTE_ACE_TYPE, nil
+	case "SP":
+		return SYSTEM_SCOPED_POLICY_ID_ACE_TYPE, nil
 	default:
 		return 0, fmt.Errorf("unsupported ACE type: %s", v)
 	}
@@ -98,6 +279,7 @@ var wellKnownSids = map[string]string{
 	"S-1-2-0": "LG", // Local
 	"S-1-3-0": "CO", // Creator Owner
 	"S-1-3-1": "CG", // Creator Group
+	"S-1-3-4": "OW", // Owner Rights
 	"S-1-5-1": "DU", // Dialup
 	"S-1-5-2": "NU", // Network
 	"S-1-5-3": "BG", // Batch
@@ -133,6 +315,65 @@ var wellKnownSids = map[string]string{
 	"S-1-15-2-1":   "AC", // All Application Packages
 }
 
+// Aliases that are read but not written, so that existing output does not change
+var readOnlySidAliases = map[string]string{
+	"LW": "S-1-16-4096",  // Low Mandatory Level
+	"ME": "S-1-16-8192",  // Medium Mandatory Level
+	"MP": "S-1-16-8448",  // Medium Plus Mandatory Level
+	"HI": "S-1-16-12288", // High Mandatory Level
+	"SI": "S-1-16-16384", // System Mandatory Level
+}
+
+// Display names of well-known SIDs, as shown by Windows
+var wellKnownSidNames = map[string]string{
+	"S-1-0-0":      "NULL SID",
+	"S-1-1-0":      "Everyone",
+	"S-1-2-0":      "LOCAL",
+	"S-1-3-0":      "CREATOR OWNER",
+	"S-1-3-1":      "CREATOR GROUP",
+	"S-1-3-4":      "OWNER RIGHTS",
+	"S-1-5-1":      "NT AUTHORITY\\DIALUP",
+	"S-1-5-2":      "NT AUTHORITY\\NETWORK",
+	"S-1-5-3":      "NT AUTHORITY\\BATCH",
+	"S-1-5-4":      "NT AUTHORITY\\INTERACTIVE",
+	"S-1-5-6":      "NT AUTHORITY\\SERVICE",
+	"S-1-5-7":      "NT AUTHORITY\\ANONYMOUS LOGON",
+	"S-1-5-8":      "NT AUTHORITY\\PROXY",
+	"S-1-5-9":      "NT AUTHORITY\\ENTERPRISE DOMAIN CONTROLLERS",
+	"S-1-5-10":     "NT AUTHORITY\\SELF",
+	"S-1-5-11":     "NT AUTHORITY\\Authenticated Users",
+	"S-1-5-12":     "NT AUTHORITY\\RESTRICTED",
+	"S-1-5-18":     "NT AUTHORITY\\SYSTEM",
+	"S-1-5-19":     "NT AUTHORITY\\LOCAL SERVICE",
+	"S-1-5-20":     "NT AUTHORITY\\NETWORK SERVICE",
+	"S-1-5-32-544": "BUILTIN\\Administrators",
+	"S-1-5-32-545": "BUILTIN\\Users",
+	"S-1-5-32-546": "BUILTIN\\Guests",
+	"S-1-5-32-547": "BUILTIN\\Power Users",
+	"S-1-5-32-548": "BUILTIN\\Account Operators",
+	"S-1-5-32-549": "BUILTIN\\Server Operators",
+	"S-1-5-32-550": "BUILTIN\\Print Operators",
+	"S-1-5-32-551": "BUILTIN\\Backup Operators",
+	"S-1-5-32-552": "BUILTIN\\Replicator",
+	"S-1-5-32-554": "BUILTIN\\Pre-Windows 2000 Compatible Access",
+	"S-1-5-32-555": "BUILTIN\\Remote Desktop Users",
+	"S-1-5-32-556": "BUILTIN\\Network Configuration Operators",
+	"S-1-5-32-558": "BUILTIN\\Performance Monitor Users",
+	"S-1-5-32-559": "BUILTIN\\Performance Log Users",
+	"S-1-5-32-568": "BUILTIN\\IIS_IUSRS",
+	"S-1-5-32-569": "BUILTIN\\Cryptographic Operators",
+	"S-1-5-32-573": "BUILTIN\\Event Log Readers",
+	"S-1-5-32-574": "BUILTIN\\Certificate Service DCOM Access",
+	"S-1-15-2-1":   "APPLICATION PACKAGE AUTHORITY\\ALL APPLICATION PACKAGES",
+	"S-1-15-2-2":   "APPLICATION PACKAGE AUTHORITY\\ALL RESTRICTED APPLICATION PACKAGES",
+	"S-1-16-0":     "Mandatory Label\\Untrusted Mandatory Level",
+	"S-1-16-4096":  "Mandatory Label\\Low Mandatory Level",
+	"S-1-16-8192":  "Mandatory Label\\Medium Mandatory Level",
+	"S-1-16-8448":  "Mandatory Label\\Medium Plus Mandatory Level",
+	"S-1-16-12288": "Mandatory Label\\High Mandatory Level",
+	"S-1-16-16384": "Mandatory Label\\System Mandatory Level",
+}
+
 var wellKnownSidsReverse map[string]string
 
 func init() {
@@ -140,6 +381,9 @@ func init() {
 	for key, value := range wellKnownSids {
 		wellKnownSidsReverse[value] = key
 	}
+	for key, value := range readOnlySidAliases {
+		wellKnownSidsReverse[key] = value
+	}
 }
 
 // RawSidToString sid to sid or alias
@@ -151,6 +395,16 @@ func RawSidToString(input string) string {
 	return input
 }
 
+// SidDisplayName returns the Windows display name of a well-known SID or alias,
+// or the SID itself.
+func SidDisplayName(input string) string {
+	sid := GetRawSid(input)
+	if name, ok := wellKnownSidNames[sid]; ok {
+		return name
+	}
+	return sid
+}
+
 // GetRawSid sid or alias to sid
 func GetRawSid(input string) string {
 	s, ok := wellKnownSidsReverse[input]
@@ -0,0 +1,71 @@
+package winsddlconverter
+
+import "fmt"
+
+// SddlControlMask is the set of control bits that survive a conversion to SDDL.
+// The PRESENT bits follow from the "D:" and "S:" sections, P, AR and AI are written
+// after the section prefix, and SE_SELF_RELATIVE only describes the binary format.
+//
+// SE_OWNER_DEFAULTED, SE_GROUP_DEFAULTED, SE_DACL_DEFAULTED, SE_SACL_DEFAULTED,
+// SE_DACL_UNTRUSTED, SE_SERVER_SECURITY and SE_RM_CONTROL_VALID, together with
+// RMControl, have no SDDL syntax. ToBinary and ToJson keep them.
+const SddlControlMask = SE_DACL_PRESENT | SE_SACL_PRESENT |
+	SE_DACL_PROTECTED | SE_SACL_PROTECTED |
+	SE_DACL_AUTO_INHERIT_REQ | SE_SACL_AUTO_INHERIT_REQ |
+	SE_DACL_AUTO_INHERITED | SE_SACL_AUTO_INHERITED |
+	SE_SELF_RELATIVE
+
+// ConversionWarning describes information lost by a conversion.
+type ConversionWarning struct {
+	Control SECURITY_DESCRIPTOR_CONTROL `json:"control,omitempty"`
+	Message string                      `json:"message"`
+}
+
+func (w ConversionWarning) String() string {
+	return w.Message
+}
+
+// GetRMControl returns the resource manager control byte, like GetSecurityDescriptorRMControl.
+func (sd *SecurityDescriptor) GetRMControl() (uint8, bool) {
+	if sd.Control&SE_RM_CONTROL_VALID == 0 {
+		return 0, false
+	}
+	return sd.RMControl, true
+}
+
+// SetRMControl sets the resource manager control byte and SE_RM_CONTROL_VALID.
+func (sd *SecurityDescriptor) SetRMControl(v uint8) {
+	sd.RMControl = v
+	sd.Control |= SE_RM_CONTROL_VALID
+}
+
+// ClearRMControl removes the resource manager control byte.
+func (sd *SecurityDescriptor) ClearRMControl() {
+	sd.RMControl = 0
+	sd.Control &^= SE_RM_CONTROL_VALID
+}
+
+// SddlWarnings lists what ToSddl cannot express for this descriptor.
+func (sd *SecurityDescriptor) SddlWarnings() []ConversionWarning {
+	var warnings []ConversionWarning
+
+	if lost := sd.Control &^ SddlControlMask &^ SE_RM_CONTROL_VALID; lost != 0 {
+		warnings = append(warnings, ConversionWarning{
+			Control: lost,
+			Message: fmt.Sprintf("control bits %s have no SDDL syntax", lost),
+		})
+	}
+	if sd.Control&SE_RM_CONTROL_VALID != 0 {
+		warnings = append(warnings, ConversionWarning{
+			Control: SE_RM_CONTROL_VALID,
+			Message: fmt.Sprintf("resource manager control 0x%02x has no SDDL syntax", sd.RMControl),
+		})
+	}
+
+	return warnings
+}
+
+// ToSddlWithWarnings returns ToSddl together with SddlWarnings.
+func (sd *SecurityDescriptor) ToSddlWithWarnings() (string, []ConversionWarning) {
+	return sd.ToSddl(), sd.SddlWarnings()
+}
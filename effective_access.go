@@ -0,0 +1,114 @@
+package winsddlconverter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AccessLayer is a set of descriptors of a remote file access, see EffectiveShareAccess.
+type AccessLayer uint8
+
+const (
+	ShareLayer AccessLayer = 1 << iota
+	FileLayer
+)
+
+func (l AccessLayer) String() string {
+	var names []string
+	if l&ShareLayer != 0 {
+		names = append(names, "share")
+	}
+	if l&FileLayer != 0 {
+		names = append(names, "file")
+	}
+	return strings.Join(names, " and ")
+}
+
+// EffectiveRight is the effective access to one right, like a row of Explorer's Effective Access tab.
+type EffectiveRight struct {
+	Right   AccessMask `json:"right"`
+	Name    string     `json:"name"`
+	Granted bool       `json:"granted"`
+	// LimitedBy are the descriptors that do not grant the right
+	LimitedBy AccessLayer `json:"limitedBy,omitempty"`
+}
+
+// EffectiveAccessResult is the outcome of EffectiveShareAccess.
+type EffectiveAccessResult struct {
+	// GrantedAccess are the rights both the share and the file grant
+	GrantedAccess AccessMask         `json:"grantedAccess"`
+	Share         *AccessCheckResult `json:"share"`
+	File          *AccessCheckResult `json:"file"`
+	Rights        []EffectiveRight   `json:"rights"`
+}
+
+// defaultShareSddl is the share descriptor of a share without one, a NULL DACL that grants
+// every token full control.
+const defaultShareSddl = "O:SYG:SYD:NO_ACCESS_CONTROL"
+
+// effectiveRights are the rights EffectiveShareAccess reports on.
+var effectiveRights = []AccessMask{
+	0x0001, 0x0002, 0x0004, 0x0008, 0x0010, 0x0020, 0x0040, 0x0080, 0x0100,
+	DELETE, READ_CONTROL, WRITE_DAC, WRITE_OWNER, SYNCHRONIZE,
+}
+
+// EffectiveShareAccess returns the access of token to a file over SMB, which has only the
+// rights that both the share permissions and the file descriptor grant. Both are checked
+// for MAXIMUM_ALLOWED, the share with ShareRights, mapping generic rights of its ACEs, and
+// the file with FileRights. opts apply to the file, the share gets only Trace. A share
+// descriptor without owner or group, as share permissions often are, is owned by SYSTEM.
+// A nil share has no share permissions, which like on Windows grants everyone full control.
+func EffectiveShareAccess(share *SecurityDescriptor, file *SecurityDescriptor, token *Token, opts *AccessCheckOptions) (*EffectiveAccessResult, error) {
+	if file == nil {
+		return nil, fmt.Errorf("file security descriptor is required")
+	}
+	if share == nil {
+		var err error
+		if share, err = ParseSDDL(defaultShareSddl); err != nil {
+			return nil, err
+		}
+	}
+	fileOpts := AccessCheckOptions{}
+	if opts != nil {
+		fileOpts = *opts
+	}
+	fileOpts.Profile = FileRights
+	shareOpts := AccessCheckOptions{Profile: ShareRights, MapAceGenericRights: true, Trace: fileOpts.Trace}
+
+	if share.Owner == "" || share.Group == "" {
+		owned := *share
+		if owned.Owner == "" {
+			owned.Owner = "SY"
+		}
+		if owned.Group == "" {
+			owned.Group = "SY"
+		}
+		share = &owned
+	}
+	shareResult, err := share.AccessCheck(token, MAXIMUM_ALLOWED, &shareOpts)
+	if err != nil {
+		return nil, err
+	}
+	fileResult, err := file.AccessCheck(token, MAXIMUM_ALLOWED, &fileOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &EffectiveAccessResult{
+		GrantedAccess: shareResult.GrantedAccess & fileResult.GrantedAccess,
+		Share:         shareResult,
+		File:          fileResult,
+	}
+	for _, right := range effectiveRights {
+		entry := EffectiveRight{Right: right, Name: right.Names(FileRights)[0]}
+		if !shareResult.GrantedAccess.Has(right) {
+			entry.LimitedBy |= ShareLayer
+		}
+		if !fileResult.GrantedAccess.Has(right) {
+			entry.LimitedBy |= FileLayer
+		}
+		entry.Granted = entry.LimitedBy == 0
+		result.Rights = append(result.Rights, entry)
+	}
+	return result, nil
+}
@@ -0,0 +1,78 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestEffectiveShareAccess(t *testing.T) {
+	share, err := ParseSDDL("D:(A;;GR;;;WD)(A;;0x1301bf;;;BA)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := ParseSDDL("O:BAG:SYD:(A;;FR;;;AU)(A;;FA;;;BA)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &Token{User: "S-1-5-21-1-2-3-1001", Groups: []TokenGroup{
+		{Sid: "WD", Attributes: SE_GROUP_ENABLED},
+		{Sid: "AU", Attributes: SE_GROUP_ENABLED},
+	}}
+	admin := &Token{User: "S-1-5-21-1-2-3-500", Groups: []TokenGroup{
+		{Sid: "WD", Attributes: SE_GROUP_ENABLED},
+		{Sid: "AU", Attributes: SE_GROUP_ENABLED},
+		{Sid: "BA", Attributes: SE_GROUP_ENABLED},
+	}}
+
+	result, err := EffectiveShareAccess(share, file, user, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, AccessMask(FILE_READ_ACCESS), result.GrantedAccess)
+	assert.Equal(t, AccessMask(0x1200a9), result.Share.GrantedAccess)
+	assert.Equal(t, AccessMask(FILE_READ_ACCESS), result.File.GrantedAccess)
+	limits := map[string]AccessLayer{}
+	for _, right := range result.Rights {
+		assert.Equal(t, right.LimitedBy == 0, right.Granted, right.Name)
+		limits[right.Name] = right.LimitedBy
+	}
+	assert.Equal(t, AccessLayer(0), limits["FILE_READ_DATA"])
+	assert.Equal(t, FileLayer, limits["FILE_EXECUTE"])
+	assert.Equal(t, ShareLayer|FileLayer, limits["FILE_WRITE_DATA"])
+	assert.Equal(t, "share and file", limits["FILE_WRITE_DATA"].String())
+
+	result, err = EffectiveShareAccess(share, file, admin, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, AccessMask(0x1301bf), result.GrantedAccess)
+	for _, right := range result.Rights {
+		switch right.Right {
+		case FILE_DELETE_CHILD &^ SYNCHRONIZE, WRITE_DAC, WRITE_OWNER:
+			assert.Equal(t, ShareLayer, right.LimitedBy, right.Name)
+		default:
+			assert.True(t, right.Granted, right.Name)
+		}
+	}
+
+	result, err = EffectiveShareAccess(nil, file, user, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, AccessMask(FILE_ALL_ACCESS), result.Share.GrantedAccess)
+	assert.Equal(t, AccessMask(FILE_READ_ACCESS), result.GrantedAccess)
+
+	userFile, err := ParseSDDL("O:BAG:SYD:(A;;FR;;;S-1-5-21-1-2-3-1001)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = EffectiveShareAccess(nil, userFile, &Token{User: "S-1-5-21-1-2-3-1001"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, AccessMask(FILE_ALL_ACCESS), result.Share.GrantedAccess)
+	assert.Equal(t, AccessMask(FILE_READ_ACCESS), result.GrantedAccess)
+
+	_, err = EffectiveShareAccess(share, nil, user, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,464 @@
+package winsddlconverter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNotMapped is returned by an IdMapper that has no mapping for the given id or SID.
+var ErrNotMapped = errors.New("no id mapping")
+
+// IdMapper translates between unix uid/gid and Windows SIDs.
+type IdMapper interface {
+	UidToSid(uid uint32) (string, error)
+	GidToSid(gid uint32) (string, error)
+	SidToUid(sid string) (uint32, error)
+	SidToGid(sid string) (uint32, error)
+}
+
+// Samba "Unix User" and "Unix Group" authorities
+const (
+	UnixUserSidPrefix  = "S-1-22-1"
+	UnixGroupSidPrefix = "S-1-22-2"
+)
+
+// UnixIdMapper maps ids to S-1-22-1-<uid> and S-1-22-2-<gid>.
+type UnixIdMapper struct{}
+
+func (m *UnixIdMapper) UidToSid(uid uint32) (string, error) {
+	return fmt.Sprintf("%s-%d", UnixUserSidPrefix, uid), nil
+}
+
+func (m *UnixIdMapper) GidToSid(gid uint32) (string, error) {
+	return fmt.Sprintf("%s-%d", UnixGroupSidPrefix, gid), nil
+}
+
+func (m *UnixIdMapper) SidToUid(sid string) (uint32, error) {
+	domain, rid, err := splitSidRid(sid)
+	if err != nil || domain != UnixUserSidPrefix {
+		return 0, fmt.Errorf("%w: %s", ErrNotMapped, sid)
+	}
+	return rid, nil
+}
+
+func (m *UnixIdMapper) SidToGid(sid string) (uint32, error) {
+	domain, rid, err := splitSidRid(sid)
+	if err != nil || domain != UnixGroupSidPrefix {
+		return 0, fmt.Errorf("%w: %s", ErrNotMapped, sid)
+	}
+	return rid, nil
+}
+
+// RidIdMapper implements the idmap_rid algorithm for a single domain:
+// id = rid - BaseRid + RangeLow, restricted to [RangeLow, RangeHigh].
+// Users and groups share the same id space.
+type RidIdMapper struct {
+	DomainSid string
+	BaseRid   uint32
+	RangeLow  uint32
+	RangeHigh uint32
+}
+
+func (m *RidIdMapper) idToSid(id uint32) (string, error) {
+	if id < m.RangeLow || id > m.RangeHigh {
+		return "", fmt.Errorf("%w: id %d is outside range %d-%d", ErrNotMapped, id, m.RangeLow, m.RangeHigh)
+	}
+	rid := uint64(id-m.RangeLow) + uint64(m.BaseRid)
+	if rid > 0xffffffff {
+		return "", fmt.Errorf("%w: rid overflow for id %d", ErrNotMapped, id)
+	}
+	return fmt.Sprintf("%s-%d", GetRawSid(m.DomainSid), rid), nil
+}
+
+func (m *RidIdMapper) sidToId(sid string) (uint32, error) {
+	domain, rid, err := splitSidRid(sid)
+	if err != nil || domain != GetRawSid(m.DomainSid) || rid < m.BaseRid {
+		return 0, fmt.Errorf("%w: %s", ErrNotMapped, sid)
+	}
+	id := uint64(rid-m.BaseRid) + uint64(m.RangeLow)
+	if id > uint64(m.RangeHigh) {
+		return 0, fmt.Errorf("%w: %s is outside range %d-%d", ErrNotMapped, sid, m.RangeLow, m.RangeHigh)
+	}
+	return uint32(id), nil
+}
+
+func (m *RidIdMapper) UidToSid(uid uint32) (string, error) {
+	return m.idToSid(uid)
+}
+
+func (m *RidIdMapper) GidToSid(gid uint32) (string, error) {
+	return m.idToSid(gid)
+}
+
+func (m *RidIdMapper) SidToUid(sid string) (uint32, error) {
+	return m.sidToId(sid)
+}
+
+func (m *RidIdMapper) SidToGid(sid string) (uint32, error) {
+	return m.sidToId(sid)
+}
+
+// AutoridRange is one allocated range of an AutoridIdMapper.
+// DomainRange is rid divided by the range size, as in the autorid "domain range index".
+type AutoridRange struct {
+	Index       uint32 `json:"index"`
+	DomainSid   string `json:"domainSid"`
+	DomainRange uint32 `json:"domainRange"`
+}
+
+// AutoridIdMapper allocates a fixed-size block of ids to each domain on first use,
+// like idmap_autorid. Allocations are kept in memory; use Ranges and AddRange to persist them.
+type AutoridIdMapper struct {
+	rangeLow  uint32
+	rangeHigh uint32
+	rangeSize uint32
+
+	mu      sync.Mutex
+	byKey   map[autoridKey]uint32
+	byIndex map[uint32]autoridKey
+}
+
+type autoridKey struct {
+	domain      string
+	domainRange uint32
+}
+
+// NewAutoridIdMapper returns a mapper of ids rangeLow-rangeHigh in blocks of rangeSize.
+// It is the only way to create an AutoridIdMapper, the zero value is not usable.
+func NewAutoridIdMapper(rangeLow, rangeHigh, rangeSize uint32) (*AutoridIdMapper, error) {
+	if rangeSize == 0 || rangeHigh < rangeLow || uint64(rangeHigh-rangeLow)+1 < uint64(rangeSize) {
+		return nil, fmt.Errorf("invalid autorid range %d-%d with range size %d", rangeLow, rangeHigh, rangeSize)
+	}
+	return &AutoridIdMapper{
+		rangeLow:  rangeLow,
+		rangeHigh: rangeHigh,
+		rangeSize: rangeSize,
+	}, nil
+}
+
+func (m *AutoridIdMapper) rangeCount() uint32 {
+	return uint32((uint64(m.rangeHigh-m.rangeLow) + 1) / uint64(m.rangeSize))
+}
+
+func (m *AutoridIdMapper) init() {
+	if m.byKey == nil {
+		m.byKey = make(map[autoridKey]uint32)
+		m.byIndex = make(map[uint32]autoridKey)
+	}
+}
+
+// AddRange restores a previously allocated range.
+func (m *AutoridIdMapper) AddRange(r AutoridRange) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	if r.Index >= m.rangeCount() {
+		return fmt.Errorf("autorid range index %d exceeds %d available ranges", r.Index, m.rangeCount())
+	}
+	key := autoridKey{domain: GetRawSid(r.DomainSid), domainRange: r.DomainRange}
+	if existing, ok := m.byIndex[r.Index]; ok && existing != key {
+		return fmt.Errorf("autorid range index %d is already allocated to %s", r.Index, existing.domain)
+	}
+	if existing, ok := m.byKey[key]; ok && existing != r.Index {
+		return fmt.Errorf("autorid domain %s range %d is already allocated at index %d", key.domain, key.domainRange, existing)
+	}
+	m.byKey[key] = r.Index
+	m.byIndex[r.Index] = key
+	return nil
+}
+
+// Ranges returns the current allocations, ordered by index.
+func (m *AutoridIdMapper) Ranges() []AutoridRange {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var result []AutoridRange
+	for i := uint32(0); i < m.rangeCount(); i++ {
+		key, ok := m.byIndex[i]
+		if !ok {
+			continue
+		}
+		result = append(result, AutoridRange{Index: i, DomainSid: key.domain, DomainRange: key.domainRange})
+	}
+	return result
+}
+
+func (m *AutoridIdMapper) allocate(key autoridKey) (uint32, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.init()
+
+	if index, ok := m.byKey[key]; ok {
+		return index, nil
+	}
+	for i := uint32(0); i < m.rangeCount(); i++ {
+		if _, used := m.byIndex[i]; !used {
+			m.byKey[key] = i
+			m.byIndex[i] = key
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("autorid ranges exhausted")
+}
+
+func (m *AutoridIdMapper) idToSid(id uint32) (string, error) {
+	if id < m.rangeLow || id > m.rangeHigh {
+		return "", fmt.Errorf("%w: id %d is outside range %d-%d", ErrNotMapped, id, m.rangeLow, m.rangeHigh)
+	}
+	index := (id - m.rangeLow) / m.rangeSize
+	m.mu.Lock()
+	key, ok := m.byIndex[index]
+	m.mu.Unlock()
+	if !ok {
+		return "", fmt.Errorf("%w: id %d is in an unallocated range", ErrNotMapped, id)
+	}
+	rid := uint64(key.domainRange)*uint64(m.rangeSize) + uint64((id-m.rangeLow)%m.rangeSize)
+	return fmt.Sprintf("%s-%d", key.domain, rid), nil
+}
+
+func (m *AutoridIdMapper) sidToId(sid string) (uint32, error) {
+	domain, rid, err := splitSidRid(sid)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s", ErrNotMapped, sid)
+	}
+	index, err := m.allocate(autoridKey{domain: domain, domainRange: rid / m.rangeSize})
+	if err != nil {
+		return 0, err
+	}
+	return m.rangeLow + index*m.rangeSize + rid%m.rangeSize, nil
+}
+
+func (m *AutoridIdMapper) UidToSid(uid uint32) (string, error) {
+	return m.idToSid(uid)
+}
+
+func (m *AutoridIdMapper) GidToSid(gid uint32) (string, error) {
+	return m.idToSid(gid)
+}
+
+func (m *AutoridIdMapper) SidToUid(sid string) (uint32, error) {
+	return m.sidToId(sid)
+}
+
+func (m *AutoridIdMapper) SidToGid(sid string) (uint32, error) {
+	return m.sidToId(sid)
+}
+
+// StaticIdMapper maps ids from a fixed table.
+type StaticIdMapper struct {
+	uidToSid map[uint32]string
+	gidToSid map[uint32]string
+	sidToUid map[string]uint32
+	sidToGid map[string]uint32
+}
+
+func NewStaticIdMapper() *StaticIdMapper {
+	return &StaticIdMapper{
+		uidToSid: make(map[uint32]string),
+		gidToSid: make(map[uint32]string),
+		sidToUid: make(map[string]uint32),
+		sidToGid: make(map[string]uint32),
+	}
+}
+
+func (m *StaticIdMapper) AddUid(uid uint32, sid string) error {
+	sid = GetRawSid(sid)
+	if existing, ok := m.uidToSid[uid]; ok && existing != sid {
+		return fmt.Errorf("uid %d is already mapped to %s", uid, existing)
+	}
+	if existing, ok := m.sidToUid[sid]; ok && existing != uid {
+		return fmt.Errorf("%s is already mapped to uid %d", sid, existing)
+	}
+	m.uidToSid[uid] = sid
+	m.sidToUid[sid] = uid
+	return nil
+}
+
+func (m *StaticIdMapper) AddGid(gid uint32, sid string) error {
+	sid = GetRawSid(sid)
+	if existing, ok := m.gidToSid[gid]; ok && existing != sid {
+		return fmt.Errorf("gid %d is already mapped to %s", gid, existing)
+	}
+	if existing, ok := m.sidToGid[sid]; ok && existing != gid {
+		return fmt.Errorf("%s is already mapped to gid %d", sid, existing)
+	}
+	m.gidToSid[gid] = sid
+	m.sidToGid[sid] = gid
+	return nil
+}
+
+// ParseStaticIdMap reads a mapping table with one entry per line:
+//
+//	uid 1000 S-1-5-21-920909269-1353440977-3059239504-1001
+//	gid 100 BU
+//
+// Empty lines and lines starting with '#' are ignored.
+func ParseStaticIdMap(r io.Reader) (*StaticIdMapper, error) {
+	m := NewStaticIdMapper()
+
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("idmap line %d: expected 3 fields: %s", lineNo, line)
+		}
+		id, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("idmap line %d: invalid id: %v", lineNo, err)
+		}
+		if _, err := MarshalSidFromString(fields[2]); err != nil {
+			return nil, fmt.Errorf("idmap line %d: invalid SID %s: %v", lineNo, fields[2], err)
+		}
+		switch strings.ToLower(fields[0]) {
+		case "uid":
+			err = m.AddUid(uint32(id), fields[2])
+		case "gid":
+			err = m.AddGid(uint32(id), fields[2])
+		default:
+			err = fmt.Errorf("unknown id type: %s", fields[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("idmap line %d: %v", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func LoadStaticIdMap(path string) (*StaticIdMapper, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseStaticIdMap(f)
+}
+
+func (m *StaticIdMapper) UidToSid(uid uint32) (string, error) {
+	if sid, ok := m.uidToSid[uid]; ok {
+		return sid, nil
+	}
+	return "", fmt.Errorf("%w: uid %d", ErrNotMapped, uid)
+}
+
+func (m *StaticIdMapper) GidToSid(gid uint32) (string, error) {
+	if sid, ok := m.gidToSid[gid]; ok {
+		return sid, nil
+	}
+	return "", fmt.Errorf("%w: gid %d", ErrNotMapped, gid)
+}
+
+func (m *StaticIdMapper) SidToUid(sid string) (uint32, error) {
+	if uid, ok := m.sidToUid[GetRawSid(sid)]; ok {
+		return uid, nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrNotMapped, sid)
+}
+
+func (m *StaticIdMapper) SidToGid(sid string) (uint32, error) {
+	if gid, ok := m.sidToGid[GetRawSid(sid)]; ok {
+		return gid, nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrNotMapped, sid)
+}
+
+// ChainIdMapper tries each mapper in order and returns the first mapping found.
+// Errors other than ErrNotMapped stop the search.
+type ChainIdMapper []IdMapper
+
+func (c ChainIdMapper) UidToSid(uid uint32) (string, error) {
+	for _, m := range c {
+		sid, err := m.UidToSid(uid)
+		if err == nil || !errors.Is(err, ErrNotMapped) {
+			return sid, err
+		}
+	}
+	return "", fmt.Errorf("%w: uid %d", ErrNotMapped, uid)
+}
+
+func (c ChainIdMapper) GidToSid(gid uint32) (string, error) {
+	for _, m := range c {
+		sid, err := m.GidToSid(gid)
+		if err == nil || !errors.Is(err, ErrNotMapped) {
+			return sid, err
+		}
+	}
+	return "", fmt.Errorf("%w: gid %d", ErrNotMapped, gid)
+}
+
+func (c ChainIdMapper) SidToUid(sid string) (uint32, error) {
+	for _, m := range c {
+		uid, err := m.SidToUid(sid)
+		if err == nil || !errors.Is(err, ErrNotMapped) {
+			return uid, err
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrNotMapped, sid)
+}
+
+func (c ChainIdMapper) SidToGid(sid string) (uint32, error) {
+	for _, m := range c {
+		gid, err := m.SidToGid(sid)
+		if err == nil || !errors.Is(err, ErrNotMapped) {
+			return gid, err
+		}
+	}
+	return 0, fmt.Errorf("%w: %s", ErrNotMapped, sid)
+}
+
+// SetUnixOwnership sets Owner and Group from a unix uid and gid.
+func (sd *SecurityDescriptor) SetUnixOwnership(m IdMapper, uid uint32, gid uint32) error {
+	owner, err := m.UidToSid(uid)
+	if err != nil {
+		return fmt.Errorf("failed to map owner: %w", err)
+	}
+	group, err := m.GidToSid(gid)
+	if err != nil {
+		return fmt.Errorf("failed to map group: %w", err)
+	}
+	sd.Owner = owner
+	sd.Group = group
+	return nil
+}
+
+// UnixOwnership returns the unix uid and gid of Owner and Group.
+func (sd *SecurityDescriptor) UnixOwnership(m IdMapper) (uint32, uint32, error) {
+	uid, err := m.SidToUid(GetRawSid(sd.Owner))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to map owner: %w", err)
+	}
+	gid, err := m.SidToGid(GetRawSid(sd.Group))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to map group: %w", err)
+	}
+	return uid, gid, nil
+}
+
+// splitSidRid splits a SID into its domain part and the last sub-authority.
+func splitSidRid(sid string) (string, uint32, error) {
+	sid = GetRawSid(sid)
+	pos := strings.LastIndexByte(sid, '-')
+	if !strings.HasPrefix(sid, "S-") || pos < 0 || strings.Count(sid, "-") < 3 {
+		return "", 0, fmt.Errorf("invalid SID format: %s", sid)
+	}
+	rid, err := strconv.ParseUint(sid[pos+1:], 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid SID format: %s", sid)
+	}
+	return sid[:pos], uint32(rid), nil
+}
@@ -0,0 +1,127 @@
+package winsddlconverter
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestUnixIdMapper(t *testing.T) {
+	m := &UnixIdMapper{}
+
+	sid, err := m.UidToSid(1000)
+	assert.NoError(t, err)
+	assert.Equal(t, "S-1-22-1-1000", sid)
+
+	gid, err := m.SidToGid("S-1-22-2-100")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(100), gid)
+
+	_, err = m.SidToUid("S-1-22-2-100")
+	assert.True(t, errors.Is(err, ErrNotMapped))
+}
+
+func TestRidIdMapper(t *testing.T) {
+	m := &RidIdMapper{
+		DomainSid: "S-1-5-21-920909269-1353440977-3059239504",
+		RangeLow:  100000,
+		RangeHigh: 199999,
+	}
+	tests := []struct {
+		name string
+		id   uint32
+		sid  string
+	}{
+		{"user", 101001, "S-1-5-21-920909269-1353440977-3059239504-1001"},
+		{"domain users", 100513, "S-1-5-21-920909269-1353440977-3059239504-513"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sid, err := m.UidToSid(tt.id)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.sid, sid)
+
+			id, err := m.SidToGid(tt.sid)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.id, id)
+		})
+	}
+
+	_, err := m.UidToSid(99999)
+	assert.True(t, errors.Is(err, ErrNotMapped))
+	_, err = m.SidToUid("S-1-5-21-1-2-3-1001")
+	assert.True(t, errors.Is(err, ErrNotMapped))
+}
+
+func TestAutoridIdMapper(t *testing.T) {
+	m, err := NewAutoridIdMapper(1000000, 1999999, 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uid, err := m.SidToUid("S-1-5-21-1-2-3-1001")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1001001), uid)
+
+	uid, err = m.SidToUid("S-1-5-21-4-5-6-500")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1100500), uid)
+
+	uid, err = m.SidToUid("S-1-5-21-1-2-3-100002")
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(1200002), uid)
+
+	sid, err := m.GidToSid(1100513)
+	assert.NoError(t, err)
+	assert.Equal(t, "S-1-5-21-4-5-6-513", sid)
+
+	sid, err = m.UidToSid(1200003)
+	assert.NoError(t, err)
+	assert.Equal(t, "S-1-5-21-1-2-3-100003", sid)
+
+	_, err = m.UidToSid(1500000)
+	assert.True(t, errors.Is(err, ErrNotMapped))
+
+	restored, err := NewAutoridIdMapper(1000000, 1999999, 100000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range m.Ranges() {
+		assert.NoError(t, restored.AddRange(r))
+	}
+	sid, err = restored.UidToSid(1001001)
+	assert.NoError(t, err)
+	assert.Equal(t, "S-1-5-21-1-2-3-1001", sid)
+}
+
+func TestStaticIdMapper(t *testing.T) {
+	m, err := ParseStaticIdMap(strings.NewReader(`
+# local accounts
+uid 0 SY
+uid 1000 S-1-5-21-1-2-3-1001
+gid 100 BU
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd := &SecurityDescriptor{}
+	assert.NoError(t, sd.SetUnixOwnership(m, 1000, 100))
+	assert.Equal(t, "S-1-5-21-1-2-3-1001", sd.Owner)
+	assert.Equal(t, "S-1-5-32-545", sd.Group)
+
+	sd.Owner = "SY"
+	uid, gid, err := sd.UnixOwnership(m)
+	assert.NoError(t, err)
+	assert.Equal(t, uint32(0), uid)
+	assert.Equal(t, uint32(100), gid)
+
+	_, err = ParseStaticIdMap(strings.NewReader("uid 1 SY\nuid 1 BA\n"))
+	assert.Error(t, err)
+
+	chain := ChainIdMapper{m, &UnixIdMapper{}}
+	sid, err := chain.UidToSid(1001)
+	assert.NoError(t, err)
+	assert.Equal(t, "S-1-22-1-1001", sid)
+}
@@ -0,0 +1,97 @@
+package winsddlconverter
+
+import "strings"
+
+// TokenMandatoryPolicy is the TOKEN_MANDATORY_POLICY of a token.
+type TokenMandatoryPolicy uint32
+
+const (
+	TOKEN_MANDATORY_POLICY_OFF TokenMandatoryPolicy = 0x0
+	// TOKEN_MANDATORY_POLICY_NO_WRITE_UP enforces the NW policy of object labels
+	TOKEN_MANDATORY_POLICY_NO_WRITE_UP TokenMandatoryPolicy = 0x1
+	// TOKEN_MANDATORY_POLICY_NEW_PROCESS_MIN starts processes at most at the label of their executable
+	TOKEN_MANDATORY_POLICY_NEW_PROCESS_MIN TokenMandatoryPolicy = 0x2
+	// TOKEN_MANDATORY_POLICY_VALID_MASK is the policy of ordinary tokens
+	TOKEN_MANDATORY_POLICY_VALID_MASK = TOKEN_MANDATORY_POLICY_NO_WRITE_UP | TOKEN_MANDATORY_POLICY_NEW_PROCESS_MIN
+)
+
+// IntegrityLevel returns the level of the group with SE_GROUP_INTEGRITY_ENABLED,
+// or MediumIntegrity if the token has none.
+func (t *Token) IntegrityLevel() IntegrityLevel {
+	for _, group := range t.Groups {
+		if group.Attributes&SE_GROUP_INTEGRITY_ENABLED == 0 {
+			continue
+		}
+		if level, err := ParseIntegrityLevel(group.Sid); err == nil {
+			return level
+		}
+	}
+	return MediumIntegrity
+}
+
+// mandatoryPolicy returns the MandatoryPolicy of the token, TOKEN_MANDATORY_POLICY_VALID_MASK if unset.
+func (t *Token) mandatoryPolicy() TokenMandatoryPolicy {
+	if t.MandatoryPolicy == nil {
+		return TOKEN_MANDATORY_POLICY_VALID_MASK
+	}
+	return *t.MandatoryPolicy
+}
+
+// MandatoryLabel returns the level and policy of the first effective ML ACE of the SACL.
+// ok is false if there is none, in which case Windows applies MediumIntegrity with NO_WRITE_UP.
+func (sd *SecurityDescriptor) MandatoryLabel() (level IntegrityLevel, policy AccessMask, ok bool) {
+	if sd.SystemAcl != nil {
+		for i := range sd.SystemAcl.Aces {
+			ace := &sd.SystemAcl.Aces[i]
+			if ace.AceType != SYSTEM_MANDATORY_LABEL_ACE_TYPE || isInheritOnlyAce(ace) {
+				continue
+			}
+			level, err := ParseIntegrityLevel(ace.Sid)
+			if err != nil {
+				continue
+			}
+			return level, ace.AccessMask & (SYSTEM_MANDATORY_LABEL_NO_WRITE_UP | SYSTEM_MANDATORY_LABEL_NO_READ_UP | SYSTEM_MANDATORY_LABEL_NO_EXECUTE_UP), true
+		}
+	}
+	return MediumIntegrity, SYSTEM_MANDATORY_LABEL_NO_WRITE_UP, false
+}
+
+// NewProcessIntegrity returns the integrity level of a process that token starts from the
+// executable sd belongs to. With TOKEN_MANDATORY_POLICY_NEW_PROCESS_MIN a label below the
+// token lowers the process to the label.
+func (sd *SecurityDescriptor) NewProcessIntegrity(token *Token) IntegrityLevel {
+	level := token.IntegrityLevel()
+	if token.mandatoryPolicy()&TOKEN_MANDATORY_POLICY_NEW_PROCESS_MIN == 0 {
+		return level
+	}
+	if label, _, ok := sd.MandatoryLabel(); ok && label < level {
+		return label
+	}
+	return level
+}
+
+// mandatoryDenied returns the rights the mandatory label denies to the token.
+// SYNCHRONIZE is never denied.
+func (e *accessEvaluator) mandatoryDenied() AccessMask {
+	label, policy, _ := e.sd.MandatoryLabel()
+	level := e.token.IntegrityLevel()
+	if level >= label {
+		return 0
+	}
+	var denied AccessMask
+	if policy.Has(SYSTEM_MANDATORY_LABEL_NO_WRITE_UP) && e.token.mandatoryPolicy()&TOKEN_MANDATORY_POLICY_NO_WRITE_UP != 0 {
+		denied |= e.writeRights()
+	}
+	if policy.Has(SYSTEM_MANDATORY_LABEL_NO_READ_UP) {
+		denied |= e.mapping.GenericRead
+	}
+	if policy.Has(SYSTEM_MANDATORY_LABEL_NO_EXECUTE_UP) {
+		denied |= e.mapping.GenericExecute
+	}
+	denied &^= SYNCHRONIZE
+	if denied != 0 {
+		e.traceStep(0, denied, "the %s label with %s denies %s to a token at %s",
+			SidDisplayName(label.Sid()), strings.Join(policy.Names(MandatoryLabelRights), ", "), e.rightNames(denied), SidDisplayName(level.Sid()))
+	}
+	return denied
+}
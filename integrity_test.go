@@ -0,0 +1,73 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func integrityToken(level IntegrityLevel, policy TokenMandatoryPolicy) *Token {
+	return &Token{
+		User: "S-1-5-21-1-2-3-1001",
+		Groups: []TokenGroup{
+			{Sid: "WD", Attributes: SE_GROUP_ENABLED},
+			{Sid: level.Sid(), Attributes: SE_GROUP_INTEGRITY | SE_GROUP_INTEGRITY_ENABLED},
+		},
+		MandatoryPolicy: &policy,
+	}
+}
+
+func TestSecurityDescriptor_AccessCheck_Integrity(t *testing.T) {
+	low := integrityToken(LowIntegrity, TOKEN_MANDATORY_POLICY_VALID_MASK)
+	medium := integrityToken(MediumIntegrity, TOKEN_MANDATORY_POLICY_VALID_MASK)
+
+	tests := []struct {
+		name    string
+		sddl    string
+		token   *Token
+		desired AccessMask
+		status  AccessStatus
+		granted AccessMask
+	}{
+		{"unlabeled object is read up", "O:BAG:SYD:(A;;FA;;;WD)", low, FILE_READ_ACCESS, AccessGranted, FILE_READ_ACCESS},
+		{"unlabeled object is not written up", "O:BAG:SYD:(A;;FA;;;WD)", low, FILE_WRITE_DATA, AccessDenied, 0},
+		{"no write up is not deleted up", "O:BAG:SYD:(A;;FA;;;WD)", low, DELETE, AccessDenied, 0},
+		{"token without no write up policy", "O:BAG:SYD:(A;;FA;;;WD)", integrityToken(LowIntegrity, TOKEN_MANDATORY_POLICY_OFF), FILE_WRITE_DATA, AccessGranted, FILE_WRITE_DATA},
+		{"token without policy is not written up", "O:BAG:SYD:(A;;FA;;;WD)S:(ML;;NW;;;HI)", &Token{User: "S-1-5-21-1-2-3-1001", Groups: []TokenGroup{
+			{Sid: "WD", Attributes: SE_GROUP_ENABLED},
+			{Sid: LowIntegrity.Sid(), Attributes: SE_GROUP_INTEGRITY | SE_GROUP_INTEGRITY_ENABLED},
+		}}, FILE_WRITE_DATA, AccessDenied, 0},
+		{"same level", "O:BAG:SYD:(A;;FA;;;WD)S:(ML;;NW;;;LW)", low, FILE_WRITE_DATA, AccessGranted, FILE_WRITE_DATA},
+		{"token without level is medium", "O:BAG:SYD:(A;;FA;;;WD)", &Token{User: "SY", Groups: []TokenGroup{{Sid: "WD", Attributes: SE_GROUP_ENABLED}}}, FILE_WRITE_DATA, AccessGranted, FILE_WRITE_DATA},
+		{"no read up", "O:BAG:SYD:(A;;FA;;;WD)S:(ML;;NR;;;HI)", medium, FILE_READ_DATA, AccessDenied, 0},
+		{"no read up allows writes", "O:BAG:SYD:(A;;FA;;;WD)S:(ML;;NR;;;HI)", medium, FILE_WRITE_DATA, AccessGranted, FILE_WRITE_DATA},
+		{"no execute up", "O:BAG:SYD:(A;;FA;;;WD)S:(ML;;NX;;;S-1-16-12288)", medium, FILE_EXECUTE, AccessDenied, 0},
+		{"inherit-only label is ignored", "O:BAG:SYD:(A;;FA;;;WD)S:(ML;OICIIO;NW;;;LW)", low, FILE_WRITE_DATA, AccessDenied, 0},
+		{"maximum allowed", "O:BAG:SYD:(A;;FA;;;WD)", low, MAXIMUM_ALLOWED, AccessGranted, 0x1200e9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := ParseSDDL(tt.sddl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := sd.AccessCheck(tt.token, tt.desired, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.status, result.Status)
+			assert.Equal(t, tt.granted, result.GrantedAccess)
+		})
+	}
+}
+
+func TestSecurityDescriptor_NewProcessIntegrity(t *testing.T) {
+	sd, err := ParseSDDL("O:BAG:SYD:(A;;FA;;;WD)S:(ML;;NW;;;LW)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, LowIntegrity, sd.NewProcessIntegrity(integrityToken(HighIntegrity, TOKEN_MANDATORY_POLICY_VALID_MASK)))
+	assert.Equal(t, HighIntegrity, sd.NewProcessIntegrity(integrityToken(HighIntegrity, TOKEN_MANDATORY_POLICY_NO_WRITE_UP)))
+
+	sd.SystemAcl = nil
+	assert.Equal(t, HighIntegrity, sd.NewProcessIntegrity(integrityToken(HighIntegrity, TOKEN_MANDATORY_POLICY_VALID_MASK)))
+}
@@ -0,0 +1,92 @@
+package winsddlconverter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Levels of an object type list
+const (
+	ACCESS_OBJECT_GUID       = 0
+	ACCESS_PROPERTY_SET_GUID = 1
+	ACCESS_PROPERTY_GUID     = 2
+	ACCESS_MAX_LEVEL         = 4
+)
+
+// ObjectTypeNode is an entry of an object type list, like OBJECT_TYPE_LIST. The list is the
+// object class at ACCESS_OBJECT_GUID followed by its property sets and properties, each entry
+// being a child of the closest earlier entry of a lower level.
+type ObjectTypeNode struct {
+	Level uint16 `json:"level"`
+	// ObjectType is a GUID string, as in Ace.ObjectType
+	ObjectType string `json:"objectType"`
+}
+
+// ObjectTypeResult is the access to an entry of the object type list.
+type ObjectTypeResult struct {
+	ObjectType    string       `json:"objectType"`
+	Status        AccessStatus `json:"status"`
+	GrantedAccess AccessMask   `json:"grantedAccess"`
+	Missing       AccessMask   `json:"missing"`
+}
+
+// setObjectTypes validates the list and stores it with the parent of each entry.
+func (e *accessEvaluator) setObjectTypes(objectTypes []ObjectTypeNode) error {
+	if len(objectTypes) == 0 {
+		return fmt.Errorf("empty object type list")
+	}
+	if objectTypes[0].Level != ACCESS_OBJECT_GUID {
+		return fmt.Errorf("object type list must start at level %d", ACCESS_OBJECT_GUID)
+	}
+	parents := make([]int, len(objectTypes))
+	parents[0] = -1
+	for i := 1; i < len(objectTypes); i++ {
+		level := objectTypes[i].Level
+		if level == ACCESS_OBJECT_GUID || level > ACCESS_MAX_LEVEL || level > objectTypes[i-1].Level+1 {
+			return fmt.Errorf("object type list entry %d has invalid level %d", i, level)
+		}
+		parent := i - 1
+		for objectTypes[parent].Level >= level {
+			parent = parents[parent]
+		}
+		parents[i] = parent
+	}
+	e.objectTypes = objectTypes
+	e.parents = parents
+	return nil
+}
+
+// findObjectType returns the index of the entry of a GUID, or -1.
+func (e *accessEvaluator) findObjectType(guid string) int {
+	for i, node := range e.objectTypes {
+		if strings.EqualFold(node.ObjectType, guid) {
+			return i
+		}
+	}
+	return -1
+}
+
+// subtreeEnd returns the index after the last descendant of an entry.
+func (e *accessEvaluator) subtreeEnd(index int) int {
+	end := index + 1
+	for end < len(e.objectTypes) && e.objectTypes[end].Level > e.objectTypes[index].Level {
+		end++
+	}
+	return end
+}
+
+// AccessCheckByType evaluates access to an object and its property sets and properties,
+// like AccessCheckByTypeResultList. Object ACEs apply to the entry of their object type and
+// its descendants. A denied right is also denied to the ancestors, and a right granted to
+// all children of an entry is granted to the entry. ResultList holds the result of each entry
+// and the other fields that of the object, the first entry.
+func (sd *SecurityDescriptor) AccessCheckByType(token *Token, desired AccessMask, objectTypes []ObjectTypeNode, opts *AccessCheckOptions) (*AccessCheckResult, error) {
+	e, err := newAccessEvaluator(sd, token, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.setObjectTypes(objectTypes); err != nil {
+		return nil, err
+	}
+	return e.check(desired, true), nil
+}
@@ -0,0 +1,115 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSecurityDescriptor_AccessCheckByType(t *testing.T) {
+	const (
+		helpdesk            = "S-1-5-21-1-2-3-1105"
+		userClass           = "bf967aba-0de6-11d0-a285-00aa003049e2"
+		resetPassword       = "00299570-246d-11d0-a768-00aa006e0529"
+		personalInformation = "77b5b886-944a-11d1-aebd-0000f80367c1"
+		telephoneNumber     = "bf967a49-0de6-11d0-a285-00aa003049e2"
+		streetAddress       = "bf967a3a-0de6-11d0-a285-00aa003049e2"
+	)
+	objectTypes := []ObjectTypeNode{
+		{Level: ACCESS_OBJECT_GUID, ObjectType: userClass},
+		{Level: ACCESS_PROPERTY_SET_GUID, ObjectType: resetPassword},
+		{Level: ACCESS_PROPERTY_SET_GUID, ObjectType: personalInformation},
+		{Level: ACCESS_PROPERTY_GUID, ObjectType: telephoneNumber},
+		{Level: ACCESS_PROPERTY_GUID, ObjectType: streetAddress},
+	}
+	token := &Token{User: "S-1-5-21-1-2-3-1001", Groups: []TokenGroup{
+		{Sid: "AU", Attributes: SE_GROUP_ENABLED},
+		{Sid: helpdesk, Attributes: SE_GROUP_ENABLED},
+	}}
+
+	tests := []struct {
+		name    string
+		dacl    string
+		desired AccessMask
+		granted []AccessMask
+	}{
+		{
+			"reset password inherited from the OU",
+			"(OA;ID;CR;" + resetPassword + ";" + userClass + ";" + helpdesk + ")",
+			0x100,
+			[]AccessMask{0, 0x100, 0, 0, 0},
+		},
+		{
+			"property set grants its properties",
+			"(OA;;RP;" + personalInformation + ";;" + helpdesk + ")",
+			0x10,
+			[]AccessMask{0, 0, 0x10, 0x10, 0x10},
+		},
+		{
+			"property grant does not reach the property set",
+			"(OA;;WP;" + telephoneNumber + ";;" + helpdesk + ")",
+			0x20,
+			[]AccessMask{0, 0, 0, 0x20, 0},
+		},
+		{
+			"grant to all children reaches the parent",
+			"(OA;;RP;" + resetPassword + ";;AU)(OA;;RP;" + personalInformation + ";;AU)",
+			0x10,
+			[]AccessMask{0x10, 0x10, 0x10, 0x10, 0x10},
+		},
+		{
+			"property deny reaches the ancestors",
+			"(OD;;WP;" + telephoneNumber + ";;AU)(A;;RPWP;;;" + helpdesk + ")",
+			0x20,
+			[]AccessMask{0, 0x20, 0, 0, 0x20},
+		},
+		{
+			"object class ace applies to all",
+			"(OA;;RPWP;" + userClass + ";;AU)",
+			0x30,
+			[]AccessMask{0x30, 0x30, 0x30, 0x30, 0x30},
+		},
+		{
+			"object type not in the list",
+			"(OA;;RP;bf967950-0de6-11d0-a285-00aa003049e2;;AU)",
+			0x10,
+			[]AccessMask{0, 0, 0, 0, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := ParseSDDL("O:S-1-5-21-1-2-3-512G:S-1-5-21-1-2-3-512D:" + tt.dacl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := sd.AccessCheckByType(token, tt.desired, objectTypes, &AccessCheckOptions{Profile: DirectoryServiceRights})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var granted []AccessMask
+			for i, node := range result.ResultList {
+				assert.Equal(t, objectTypes[i].ObjectType, node.ObjectType)
+				assert.Equal(t, node.GrantedAccess != 0, node.Status == AccessGranted)
+				granted = append(granted, node.GrantedAccess)
+			}
+			assert.Equal(t, tt.granted, granted)
+			assert.Equal(t, result.ResultList[0].GrantedAccess, result.GrantedAccess)
+		})
+	}
+}
+
+func TestSecurityDescriptor_AccessCheckByType_InvalidList(t *testing.T) {
+	sd, err := ParseSDDL("O:S-1-5-21-1-2-3-512G:S-1-5-21-1-2-3-512D:(A;;RP;;;AU)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := &Token{User: "S-1-5-21-1-2-3-1001"}
+	for _, list := range [][]ObjectTypeNode{
+		nil,
+		{{Level: ACCESS_PROPERTY_SET_GUID}},
+		{{Level: ACCESS_OBJECT_GUID}, {Level: ACCESS_PROPERTY_GUID}},
+		{{Level: ACCESS_OBJECT_GUID}, {Level: ACCESS_OBJECT_GUID}},
+	} {
+		_, err := sd.AccessCheckByType(token, 0x10, list, nil)
+		assert.Error(t, err)
+	}
+}
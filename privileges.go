@@ -0,0 +1,53 @@
+package winsddlconverter
+
+import "strings"
+
+// Privileges that grant access regardless of the DACL
+const (
+	SE_BACKUP_NAME         = "SeBackupPrivilege"
+	SE_RESTORE_NAME        = "SeRestorePrivilege"
+	SE_TAKE_OWNERSHIP_NAME = "SeTakeOwnershipPrivilege"
+	SE_SECURITY_NAME       = "SeSecurityPrivilege"
+)
+
+// Rights granted with backup intent, as by FILE_FLAG_BACKUP_SEMANTICS
+const (
+	backupAccess  = READ_CONTROL | ACCESS_SYSTEM_SECURITY | 0x00120089 | 0x20 // FILE_GENERIC_READ | FILE_TRAVERSE
+	restoreAccess = WRITE_DAC | WRITE_OWNER | ACCESS_SYSTEM_SECURITY | DELETE |
+		0x00120116 | 0x2 | 0x4 // FILE_GENERIC_WRITE | FILE_ADD_FILE | FILE_ADD_SUBDIRECTORY
+)
+
+// PrivilegeSet holds the names of the enabled privileges of a token.
+type PrivilegeSet []string
+
+// Has reports whether the privilege is enabled. Names are case-insensitive, like LookupPrivilegeValue.
+func (p PrivilegeSet) Has(name string) bool {
+	for _, privilege := range p {
+		if strings.EqualFold(privilege, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// privilegeAccess returns the rights of wanted that the privileges of the token grant.
+// Like the owner rights, the DACL cannot deny them.
+func (e *accessEvaluator) privilegeAccess(wanted AccessMask) AccessMask {
+	var granted AccessMask
+	use := func(name string, rights AccessMask) {
+		rights &= wanted &^ granted
+		if rights == 0 || !e.token.Privileges.Has(name) {
+			return
+		}
+		granted |= rights
+		e.privilegesUsed = append(e.privilegesUsed, name)
+		e.traceStep(rights, 0, "%s grants %s", name, e.rightNames(rights))
+	}
+	if e.opts.BackupIntent {
+		use(SE_BACKUP_NAME, backupAccess)
+		use(SE_RESTORE_NAME, restoreAccess)
+	}
+	use(SE_TAKE_OWNERSHIP_NAME, WRITE_OWNER)
+	use(SE_SECURITY_NAME, ACCESS_SYSTEM_SECURITY)
+	return granted
+}
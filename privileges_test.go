@@ -0,0 +1,59 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSecurityDescriptor_AccessCheck_Privileges(t *testing.T) {
+	const sddl = "O:BAG:SYD:(D;;FA;;;WD)"
+	token := func(privileges ...string) *Token {
+		return &Token{
+			User:       "S-1-5-21-1-2-3-1001",
+			Groups:     []TokenGroup{{Sid: "WD", Attributes: SE_GROUP_ENABLED}},
+			Privileges: privileges,
+		}
+	}
+	backup := &AccessCheckOptions{BackupIntent: true}
+
+	tests := []struct {
+		name    string
+		token   *Token
+		desired AccessMask
+		opts    *AccessCheckOptions
+		status  AccessStatus
+		granted AccessMask
+		used    []string
+	}{
+		{"backup without intent", token(SE_BACKUP_NAME), GENERIC_READ, nil, AccessDenied, 0, nil},
+		{"backup with intent", token(SE_BACKUP_NAME), GENERIC_READ, backup, AccessGranted, 0x00120089, []string{SE_BACKUP_NAME}},
+		{"backup does not write", token("sebackupprivilege"), FILE_WRITE_DATA, backup, AccessDenied, 0, []string{SE_BACKUP_NAME}},
+		{"restore with intent", token(SE_RESTORE_NAME), GENERIC_WRITE | DELETE | WRITE_DAC, backup, AccessGranted, 0x00120116 | DELETE | WRITE_DAC, []string{SE_RESTORE_NAME}},
+		{"backup and restore maximum allowed", token(SE_BACKUP_NAME, SE_RESTORE_NAME), MAXIMUM_ALLOWED, backup, AccessGranted,
+			0x001201bf | STANDARD_RIGHTS_REQUIRED, []string{SE_BACKUP_NAME, SE_RESTORE_NAME}},
+		{"take ownership", token(SE_TAKE_OWNERSHIP_NAME), WRITE_OWNER, nil, AccessGranted, WRITE_OWNER, []string{SE_TAKE_OWNERSHIP_NAME}},
+		{"take ownership maximum allowed", token(SE_TAKE_OWNERSHIP_NAME), MAXIMUM_ALLOWED, nil, AccessGranted, WRITE_OWNER, []string{SE_TAKE_OWNERSHIP_NAME}},
+		{"take ownership of other rights", token(SE_TAKE_OWNERSHIP_NAME), WRITE_OWNER | WRITE_DAC, nil, AccessDenied, 0, []string{SE_TAKE_OWNERSHIP_NAME}},
+		{"security", token(SE_SECURITY_NAME), ACCESS_SYSTEM_SECURITY, nil, AccessGranted, ACCESS_SYSTEM_SECURITY, []string{SE_SECURITY_NAME}},
+		{"security not held", token(), ACCESS_SYSTEM_SECURITY, nil, AccessPrivilegeNotHeld, 0, nil},
+		{"security not in maximum allowed", token(SE_SECURITY_NAME), MAXIMUM_ALLOWED, nil, AccessDenied, 0, nil},
+		{"security with maximum allowed", token(SE_SECURITY_NAME), MAXIMUM_ALLOWED | ACCESS_SYSTEM_SECURITY, nil, AccessGranted,
+			ACCESS_SYSTEM_SECURITY, []string{SE_SECURITY_NAME}},
+		{"security with maximum allowed not held", token(), MAXIMUM_ALLOWED | ACCESS_SYSTEM_SECURITY, nil, AccessPrivilegeNotHeld, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := ParseSDDL(sddl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := sd.AccessCheck(tt.token, tt.desired, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.status, result.Status)
+			assert.Equal(t, tt.granted, result.GrantedAccess)
+			assert.Equal(t, tt.used, result.PrivilegesUsed)
+		})
+	}
+}
@@ -4,52 +4,169 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
-	"strconv"
 	"strings"
+	"unicode"
 )
 
-var sddlAclPattern = regexp.MustCompile("^(D:|S:)(\\w*)((?:\\([^)]+\\))+)")
-var sddlControlFlagsPattern = regexp.MustCompile("^(P|AI)")
+var sddlAclPattern = regexp.MustCompile("^(D:|S:)((?:P|AI|AR|NO_ACCESS_CONTROL)*)")
+var sddlLenientAclPattern = regexp.MustCompile("(?i)^(D:|S:)\\s*((?:(?:P|AI|AR|NO_ACCESS_CONTROL)\\s*)*)")
+var sddlControlFlagsPattern = regexp.MustCompile("^(P|AI|AR|NO_ACCESS_CONTROL)")
+
+// ParseOptions controls how ParseSDDLWithOptions reads SDDL.
+// Sections may appear in any order in every mode.
+type ParseOptions struct {
+	// Lenient accepts whitespace between tokens and lowercase tokens, as Windows does
+	Lenient bool
+	// Strict rejects duplicate sections, unknown ACE flags and access rights,
+	// extra ACE fields and empty ACE SIDs
+	Strict bool
+}
+
+// LenientParseOptions returns options for hand-written SDDL.
+func LenientParseOptions() *ParseOptions {
+	return &ParseOptions{Lenient: true}
+}
+
+// StrictParseOptions returns options that reject anything ParseSDDL would guess at.
+func StrictParseOptions() *ParseOptions {
+	return &ParseOptions{Strict: true}
+}
 
 func ParseSDDL(sddl string) (*SecurityDescriptor, error) {
+	return ParseSDDLWithOptions(sddl, &ParseOptions{})
+}
+
+func ParseSDDLWithOptions(sddl string, opts *ParseOptions) (*SecurityDescriptor, error) {
 	var err error
 
 	sd := &SecurityDescriptor{}
+	syntax := &SddlSyntax{Text: sddl}
+	seen := map[SecurityDescriptorPart]bool{}
+	checkDuplicate := func(part SecurityDescriptorPart) error {
+		if opts.Strict && seen[part] {
+			return fmt.Errorf("duplicate %s section", part)
+		}
+		seen[part] = true
+		return nil
+	}
+
+	aclPattern := sddlAclPattern
+	if opts.Lenient {
+		aclPattern = sddlLenientAclPattern
+	}
 
 	sr := &stringReader{s: sddl}
-	for sr.Len() > 0 {
+	for {
+		if opts.Lenient {
+			sr.SkipSpace()
+		}
+		if sr.Len() == 0 {
+			break
+		}
+		start := sr.r
 		c := sr.ReadChars(2)
+		if opts.Lenient {
+			c = strings.ToUpper(c)
+		}
 		switch c {
 		case "O:":
-			sd.Owner, err = sr.ReadSid()
+			if err = checkDuplicate(PartOwner); err != nil {
+				return nil, err
+			}
+			if opts.Lenient {
+				sr.SkipSpace()
+			}
+			sd.Owner, err = sr.ReadSid(opts.Lenient)
 			if err != nil {
 				return nil, err
 			}
+			syntax.Sections = append(syntax.Sections, SddlSectionSyntax{
+				Part:   PartOwner,
+				Span:   SddlSpan{start, sr.r},
+				Header: SddlSpan{start, start + 2},
+				Sid:    sd.Owner,
+			})
 		case "G:":
-			sd.Group, err = sr.ReadSid()
+			if err = checkDuplicate(PartGroup); err != nil {
+				return nil, err
+			}
+			if opts.Lenient {
+				sr.SkipSpace()
+			}
+			sd.Group, err = sr.ReadSid(opts.Lenient)
 			if err != nil {
 				return nil, err
 			}
+			syntax.Sections = append(syntax.Sections, SddlSectionSyntax{
+				Part:   PartGroup,
+				Span:   SddlSpan{start, sr.r},
+				Header: SddlSpan{start, start + 2},
+				Sid:    sd.Group,
+			})
 		default:
-			remaining := c + sr.Remaining()
-			matches := sddlAclPattern.FindStringSubmatchIndex(remaining)
+			sr.r = start
+			remaining := sr.Remaining()
+			matches := aclPattern.FindStringSubmatchIndex(remaining)
 			if len(matches) == 0 {
-				return nil, errors.New("acl parse failed: " + sr.Remaining())
+				return nil, errors.New("acl parse failed: " + remaining)
 			}
-			sr.Consume(matches[1] - 2)
+			aceSpans, end, err := scanSddlAces(remaining, matches[1], opts.Lenient)
+			if err != nil {
+				return nil, err
+			}
+			sr.Consume(end)
 
-			// (D:|S:)(\\w*)(\\([^)]+\\))+"
-			first := remaining[matches[2]:matches[3]]
-			controlFlags, err := parseControlStringsFromSDDL(remaining[matches[4]:matches[5]])
+			// (D:|S:)(flags)
+			first := strings.ToUpper(remaining[matches[2]:matches[3]])
+			controlString := remaining[matches[4]:matches[5]]
+			if opts.Lenient {
+				controlString = strings.ToUpper(strings.Join(strings.Fields(controlString), ""))
+			}
+			controlFlags, err := parseControlStringsFromSDDL(controlString)
+			if err != nil {
+				return nil, err
+			}
+			if first == "D:" {
+				err = checkDuplicate(PartDacl)
+			} else {
+				err = checkDuplicate(PartSacl)
+			}
 			if err != nil {
 				return nil, err
 			}
-			body := remaining[matches[6]:matches[7]]
 
-			acl, err := parseAclFromSDDL(body)
+			var aceStrings []string
+			for _, span := range aceSpans {
+				aceStrings = append(aceStrings, remaining[span.Start:span.End])
+			}
+			acl, err := parseAclFromSDDL(aceStrings, opts)
 			if err != nil {
 				return nil, err
 			}
+			nullAcl := false
+			for _, flag := range controlFlags {
+				if flag == "NO_ACCESS_CONTROL" {
+					nullAcl = true
+				}
+			}
+			if nullAcl {
+				if len(acl.Aces) > 0 {
+					return nil, errors.New("acl parse failed: NO_ACCESS_CONTROL with ACEs")
+				}
+				acl = nil
+			}
+			section := SddlSectionSyntax{
+				Span:    SddlSpan{start, start + end},
+				Header:  SddlSpan{start, start + matches[5]},
+				NullAcl: nullAcl,
+			}
+			if acl != nil {
+				for i, ace := range acl.Aces {
+					span := SddlSpan{start + aceSpans[i].Start, start + aceSpans[i].End}
+					section.Aces = append(section.Aces, SddlAceSyntax{Span: span, Ace: cloneAce(ace)})
+				}
+			}
+			before := sd.Control
 
 			if first == "D:" {
 				for _, flag := range controlFlags {
@@ -58,9 +175,14 @@ func ParseSDDL(sddl string) (*SecurityDescriptor, error) {
 						sd.Control |= SE_DACL_PROTECTED
 					case "AI":
 						sd.Control |= SE_DACL_AUTO_INHERITED
+					case "AR":
+						sd.Control |= SE_DACL_AUTO_INHERIT_REQ
+					case "NO_ACCESS_CONTROL":
+						sd.Control |= SE_DACL_PRESENT
 					}
 				}
 				sd.DiscretionaryAcl = acl
+				section.Part = PartDacl
 			} else if first == "S:" {
 				for _, flag := range controlFlags {
 					switch flag {
@@ -68,15 +190,23 @@ func ParseSDDL(sddl string) (*SecurityDescriptor, error) {
 						sd.Control |= SE_SACL_PROTECTED
 					case "AI":
 						sd.Control |= SE_SACL_AUTO_INHERITED
+					case "AR":
+						sd.Control |= SE_SACL_AUTO_INHERIT_REQ
+					case "NO_ACCESS_CONTROL":
+						sd.Control |= SE_SACL_PRESENT
 					}
 				}
 				sd.SystemAcl = acl
+				section.Part = PartSacl
 			} else {
 				return nil, errors.New("acl parse failed: invalid prefix: '" + first + "'")
 			}
+			section.Control = (sd.Control &^ before) & aclControlMask(section.Part)
+			syntax.Sections = append(syntax.Sections, section)
 		}
 	}
-	
+	sd.Syntax = syntax
+
 	return sd, nil
 }
 
@@ -94,39 +224,80 @@ func parseControlStringsFromSDDL(input string) ([]string, error) {
 	return flags, nil
 }
 
-func parseAclFromSDDL(aclString string) (*Acl, error) {
-	acl := &Acl{AclRevision: 2, Aces: []Ace{}}
-
-	// Check for ACL flags
-	parts := strings.SplitN(aclString, "(", 2)
-	if len(parts) > 1 {
-		// TODO: Parse ACL flags if needed
-		aclString = parts[1]
+// scanSddlAces returns the spans of the parenthesized ACEs that follow offset in s, and the
+// end of the last one. Conditional expressions nest parentheses and quote strings, so the
+// closing parenthesis of an ACE is found by counting them outside of quotes.
+func scanSddlAces(s string, offset int, lenient bool) ([]SddlSpan, int, error) {
+	var spans []SddlSpan
+	i := offset
+	for {
+		if lenient {
+			for i < len(s) && unicode.IsSpace(rune(s[i])) {
+				i++
+			}
+		}
+		if i >= len(s) || s[i] != '(' {
+			return spans, i, nil
+		}
+		start := i
+		depth := 0
+		for ; i < len(s); i++ {
+			switch s[i] {
+			case '"':
+				end := strings.IndexByte(s[i+1:], '"')
+				if end < 0 {
+					return nil, 0, errors.New("acl parse failed: unterminated string: " + s[start:])
+				}
+				i += end + 1
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if depth == 0 {
+				break
+			}
+		}
+		if depth != 0 {
+			return nil, 0, errors.New("acl parse failed: unterminated ACE: " + s[start:])
+		}
+		i++
+		spans = append(spans, SddlSpan{start, i})
 	}
+}
+
+func parseAclFromSDDL(aceStrings []string, opts *ParseOptions) (*Acl, error) {
+	acl := &Acl{AclRevision: ACL_REVISION, Aces: []Ace{}}
 
-	aceStrings := strings.Split(aclString, "(")
 	for _, aceString := range aceStrings {
-		if aceString == "" {
-			continue
-		}
-		ace, err := parseAceFromSDDL(aceString)
+		ace, err := parseAceFromSDDL(aceString, opts)
 		if err != nil {
 			return nil, fmt.Errorf("error parsing ACE: %v", err)
 		}
 		acl.Aces = append(acl.Aces, *ace)
 	}
+	acl.AclRevision = acl.RequiredRevision()
 
 	return acl, nil
 }
 
-func parseAceFromSDDL(aceString string) (*Ace, error) {
+func parseAceFromSDDL(aceString string, opts *ParseOptions) (*Ace, error) {
 	var err error
 
-	aceString = strings.Trim(aceString, "()")
-	parts := strings.Split(aceString, ";")
+	aceString = aceString[1 : len(aceString)-1]
+	// the seventh field, the condition or resource attribute, may contain semicolons
+	parts := strings.SplitN(aceString, ";", 7)
 	if len(parts) < 6 {
 		return nil, fmt.Errorf("invalid ACE format: not enough components: " + aceString)
 	}
+	if opts.Lenient {
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		for _, i := range []int{0, 1, 2, 5} {
+			parts[i] = strings.ToUpper(parts[i])
+		}
+	}
 
 	ace := &Ace{}
 
@@ -135,45 +306,88 @@ func parseAceFromSDDL(aceString string) (*Ace, error) {
 		return nil, err
 	}
 
-	ace.AceFlags = parseAceFlagsFromSDDL(parts[1])
-	accessMask, err := parseAccessMaskFromSDDL(parts[2])
+	ace.AceFlags, err = parseAceFlagsFromSDDL(parts[1], opts.Strict)
+	if err != nil {
+		return nil, err
+	}
+	ace.AccessMask, err = parseAccessRightsFromSDDL(parts[2], opts.Strict)
 	if err != nil {
 		return nil, fmt.Errorf("error parsing access mask: %v", err)
 	}
-	ace.AccessMask = accessMask
+
+	if parts[3] != "" || parts[4] != "" {
+		if !ace.AceType.IsObject() {
+			return nil, fmt.Errorf("object GUID on non-object ACE: %s", aceString)
+		}
+		for _, guid := range parts[3:5] {
+			if guid == "" {
+				continue
+			}
+			if _, err := marshalGuid(guid); err != nil {
+				return nil, err
+			}
+		}
+		ace.ObjectType = strings.ToLower(parts[3])
+		ace.InheritedObjectType = strings.ToLower(parts[4])
+	}
+	if opts.Strict {
+		if parts[5] == "" {
+			return nil, fmt.Errorf("invalid ACE format: empty SID: " + aceString)
+		}
+		if _, err := MarshalSidFromString(parts[5]); err != nil {
+			return nil, fmt.Errorf("invalid ACE SID %q: %v", parts[5], err)
+		}
+	}
 	ace.Sid = parts[5]
 
+	if len(parts) == 7 {
+		data := parts[6]
+		if opts.Lenient {
+			data = strings.TrimSpace(data)
+		}
+		switch {
+		case ace.AceType.IsCallback():
+			err = ace.SetCondition(data)
+		case ace.AceType == SYSTEM_RESOURCE_ATTRIBUTE_ACE_TYPE:
+			err = ace.setResourceAttributeSddl(data)
+		case opts.Strict:
+			err = fmt.Errorf("invalid ACE format: too many components: " + aceString)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return ace, nil
 }
 
-func parseAceFlagsFromSDDL(flagsString string) []string {
-	var flags []string
+// parseAceFlagsFromSDDL is ParseAceFlags ignoring unknown flags unless strict.
+func parseAceFlagsFromSDDL(flagsString string, strict bool) (AceFlags, error) {
+	if strict {
+		return ParseAceFlags(flagsString)
+	}
+	if len(flagsString)%2 != 0 {
+		return 0, fmt.Errorf("invalid ACE flags: %q", flagsString)
+	}
+	var flags AceFlags
 	for i := 0; i < len(flagsString); i += 2 {
-		flags = append(flags, flagsString[i:i+2])
+		flag, _ := parseAceFlagToken(flagsString[i : i+2])
+		flags |= flag
 	}
-	return flags
+	return flags, nil
 }
 
-func parseAccessMaskFromSDDL(maskString string) (AccessMaskDetail, error) {
-	if strings.HasPrefix(maskString, "0x") {
-		mask, err := strconv.ParseUint(maskString[2:], 16, 32)
-		if err != nil {
-			return AccessMaskDetail{}, fmt.Errorf("invalid hexadecimal access mask: %v", err)
-		}
-		return ParseAccessMask(uint32(mask)), nil
+// parseAccessRightsFromSDDL is ParseAccessRights ignoring unknown tokens unless strict.
+func parseAccessRightsFromSDDL(rights string, strict bool) (AccessMask, error) {
+	if strict || strings.HasPrefix(rights, "0x") || strings.HasPrefix(rights, "0X") {
+		return ParseAccessRights(rights)
 	}
-
-	var flags []string
-	for i := 0; i < len(maskString); i += 2 {
-		if i+2 <= len(maskString) {
-			flags = append(flags, maskString[i:i+2])
-		}
+	if len(rights)%2 != 0 {
+		return 0, fmt.Errorf("invalid access rights: %q", rights)
 	}
-
-	detail := AccessMaskDetail{
-		Flags:      flags,
-		HasUnknown: false,
+	var mask AccessMask
+	for i := 0; i < len(rights); i += 2 {
+		mask |= AccessMask(accessRightTokens[rights[i:i+2]])
 	}
-	detail.Mask = EncodeAccessMask(&detail)
-	return detail, nil
+	return mask, nil
 }
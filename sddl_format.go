@@ -0,0 +1,417 @@
+package winsddlconverter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MaskStyle selects how access masks are written.
+type MaskStyle uint8
+
+const (
+	// MaskStyleAuto writes tokens, or hex when the mask has bits without a token
+	MaskStyleAuto MaskStyle = iota
+	// MaskStyleHex always writes hex
+	MaskStyleHex
+	// MaskStyleTokens also writes the registry aliases, the directory service tokens of object
+	// specific rights and the mandatory label policy, as Windows does, or hex when the mask has
+	// bits without a token
+	MaskStyleTokens
+)
+
+// AceFlagOrder selects the order ACE flags are written in.
+type AceFlagOrder uint8
+
+const (
+	// AceFlagOrderKeep writes the flags of unchanged ACEs read by ParseSDDL in the order they
+	// were read, see SecurityDescriptor.Syntax, and the flags of other ACEs in bit order
+	AceFlagOrderKeep AceFlagOrder = iota
+	// AceFlagOrderCanonical writes OI CI NP IO ID CR SA FA, as Windows does
+	AceFlagOrderCanonical
+	// AceFlagOrderAlphabetical sorts the flags by name
+	AceFlagOrderAlphabetical
+)
+
+// WindowsVersion is a _WIN32_WINNT value.
+type WindowsVersion uint16
+
+const (
+	Windows2000       WindowsVersion = 0x0500
+	WindowsXP         WindowsVersion = 0x0501
+	WindowsServer2003 WindowsVersion = 0x0502
+	WindowsVista      WindowsVersion = 0x0600
+	Windows7          WindowsVersion = 0x0601
+	Windows8          WindowsVersion = 0x0602
+	Windows10         WindowsVersion = 0x0a00
+)
+
+// Windows version that introduced each SID alias; aliases not listed exist since Windows 2000
+var sidAliasMinVersion = map[string]WindowsVersion{
+	"LS": WindowsXP,
+	"NS": WindowsXP,
+	"RD": WindowsXP,
+	"NO": WindowsXP,
+	"MU": WindowsVista,
+	"LU": WindowsVista,
+	"IS": WindowsVista,
+	"CY": WindowsVista,
+	"ER": WindowsVista,
+	"CD": WindowsVista,
+	"OW": WindowsVista,
+	"AC": Windows8,
+	"LW": WindowsVista,
+	"ME": WindowsVista,
+	"MP": WindowsVista,
+	"HI": WindowsVista,
+	"SI": WindowsVista,
+}
+
+// FormatOptions controls how a descriptor is converted to SDDL.
+type FormatOptions struct {
+	// NumericSids writes every SID as S-1-..., never as an alias
+	NumericSids bool
+	// TargetVersion avoids aliases the given Windows version does not know. Zero allows all aliases.
+	TargetVersion WindowsVersion
+	MaskStyle     MaskStyle
+	UppercaseHex  bool
+	AceFlagOrder  AceFlagOrder
+	// Pretty writes each section and ACE on its own line, ACEs indented by Indent.
+	// The result is meant for reading and is not valid SDDL.
+	Pretty bool
+	Indent string
+	// Comments adds a description after each line in Pretty mode
+	Comments bool
+	// PreserveSpelling writes the parts left unchanged since ParseSDDL exactly as they were read,
+	// see SecurityDescriptor.Syntax. It has no effect with Pretty.
+	PreserveSpelling bool
+}
+
+// DefaultFormatOptions returns the options used by ToSddl.
+func DefaultFormatOptions() *FormatOptions {
+	return &FormatOptions{}
+}
+
+// PrettyFormatOptions returns options for a commented, multi-line listing for code review.
+func PrettyFormatOptions() *FormatOptions {
+	return &FormatOptions{
+		Pretty:       true,
+		Indent:       "    ",
+		Comments:     true,
+		AceFlagOrder: AceFlagOrderCanonical,
+	}
+}
+
+func (o *FormatOptions) hex(v uint32) string {
+	if o.UppercaseHex {
+		return fmt.Sprintf("0x%X", v)
+	}
+	return fmt.Sprintf("0x%x", v)
+}
+
+// formatSid writes an owner, group or ACE SID. ACE SIDs are written as stored unless
+// NumericSids or TargetVersion require otherwise, owner and group use an alias when one exists.
+func (o *FormatOptions) formatSid(sid string, preferAlias bool) string {
+	if o.NumericSids {
+		return GetRawSid(sid)
+	}
+	if preferAlias {
+		sid = RawSidToString(sid)
+	}
+	if o.TargetVersion != 0 {
+		if version, ok := sidAliasMinVersion[sid]; ok && version > o.TargetVersion {
+			return GetRawSid(sid)
+		}
+	}
+	return sid
+}
+
+func (o *FormatOptions) formatMask(ace *Ace) string {
+	if o.MaskStyle != MaskStyleHex {
+		if tokens, ok := aceMaskTokens(ace, o.MaskStyle == MaskStyleTokens); ok {
+			return strings.Join(tokens, "")
+		}
+	}
+	return o.hex(uint32(ace.AccessMask))
+}
+
+// aceMaskTokens returns the SDDL tokens of the mask of an ACE. It reports false if some
+// bits have no token. allTokens is MaskStyleTokens, which reads mandatory label masks as
+// the label policy.
+func aceMaskTokens(ace *Ace, allTokens bool) ([]string, bool) {
+	if allTokens && ace.AceType == SYSTEM_MANDATORY_LABEL_ACE_TYPE {
+		return labelMaskTokens(uint32(ace.AccessMask))
+	}
+	detail := parseAccessMask(uint32(ace.AccessMask), allTokens)
+	return detail.Flags, !detail.HasUnknown
+}
+
+func (o *FormatOptions) formatAceFlags(flags AceFlags) string {
+	tokens := flags.Tokens()
+	if o.AceFlagOrder == AceFlagOrderAlphabetical {
+		sort.Strings(tokens)
+	}
+	return strings.Join(tokens, "")
+}
+
+func (o *FormatOptions) FormatAce(ace *Ace) string {
+	return o.formatAce(ace, "")
+}
+
+// formatAce writes an ACE with the flags spelled, if not empty.
+func (o *FormatOptions) formatAce(ace *Ace, spelled string) string {
+	var builder strings.Builder
+
+	builder.WriteString("(")
+	builder.WriteString(ace.AceType.String())
+	builder.WriteString(";")
+	if spelled != "" {
+		builder.WriteString(spelled)
+	} else {
+		builder.WriteString(o.formatAceFlags(ace.AceFlags))
+	}
+	builder.WriteString(";")
+	builder.WriteString(o.formatMask(ace))
+	builder.WriteString(";")
+	builder.WriteString(ace.ObjectType)
+	builder.WriteString(";")
+	builder.WriteString(ace.InheritedObjectType)
+	builder.WriteString(";")
+	builder.WriteString(o.formatSid(ace.Sid, false))
+	if data := ace.applicationDataSddl(); data != "" {
+		builder.WriteString(";")
+		builder.WriteString(data)
+	}
+	builder.WriteString(")")
+
+	return builder.String()
+}
+
+// applicationDataSddl returns the condition or resource attribute of an ACE in SDDL, or
+// nothing if the application data has neither.
+func (ace *Ace) applicationDataSddl() string {
+	var text string
+	var err error
+	switch {
+	case ace.IsConditional():
+		text, err = ace.Condition()
+	case ace.AceType == SYSTEM_RESOURCE_ATTRIBUTE_ACE_TYPE && len(ace.ApplicationData) > 0:
+		var claim *Claim
+		if claim, err = ace.ResourceAttribute(); err == nil {
+			text, err = formatResourceAttribute(claim)
+		}
+	}
+	if err != nil {
+		return ""
+	}
+	return text
+}
+
+func (o *FormatOptions) FormatAcl(acl *Acl) string {
+	return o.formatAcl(acl, nil)
+}
+
+// formatAcl writes the ACEs of acl, with the flags of spelled where it is not empty.
+func (o *FormatOptions) formatAcl(acl *Acl, spelled []string) string {
+	var builder strings.Builder
+
+	for i, ace := range acl.Aces {
+		if o.Pretty {
+			builder.WriteString("\n")
+			builder.WriteString(o.Indent)
+		}
+		var flags string
+		if i < len(spelled) {
+			flags = spelled[i]
+		}
+		builder.WriteString(o.formatAce(&ace, flags))
+		if o.Pretty && o.Comments {
+			builder.WriteString("  // ")
+			builder.WriteString(describeAce(&ace))
+		}
+	}
+
+	return builder.String()
+}
+
+// aclPart returns the DACL or SACL and whether the descriptor has that section.
+func (sd *SecurityDescriptor) aclPart(part SecurityDescriptorPart) (*Acl, bool) {
+	if part == PartSacl {
+		return sd.SystemAcl, sd.SystemAcl != nil || (sd.Control&SE_SACL_PRESENT) != 0
+	}
+	return sd.DiscretionaryAcl, sd.DiscretionaryAcl != nil || (sd.Control&SE_DACL_PRESENT) != 0
+}
+
+func (o *FormatOptions) formatSidSection(builder *strings.Builder, part SecurityDescriptorPart, sid string) {
+	if part == PartGroup {
+		builder.WriteString("G:")
+	} else {
+		builder.WriteString("O:")
+	}
+	builder.WriteString(o.formatSid(sid, true))
+}
+
+// formatAclHeader writes the section prefix, the control flags and NO_ACCESS_CONTROL for a nil ACL.
+func (o *FormatOptions) formatAclHeader(builder *strings.Builder, part SecurityDescriptorPart, acl *Acl, control SECURITY_DESCRIPTOR_CONTROL) {
+	protected, autoInheritReq, autoInherited := SE_DACL_PROTECTED, SE_DACL_AUTO_INHERIT_REQ, SE_DACL_AUTO_INHERITED
+	if part == PartSacl {
+		builder.WriteString("S:")
+		protected, autoInheritReq, autoInherited = SE_SACL_PROTECTED, SE_SACL_AUTO_INHERIT_REQ, SE_SACL_AUTO_INHERITED
+	} else {
+		builder.WriteString("D:")
+	}
+	if (control & protected) != 0 {
+		builder.WriteString("P")
+	}
+	if (control & autoInheritReq) != 0 {
+		builder.WriteString("AR")
+	}
+	if (control & autoInherited) != 0 {
+		builder.WriteString("AI")
+	}
+	if acl == nil {
+		builder.WriteString("NO_ACCESS_CONTROL")
+	}
+}
+
+// Format converts the descriptor to SDDL according to the options.
+func (sd *SecurityDescriptor) Format(o *FormatOptions) string {
+	if o.PreserveSpelling && !o.Pretty && sd.Syntax != nil {
+		return sd.formatPreserved(o)
+	}
+
+	var builder strings.Builder
+
+	newLine := func() {
+		if o.Pretty && builder.Len() > 0 {
+			builder.WriteString("\n")
+		}
+	}
+	comment := func(text string) {
+		if o.Pretty && o.Comments {
+			builder.WriteString("  // ")
+			builder.WriteString(text)
+		}
+	}
+
+	if sd.Owner != "" {
+		newLine()
+		o.formatSidSection(&builder, PartOwner, sd.Owner)
+		comment("owner: " + SidDisplayName(sd.Owner))
+	}
+	if sd.Group != "" {
+		newLine()
+		o.formatSidSection(&builder, PartGroup, sd.Group)
+		comment("group: " + SidDisplayName(sd.Group))
+	}
+	for _, part := range []SecurityDescriptorPart{PartDacl, PartSacl} {
+		if acl, present := sd.aclPart(part); present {
+			newLine()
+			o.formatAclHeader(&builder, part, acl, sd.Control)
+			if acl != nil {
+				var spelled []string
+				if o.AceFlagOrder == AceFlagOrderKeep {
+					spelled = sd.spelledAceFlags(part, acl)
+				}
+				builder.WriteString(o.formatAcl(acl, spelled))
+			}
+		}
+	}
+
+	return builder.String()
+}
+
+var aceTypeDescriptions = map[AceType]string{
+	ACCESS_ALLOWED_ACE_TYPE:                 "allow",
+	ACCESS_DENIED_ACE_TYPE:                  "deny",
+	SYSTEM_AUDIT_ACE_TYPE:                   "audit",
+	SYSTEM_ALARM_ACE_TYPE:                   "alarm",
+	ACCESS_ALLOWED_OBJECT_ACE_TYPE:          "allow object",
+	ACCESS_DENIED_OBJECT_ACE_TYPE:           "deny object",
+	ACCESS_AUDIT_OBJECT_ACE_TYPE:            "audit object",
+	ACCESS_ALARM_OBJECT_ACE_TYPE:            "alarm object",
+	SYSTEM_MANDATORY_LABEL_ACE_TYPE:         "mandatory label",
+	ACCESS_ALLOWED_CALLBACK_ACE_TYPE:        "conditional allow",
+	ACCESS_DENIED_CALLBACK_ACE_TYPE:         "conditional deny",
+	ACCESS_ALLOWED_CALLBACK_OBJECT_ACE_TYPE: "conditional allow object",
+	SYSTEM_AUDIT_CALLBACK_ACE_TYPE:          "conditional audit",
+	SYSTEM_RESOURCE_ATTRIBUTE_ACE_TYPE:      "resource attribute",
+	SYSTEM_SCOPED_POLICY_ID_ACE_TYPE:        "central access policy",
+}
+
+var aceFlagDescriptions = map[string]string{
+	"OI": "object inherit",
+	"CI": "container inherit",
+	"NP": "no propagate",
+	"IO": "inherit only",
+	"ID": "inherited",
+	"SA": "audit success",
+	"FA": "audit failure",
+}
+
+var accessRightDescriptions = map[string]string{
+	"FA": "full control",
+	"FR": "read",
+	"SD": "delete",
+	"RC": "read control",
+	"WD": "write DAC",
+	"WO": "write owner",
+	"SY": "synchronize",
+	"GA": "generic all",
+	"GX": "generic execute",
+	"GW": "generic write",
+	"GR": "generic read",
+	"AS": "access system security",
+	"MA": "maximum allowed",
+}
+
+// describeAce returns a one-line English description of the ACE.
+func describeAce(ace *Ace) string {
+	var builder strings.Builder
+
+	description, ok := aceTypeDescriptions[ace.AceType]
+	if !ok {
+		description = ace.AceType.String()
+	}
+	builder.WriteString(description)
+	builder.WriteString(" ")
+	builder.WriteString(SidDisplayName(ace.Sid))
+	builder.WriteString(": ")
+
+	var rights []string
+	if tokens, ok := aceMaskTokens(ace, false); !ok {
+		rights = append(rights, fmt.Sprintf("0x%x", uint32(ace.AccessMask)))
+	} else {
+		for _, flag := range tokens {
+			if text, ok := accessRightDescriptions[flag]; ok {
+				rights = append(rights, text)
+			} else {
+				rights = append(rights, flag)
+			}
+		}
+	}
+	if len(rights) == 0 {
+		rights = append(rights, "no access")
+	}
+	builder.WriteString(strings.Join(rights, ", "))
+
+	var flags []string
+	for _, flag := range ace.AceFlags.Tokens() {
+		if text, ok := aceFlagDescriptions[flag]; ok {
+			flags = append(flags, text)
+		} else {
+			flags = append(flags, flag)
+		}
+	}
+	if len(flags) > 0 {
+		builder.WriteString(" (")
+		builder.WriteString(strings.Join(flags, ", "))
+		builder.WriteString(")")
+	}
+	if ace.ObjectType != "" {
+		builder.WriteString(" on object type ")
+		builder.WriteString(ace.ObjectType)
+	}
+
+	return builder.String()
+}
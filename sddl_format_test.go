@@ -0,0 +1,128 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSecurityDescriptor_Format(t *testing.T) {
+	const input = "O:BAG:SYD:PAI(A;CIOI;0x1f01ff;;;S-1-5-32-544)(A;;FA;;;AC)(A;;0x1200a9;;;WD)"
+
+	tests := []struct {
+		name    string
+		options *FormatOptions
+		want    string
+	}{
+		{
+			"default",
+			DefaultFormatOptions(),
+			"O:BAG:SYD:PAI(A;CIOI;FA;;;S-1-5-32-544)(A;;FA;;;AC)(A;;0x1200a9;;;WD)",
+		},
+		{
+			"numeric sids",
+			&FormatOptions{NumericSids: true},
+			"O:S-1-5-32-544G:S-1-5-18D:PAI(A;CIOI;FA;;;S-1-5-32-544)(A;;FA;;;S-1-15-2-1)(A;;0x1200a9;;;S-1-1-0)",
+		},
+		{
+			"hex masks",
+			&FormatOptions{MaskStyle: MaskStyleHex, UppercaseHex: true},
+			"O:BAG:SYD:PAI(A;CIOI;0x1F01FF;;;S-1-5-32-544)(A;;0x1F01FF;;;AC)(A;;0x1200A9;;;WD)",
+		},
+		{
+			"token masks",
+			&FormatOptions{MaskStyle: MaskStyleTokens},
+			"O:BAG:SYD:PAI(A;CIOI;FA;;;S-1-5-32-544)(A;;FA;;;AC)(A;;CCSWWPLORCSY;;;WD)",
+		},
+		{
+			"stored flag order",
+			&FormatOptions{AceFlagOrder: AceFlagOrderKeep},
+			"O:BAG:SYD:PAI(A;CIOI;FA;;;S-1-5-32-544)(A;;FA;;;AC)(A;;0x1200a9;;;WD)",
+		},
+		{
+			"canonical flag order",
+			&FormatOptions{AceFlagOrder: AceFlagOrderCanonical},
+			"O:BAG:SYD:PAI(A;OICI;FA;;;S-1-5-32-544)(A;;FA;;;AC)(A;;0x1200a9;;;WD)",
+		},
+		{
+			"alphabetical flags for windows 7",
+			&FormatOptions{AceFlagOrder: AceFlagOrderAlphabetical, TargetVersion: Windows7},
+			"O:BAG:SYD:PAI(A;CIOI;FA;;;S-1-5-32-544)(A;;FA;;;S-1-15-2-1)(A;;0x1200a9;;;WD)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := ParseSDDL(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, sd.Format(tt.options))
+		})
+	}
+}
+
+func TestSecurityDescriptor_Format_StoredFlagOrder(t *testing.T) {
+	sd, err := ParseSDDL("D:(A;CIOI;FA;;;BA)(A;IDIOOI;FR;;;WD)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd.DiscretionaryAcl.Aces[1].AceFlags |= CONTAINER_INHERIT_ACE
+	sd.DiscretionaryAcl.Aces = append(sd.DiscretionaryAcl.Aces, Ace{
+		AceType:    ACCESS_ALLOWED_ACE_TYPE,
+		AceFlags:   INHERIT_ONLY_ACE | OBJECT_INHERIT_ACE,
+		AccessMask: FILE_ALL_ACCESS,
+		Sid:        "SY",
+	})
+	assert.Equal(t, "D:(A;CIOI;FA;;;BA)(A;OICIIOID;FR;;;WD)(A;OIIO;FA;;;SY)", sd.ToSddl())
+
+	raw, err := sd.ToBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseBinary(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "D:(A;OICI;FA;;;BA)(A;OICIIOID;FR;;;WD)(A;OIIO;FA;;;SY)", parsed.ToSddl())
+}
+
+func TestSecurityDescriptor_Format_Pretty(t *testing.T) {
+	sd, err := ParseSDDL("O:BAG:SYD:P(A;OICI;FA;;;BA)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "O:BA  // owner: BUILTIN\\Administrators\n"+
+		"G:SY  // group: NT AUTHORITY\\SYSTEM\n"+
+		"D:P\n"+
+		"    (A;OICI;FA;;;BA)  // allow BUILTIN\\Administrators: full control (object inherit, container inherit)",
+		sd.Format(PrettyFormatOptions()))
+}
+
+func TestSecurityDescriptor_Format_RightTokens(t *testing.T) {
+	for _, sddl := range []string{
+		"D:(A;;RPWP;;;AU)(OA;;CR;00299570-246d-11d0-a768-00aa006e0529;;AU)",
+		"D:(A;;CCDCLCSWRPWPDTLOCRSDRCWDWO;;;SY)(A;;LCRPLORC;;;AU)",
+		"D:(A;CI;KA;;;BA)(A;CI;KR;;;BU)(A;;KW;;;S-1-5-21-1-2-3-1001)",
+		"S:(ML;;NW;;;LW)",
+		"S:(ML;OICI;NWNRNX;;;HI)",
+	} {
+		t.Run(sddl, func(t *testing.T) {
+			sd, err := ParseSDDL(sddl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tokens := &FormatOptions{MaskStyle: MaskStyleTokens}
+			assert.Equal(t, sddl, sd.Format(tokens))
+
+			raw, err := sd.ToBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := ParseBinary(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			numeric := &FormatOptions{MaskStyle: MaskStyleTokens, NumericSids: true}
+			assert.Equal(t, sd.Format(numeric), parsed.Format(numeric))
+		})
+	}
+}
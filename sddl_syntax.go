@@ -0,0 +1,230 @@
+package winsddlconverter
+
+import (
+	"bytes"
+	"strings"
+)
+
+// SddlSpan is the byte range [Start, End) of a token in the parsed SDDL text.
+type SddlSpan struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// SddlAceSyntax is an ACE as it was spelled in SDDL.
+type SddlAceSyntax struct {
+	Span SddlSpan `json:"span"`
+	// Ace is the value parsed from Span, used to detect edits
+	Ace Ace `json:"ace"`
+}
+
+// SddlSectionSyntax is an "O:", "G:", "D:" or "S:" section as it was spelled in SDDL.
+type SddlSectionSyntax struct {
+	Part SecurityDescriptorPart `json:"part"`
+	Span SddlSpan               `json:"span"`
+	// Header covers the prefix and, for ACLs, the control flags
+	Header SddlSpan `json:"header"`
+	// Sid is the owner or group parsed from the section
+	Sid string `json:"sid,omitempty"`
+	// Control holds the control bits set by the section
+	Control SECURITY_DESCRIPTOR_CONTROL `json:"control,omitempty"`
+	NullAcl bool                        `json:"nullAcl,omitempty"`
+	Aces    []SddlAceSyntax             `json:"aces,omitempty"`
+}
+
+// SddlSyntax records how a descriptor was spelled in SDDL, so that FormatOptions.PreserveSpelling
+// can write unchanged parts back exactly as they were read.
+type SddlSyntax struct {
+	Text     string              `json:"text"`
+	Sections []SddlSectionSyntax `json:"sections"`
+}
+
+func (s *SddlSyntax) text(span SddlSpan) string {
+	return s.Text[span.Start:span.End]
+}
+
+// SpanOf returns the source span of an ACE, or false if the ACE was not in the parsed text.
+func (s *SddlSyntax) SpanOf(part SecurityDescriptorPart, index int) (SddlSpan, bool) {
+	for _, section := range s.Sections {
+		if section.Part == part && index >= 0 && index < len(section.Aces) {
+			return section.Aces[index].Span, true
+		}
+	}
+	return SddlSpan{}, false
+}
+
+func aclControlMask(part SecurityDescriptorPart) SECURITY_DESCRIPTOR_CONTROL {
+	if part == PartSacl {
+		return SE_SACL_PROTECTED | SE_SACL_AUTO_INHERIT_REQ | SE_SACL_AUTO_INHERITED
+	}
+	return SE_DACL_PROTECTED | SE_DACL_AUTO_INHERIT_REQ | SE_DACL_AUTO_INHERITED
+}
+
+func aceEqual(a *Ace, b *Ace) bool {
+	return a.AceType == b.AceType &&
+		a.AceFlags == b.AceFlags &&
+		a.AccessMask == b.AccessMask &&
+		a.ObjectType == b.ObjectType &&
+		a.InheritedObjectType == b.InheritedObjectType &&
+		a.Sid == b.Sid &&
+		bytes.Equal(a.ApplicationData, b.ApplicationData)
+}
+
+// formatPreserved writes the sections in their original order and spelling.
+// Changed owners, groups, ACL headers and ACEs are written with o, added sections are appended.
+func (sd *SecurityDescriptor) formatPreserved(o *FormatOptions) string {
+	syntax := sd.Syntax
+	var builder strings.Builder
+	written := map[SecurityDescriptorPart]bool{}
+	previousEnd := 0
+
+	for _, section := range syntax.Sections {
+		leading := syntax.Text[previousEnd:section.Span.Start]
+		previousEnd = section.Span.End
+		written[section.Part] = true
+
+		switch section.Part {
+		case PartOwner, PartGroup:
+			sid := sd.Owner
+			if section.Part == PartGroup {
+				sid = sd.Group
+			}
+			if sid == "" {
+				continue
+			}
+			builder.WriteString(leading)
+			if sid == section.Sid {
+				builder.WriteString(syntax.text(section.Span))
+			} else {
+				o.formatSidSection(&builder, section.Part, sid)
+			}
+		case PartDacl, PartSacl:
+			acl, present := sd.aclPart(section.Part)
+			if !present {
+				continue
+			}
+			builder.WriteString(leading)
+			if section.NullAcl == (acl == nil) && section.Control == sd.Control&aclControlMask(section.Part) {
+				builder.WriteString(syntax.text(section.Header))
+			} else {
+				o.formatAclHeader(&builder, section.Part, acl, sd.Control)
+			}
+			if acl == nil {
+				continue
+			}
+			o.formatPreservedAces(&builder, syntax, &section, acl)
+		}
+	}
+	builder.WriteString(syntax.Text[previousEnd:])
+
+	for _, part := range []SecurityDescriptorPart{PartOwner, PartGroup, PartDacl, PartSacl} {
+		if written[part] {
+			continue
+		}
+		switch part {
+		case PartOwner:
+			if sd.Owner != "" {
+				o.formatSidSection(&builder, part, sd.Owner)
+			}
+		case PartGroup:
+			if sd.Group != "" {
+				o.formatSidSection(&builder, part, sd.Group)
+			}
+		default:
+			if acl, present := sd.aclPart(part); present {
+				o.formatAclHeader(&builder, part, acl, sd.Control)
+				if acl != nil {
+					builder.WriteString(o.FormatAcl(acl))
+				}
+			}
+		}
+	}
+
+	return builder.String()
+}
+
+// matchAces returns for each ACE of acl the index of an equal, not yet used ACE of the
+// section after the previous match, or -1.
+func (section *SddlSectionSyntax) matchAces(acl *Acl) []int {
+	matches := make([]int, len(acl.Aces))
+	next := 0
+	for i := range acl.Aces {
+		matches[i] = -1
+		for j := next; j < len(section.Aces); j++ {
+			if aceEqual(&acl.Aces[i], &section.Aces[j].Ace) {
+				matches[i] = j
+				next = j + 1
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// spelledAceFlags returns for each ACE of the DACL or SACL the flags in the order they
+// were read by ParseSDDL, or nothing for ACEs that were not read or have been changed.
+func (sd *SecurityDescriptor) spelledAceFlags(part SecurityDescriptorPart, acl *Acl) []string {
+	if sd.Syntax == nil {
+		return nil
+	}
+	for i := range sd.Syntax.Sections {
+		section := &sd.Syntax.Sections[i]
+		if section.Part != part {
+			continue
+		}
+		spelled := make([]string, len(acl.Aces))
+		for j, match := range section.matchAces(acl) {
+			if match >= 0 {
+				spelled[j] = spelledFlags(sd.Syntax.text(section.Aces[match].Span), acl.Aces[j].AceFlags)
+			}
+		}
+		return spelled
+	}
+	return nil
+}
+
+// spelledFlags returns the flags of an ACE in the order of its SDDL text. Flags missing from
+// the text, which it cannot have as the ACE is unchanged, would follow in bit order.
+func spelledFlags(aceText string, flags AceFlags) string {
+	fields := strings.Split(aceText, ";")
+	if len(fields) < 2 {
+		return ""
+	}
+	text := strings.ToUpper(strings.Join(strings.Fields(fields[1]), ""))
+	var builder strings.Builder
+	for i := 0; i+2 <= len(text); i += 2 {
+		flag, err := parseAceFlagToken(text[i : i+2])
+		if err == nil && flags&flag != 0 {
+			builder.WriteString(text[i : i+2])
+			flags &^= flag
+		}
+	}
+	builder.WriteString(strings.Join(flags.Tokens(), ""))
+	return builder.String()
+}
+
+// formatPreservedAces writes each ACE of acl with the spelling of an equal, not yet used ACE
+// of the section, together with the text that preceded it. Other ACEs are written with o.
+func (o *FormatOptions) formatPreservedAces(builder *strings.Builder, syntax *SddlSyntax, section *SddlSectionSyntax, acl *Acl) {
+	for i, match := range section.matchAces(acl) {
+		if match < 0 {
+			builder.WriteString(o.FormatAce(&acl.Aces[i]))
+			continue
+		}
+		start := section.Header.End
+		if match > 0 {
+			start = section.Aces[match-1].Span.End
+		}
+		builder.WriteString(syntax.Text[start:section.Aces[match].Span.End])
+	}
+	tail := section.Header.End
+	if len(section.Aces) > 0 {
+		tail = section.Aces[len(section.Aces)-1].Span.End
+	}
+	builder.WriteString(syntax.Text[tail:section.Span.End])
+}
+
+// ToSddlPreserved is ToSddl keeping the spelling of the parts that were not changed since ParseSDDL.
+func (sd *SecurityDescriptor) ToSddlPreserved() string {
+	return sd.Format(&FormatOptions{PreserveSpelling: true})
+}
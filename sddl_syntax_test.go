@@ -0,0 +1,74 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSecurityDescriptor_ToSddlPreserved(t *testing.T) {
+	const input = "O:S-1-5-32-544G:SYD:AI(A;CIOI;0x1f01ff;;;S-1-5-32-544)(A;;GRGX;;;WD)(D;;0x10000;;;BG)"
+
+	tests := []struct {
+		name string
+		edit func(sd *SecurityDescriptor)
+		want string
+	}{
+		{
+			"unmodified",
+			func(sd *SecurityDescriptor) {},
+			input,
+		},
+		{
+			"edited ace",
+			func(sd *SecurityDescriptor) {
+				sd.DiscretionaryAcl.Aces[1].Sid = "BU"
+			},
+			"O:S-1-5-32-544G:SYD:AI(A;CIOI;0x1f01ff;;;S-1-5-32-544)(A;;GXGR;;;BU)(D;;0x10000;;;BG)",
+		},
+		{
+			"removed and added aces",
+			func(sd *SecurityDescriptor) {
+				aces := sd.DiscretionaryAcl.Aces
+				sd.DiscretionaryAcl.Aces = []Ace{aces[0], aces[2], {
+					AceType:    ACCESS_ALLOWED_ACE_TYPE,
+					AccessMask: FILE_ALL_ACCESS,
+					Sid:        "SY",
+				}}
+			},
+			"O:S-1-5-32-544G:SYD:AI(A;CIOI;0x1f01ff;;;S-1-5-32-544)(D;;0x10000;;;BG)(A;;FA;;;SY)",
+		},
+		{
+			"changed sections",
+			func(sd *SecurityDescriptor) {
+				sd.Owner = "S-1-5-18"
+				sd.Group = ""
+				sd.Control |= SE_DACL_PROTECTED
+				sd.SystemAcl = &Acl{AclRevision: ACL_REVISION, Aces: []Ace{}}
+			},
+			"O:SYD:PAI(A;CIOI;0x1f01ff;;;S-1-5-32-544)(A;;GRGX;;;WD)(D;;0x10000;;;BG)S:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sd, err := ParseSDDL(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.edit(sd)
+			assert.Equal(t, tt.want, sd.ToSddlPreserved())
+		})
+	}
+}
+
+func TestSddlSyntax_SpanOf(t *testing.T) {
+	const input = "O:BAD:(A;;FA;;;SY)(A;;0x1200a9;;;BU)"
+	sd, err := ParseSDDL(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	span, ok := sd.Syntax.SpanOf(PartDacl, 1)
+	assert.True(t, ok)
+	assert.Equal(t, "(A;;0x1200a9;;;BU)", input[span.Start:span.End])
+	_, ok = sd.Syntax.SpanOf(PartSacl, 0)
+	assert.False(t, ok)
+}
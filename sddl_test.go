@@ -24,54 +24,34 @@ func TestParseSDDL(t *testing.T) {
 					AclRevision: 2,
 					Aces: []Ace{
 						{
-							AceType:  ACCESS_ALLOWED_ACE_TYPE,
-							AceFlags: []string{"OI", "CI", "ID"},
-							AccessMask: AccessMaskDetail{
-								Mask:       2032127,
-								Flags:      []string{"FA"},
-								HasUnknown: false,
-							},
-							Sid: "BA",
+							AceType:    ACCESS_ALLOWED_ACE_TYPE,
+							AceFlags:   OBJECT_INHERIT_ACE | CONTAINER_INHERIT_ACE | INHERITED_ACE,
+							AccessMask: AccessMask(2032127),
+							Sid:        "BA",
 						},
 						{
-							AceType:  ACCESS_ALLOWED_ACE_TYPE,
-							AceFlags: []string{"OI", "CI", "ID"},
-							AccessMask: AccessMaskDetail{
-								Mask:       2032127,
-								Flags:      []string{"FA"},
-								HasUnknown: false,
-							},
-							Sid: "SY",
+							AceType:    ACCESS_ALLOWED_ACE_TYPE,
+							AceFlags:   OBJECT_INHERIT_ACE | CONTAINER_INHERIT_ACE | INHERITED_ACE,
+							AccessMask: AccessMask(2032127),
+							Sid:        "SY",
 						},
 						{
-							AceType:  ACCESS_ALLOWED_ACE_TYPE,
-							AceFlags: []string{"OI", "CI", "ID"},
-							AccessMask: AccessMaskDetail{
-								Mask:       1179817,
-								Flags:      []string{"RC", "SY"},
-								HasUnknown: true,
-							},
-							Sid: "BU",
+							AceType:    ACCESS_ALLOWED_ACE_TYPE,
+							AceFlags:   OBJECT_INHERIT_ACE | CONTAINER_INHERIT_ACE | INHERITED_ACE,
+							AccessMask: AccessMask(1179817),
+							Sid:        "BU",
 						},
 						{
-							AceType:  ACCESS_ALLOWED_ACE_TYPE,
-							AceFlags: []string{"ID"},
-							AccessMask: AccessMaskDetail{
-								Mask:       1245631,
-								Flags:      []string{"SD", "RC", "SY"},
-								HasUnknown: true,
-							},
-							Sid: "AU",
+							AceType:    ACCESS_ALLOWED_ACE_TYPE,
+							AceFlags:   INHERITED_ACE,
+							AccessMask: AccessMask(1245631),
+							Sid:        "AU",
 						},
 						{
-							AceType:  ACCESS_ALLOWED_ACE_TYPE,
-							AceFlags: []string{"OI", "CI", "IO", "ID"},
-							AccessMask: AccessMaskDetail{
-								Mask:       3758161920,
-								Flags:      []string{"SD", "GX", "GW", "GR"},
-								HasUnknown: false,
-							},
-							Sid: "AU",
+							AceType:    ACCESS_ALLOWED_ACE_TYPE,
+							AceFlags:   OBJECT_INHERIT_ACE | CONTAINER_INHERIT_ACE | INHERIT_ONLY_ACE | INHERITED_ACE,
+							AccessMask: AccessMask(3758161920),
+							Sid:        "AU",
 						},
 					},
 				},
@@ -88,54 +68,34 @@ func TestParseSDDL(t *testing.T) {
 					AclRevision: 2,
 					Aces: []Ace{
 						{
-							AceType:  ACCESS_ALLOWED_ACE_TYPE,
-							AceFlags: []string{"OI", "CI", "ID"},
-							AccessMask: AccessMaskDetail{
-								Mask:       2032127,
-								Flags:      []string{"FA"},
-								HasUnknown: false,
-							},
-							Sid: "BA",
+							AceType:    ACCESS_ALLOWED_ACE_TYPE,
+							AceFlags:   OBJECT_INHERIT_ACE | CONTAINER_INHERIT_ACE | INHERITED_ACE,
+							AccessMask: AccessMask(2032127),
+							Sid:        "BA",
 						},
 						{
-							AceType:  ACCESS_ALLOWED_ACE_TYPE,
-							AceFlags: []string{"OI", "CI", "ID"},
-							AccessMask: AccessMaskDetail{
-								Mask:       2032127,
-								Flags:      []string{"FA"},
-								HasUnknown: false,
-							},
-							Sid: "SY",
+							AceType:    ACCESS_ALLOWED_ACE_TYPE,
+							AceFlags:   OBJECT_INHERIT_ACE | CONTAINER_INHERIT_ACE | INHERITED_ACE,
+							AccessMask: AccessMask(2032127),
+							Sid:        "SY",
 						},
 						{
-							AceType:  ACCESS_ALLOWED_ACE_TYPE,
-							AceFlags: []string{"OI", "CI", "ID"},
-							AccessMask: AccessMaskDetail{
-								Mask:       1179817,
-								Flags:      []string{"RC", "SY"},
-								HasUnknown: true,
-							},
-							Sid: "BU",
+							AceType:    ACCESS_ALLOWED_ACE_TYPE,
+							AceFlags:   OBJECT_INHERIT_ACE | CONTAINER_INHERIT_ACE | INHERITED_ACE,
+							AccessMask: AccessMask(1179817),
+							Sid:        "BU",
 						},
 						{
-							AceType:  ACCESS_ALLOWED_ACE_TYPE,
-							AceFlags: []string{"ID"},
-							AccessMask: AccessMaskDetail{
-								Mask:       1245631,
-								Flags:      []string{"SD", "RC", "SY"},
-								HasUnknown: true,
-							},
-							Sid: "AU",
+							AceType:    ACCESS_ALLOWED_ACE_TYPE,
+							AceFlags:   INHERITED_ACE,
+							AccessMask: AccessMask(1245631),
+							Sid:        "AU",
 						},
 						{
-							AceType:  ACCESS_ALLOWED_ACE_TYPE,
-							AceFlags: []string{"OI", "CI", "IO", "ID"},
-							AccessMask: AccessMaskDetail{
-								Mask:       3758161920,
-								Flags:      []string{"SD", "GX", "GW", "GR"},
-								HasUnknown: false,
-							},
-							Sid: "AU",
+							AceType:    ACCESS_ALLOWED_ACE_TYPE,
+							AceFlags:   OBJECT_INHERIT_ACE | CONTAINER_INHERIT_ACE | INHERIT_ONLY_ACE | INHERITED_ACE,
+							AccessMask: AccessMask(3758161920),
+							Sid:        "AU",
 						},
 					},
 				},
@@ -153,34 +113,22 @@ func TestParseSDDL(t *testing.T) {
 					AclRevision: 2,
 					Aces: []Ace{
 						{
-							AceType:  ACCESS_ALLOWED_ACE_TYPE,
-							AceFlags: []string{"OI", "CI"},
-							AccessMask: AccessMaskDetail{
-								Mask:       FILE_ALL_ACCESS,
-								Flags:      []string{"FA"},
-								HasUnknown: false,
-							},
-							Sid: "CO",
+							AceType:    ACCESS_ALLOWED_ACE_TYPE,
+							AceFlags:   OBJECT_INHERIT_ACE | CONTAINER_INHERIT_ACE,
+							AccessMask: AccessMask(FILE_ALL_ACCESS),
+							Sid:        "CO",
 						},
 						{
-							AceType:  ACCESS_ALLOWED_ACE_TYPE,
-							AceFlags: []string{"OI", "CI"},
-							AccessMask: AccessMaskDetail{
-								Mask:       GENERIC_WRITE | GENERIC_READ,
-								Flags:      []string{"GW", "GR"},
-								HasUnknown: false,
-							},
-							Sid: "CG",
+							AceType:    ACCESS_ALLOWED_ACE_TYPE,
+							AceFlags:   OBJECT_INHERIT_ACE | CONTAINER_INHERIT_ACE,
+							AccessMask: AccessMask(GENERIC_WRITE | GENERIC_READ),
+							Sid:        "CG",
 						},
 						{
-							AceType:  ACCESS_ALLOWED_ACE_TYPE,
-							AceFlags: []string{"OI", "CI"},
-							AccessMask: AccessMaskDetail{
-								Mask:       GENERIC_READ | GENERIC_EXECUTE,
-								Flags:      []string{"GR", "GX"},
-								HasUnknown: false,
-							},
-							Sid: "WD",
+							AceType:    ACCESS_ALLOWED_ACE_TYPE,
+							AceFlags:   OBJECT_INHERIT_ACE | CONTAINER_INHERIT_ACE,
+							AccessMask: AccessMask(GENERIC_READ | GENERIC_EXECUTE),
+							Sid:        "WD",
 						},
 					},
 				},
@@ -209,3 +157,53 @@ func toJson(t *testing.T, a interface{}) string {
 	}
 	return string(raw)
 }
+
+func TestParseSDDLWithOptions(t *testing.T) {
+	const canonical = "O:BAG:SYD:PAI(A;OICI;FA;;;BA)(A;;0x1200a9;;;WD)"
+
+	tests := []struct {
+		name    string
+		sddl    string
+		opts    *ParseOptions
+		want    string
+		wantErr bool
+	}{
+		{"default", canonical, &ParseOptions{}, canonical, false},
+		{"section order", "D:PAI(A;OICI;FA;;;BA)(A;;0x1200a9;;;WD)G:SYO:BA", &ParseOptions{}, canonical, false},
+		{"odd ace flags", "O:BAD:(A;OIC;FA;;;BA)", &ParseOptions{}, "", true},
+		{"odd access rights", "O:BAD:(A;;FAG;;;BA)", &ParseOptions{}, "", true},
+		{"truncated", "O:BAD", &ParseOptions{}, "", true},
+		{"sid at end", "O:S-1-5-18", &ParseOptions{}, "O:SY", false},
+		{"whitespace rejected", "O:BA G:SY", &ParseOptions{}, "", true},
+		{
+			"lenient",
+			"o:ba\n g:sy\n d:pai\n  (a; oici; fa;;; ba)\n  (A;;0X1200A9;;;wd)\n",
+			LenientParseOptions(),
+			canonical,
+			false,
+		},
+		{"unknown flag ignored", "D:(A;XXOI;FA;;;BA)", &ParseOptions{}, "D:(A;OI;FA;;;BA)", false},
+		{"unknown right ignored", "D:(A;;ZZFA;;;BA)", &ParseOptions{}, "D:(A;;FA;;;BA)", false},
+		{"lenient unknown right ignored", "D:(A;;zzfa;;;BA)", LenientParseOptions(), "D:(A;;FA;;;BA)", false},
+		{"strict", canonical, StrictParseOptions(), canonical, false},
+		{"strict duplicate", "O:BAG:SYO:SY", StrictParseOptions(), "", true},
+		{"strict unknown flag", "D:(A;XX;FA;;;BA)", StrictParseOptions(), "", true},
+		{"strict unknown right", "D:(A;;ZZ;;;BA)", StrictParseOptions(), "", true},
+		{"strict empty sid", "D:(A;;FA;;;)", StrictParseOptions(), "", true},
+		{"strict unknown sid alias", "D:(A;;FA;;;ZZ)", StrictParseOptions(), "", true},
+		{"strict malformed sid", "D:(A;;FA;;;S-1-x)", StrictParseOptions(), "", true},
+		{"strict sid", "D:(A;;FA;;;S-1-5-21-1-2-3-1001)", StrictParseOptions(), "D:(A;;FA;;;S-1-5-21-1-2-3-1001)", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSDDLWithOptions(tt.sddl, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSDDLWithOptions() error = %+v, wantErr %+v", err, tt.wantErr)
+			}
+			if err == nil {
+				assert.Equal(t, tt.want, got.ToSddl())
+				assert.Equal(t, tt.sddl, got.ToSddlPreserved())
+			}
+		})
+	}
+}
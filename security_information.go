@@ -0,0 +1,223 @@
+package winsddlconverter
+
+import "fmt"
+
+// SecurityInformation selects parts of a security descriptor, like SECURITY_INFORMATION.
+type SecurityInformation uint32
+
+const (
+	OWNER_SECURITY_INFORMATION               SecurityInformation = 0x00000001
+	GROUP_SECURITY_INFORMATION               SecurityInformation = 0x00000002
+	DACL_SECURITY_INFORMATION                SecurityInformation = 0x00000004
+	SACL_SECURITY_INFORMATION                SecurityInformation = 0x00000008
+	LABEL_SECURITY_INFORMATION               SecurityInformation = 0x00000010
+	ATTRIBUTE_SECURITY_INFORMATION           SecurityInformation = 0x00000020
+	SCOPE_SECURITY_INFORMATION               SecurityInformation = 0x00000040
+	PROCESS_TRUST_LABEL_SECURITY_INFORMATION SecurityInformation = 0x00000080
+	BACKUP_SECURITY_INFORMATION              SecurityInformation = 0x00010000
+	UNPROTECTED_SACL_SECURITY_INFORMATION    SecurityInformation = 0x10000000
+	UNPROTECTED_DACL_SECURITY_INFORMATION    SecurityInformation = 0x20000000
+	PROTECTED_SACL_SECURITY_INFORMATION      SecurityInformation = 0x40000000
+	PROTECTED_DACL_SECURITY_INFORMATION      SecurityInformation = 0x80000000
+)
+
+// saclSecurityInformation is every part stored in the SACL
+const saclSecurityInformation = SACL_SECURITY_INFORMATION | LABEL_SECURITY_INFORMATION |
+	ATTRIBUTE_SECURITY_INFORMATION | SCOPE_SECURITY_INFORMATION | PROCESS_TRUST_LABEL_SECURITY_INFORMATION
+
+// expand resolves BACKUP_SECURITY_INFORMATION to the parts it stands for.
+func (si SecurityInformation) expand() SecurityInformation {
+	if si&BACKUP_SECURITY_INFORMATION != 0 {
+		si |= OWNER_SECURITY_INFORMATION | GROUP_SECURITY_INFORMATION | DACL_SECURITY_INFORMATION | saclSecurityInformation
+	}
+	return si
+}
+
+// saclAceInformation returns the SecurityInformation bit that covers a SACL ACE.
+func saclAceInformation(ace *Ace) SecurityInformation {
+	switch ace.AceType {
+	case SYSTEM_MANDATORY_LABEL_ACE_TYPE:
+		return LABEL_SECURITY_INFORMATION
+	case SYSTEM_RESOURCE_ATTRIBUTE_ACE_TYPE:
+		return ATTRIBUTE_SECURITY_INFORMATION
+	case SYSTEM_SCOPED_POLICY_ID_ACE_TYPE:
+		return SCOPE_SECURITY_INFORMATION
+	case SYSTEM_PROCESS_TRUST_LABEL_ACE_TYPE:
+		return PROCESS_TRUST_LABEL_SECURITY_INFORMATION
+	default:
+		return SACL_SECURITY_INFORMATION
+	}
+}
+
+// filterSacl returns the SACL ACEs covered by si.
+func filterSacl(acl *Acl, si SecurityInformation) *Acl {
+	result := &Acl{AclRevision: acl.AclRevision, Aces: []Ace{}}
+	for _, ace := range acl.Aces {
+		if saclAceInformation(&ace)&si != 0 {
+			result.Aces = append(result.Aces, cloneAce(ace))
+		}
+	}
+	result.AclRevision = result.RequiredRevision()
+	return result
+}
+
+// Select returns a copy holding only the parts selected by si,
+// like GetSecurityInfo and GetSecurityDescriptorSddlForm.
+func (sd *SecurityDescriptor) Select(si SecurityInformation) *SecurityDescriptor {
+	si = si.expand()
+	result := &SecurityDescriptor{Control: sd.Control & SE_SELF_RELATIVE}
+	if sd.Control&SE_RM_CONTROL_VALID != 0 {
+		result.SetRMControl(sd.RMControl)
+	}
+
+	if si&OWNER_SECURITY_INFORMATION != 0 {
+		result.Owner = sd.Owner
+		result.Control |= sd.Control & SE_OWNER_DEFAULTED
+	}
+	if si&GROUP_SECURITY_INFORMATION != 0 {
+		result.Group = sd.Group
+		result.Control |= sd.Control & SE_GROUP_DEFAULTED
+	}
+	if si&DACL_SECURITY_INFORMATION != 0 {
+		result.DiscretionaryAcl = sd.DiscretionaryAcl.Clone()
+		result.Control |= sd.Control & (SE_DACL_PRESENT | SE_DACL_DEFAULTED | SE_DACL_AUTO_INHERIT_REQ |
+			SE_DACL_AUTO_INHERITED | SE_DACL_PROTECTED | SE_DACL_UNTRUSTED)
+	}
+	if si&saclSecurityInformation != 0 {
+		if sd.SystemAcl != nil {
+			result.SystemAcl = filterSacl(sd.SystemAcl, si)
+		}
+		result.Control |= sd.Control & (SE_SACL_PRESENT | SE_SACL_DEFAULTED | SE_SACL_AUTO_INHERIT_REQ |
+			SE_SACL_AUTO_INHERITED | SE_SACL_PROTECTED)
+	}
+	if sd.Layout != nil {
+		result.Layout = &BinaryLayout{Order: sd.Layout.Order, AlignDword: sd.Layout.AlignDword, AclRevision: sd.Layout.AclRevision}
+	}
+
+	return result
+}
+
+// ToSddlSelective writes only the parts selected by si.
+func (sd *SecurityDescriptor) ToSddlSelective(si SecurityInformation) string {
+	return sd.Select(si).ToSddl()
+}
+
+// ToBinarySelective writes only the parts selected by si.
+func (sd *SecurityDescriptor) ToBinarySelective(si SecurityInformation) ([]byte, error) {
+	return sd.Select(si).ToBinary()
+}
+
+// mergeAcl replaces the ACEs of target accepted by match with those of source.
+// Unless protect is set, inherited ACEs of source are dropped and those of target kept,
+// because an unprotected ACL takes its inherited ACEs from the parent.
+func mergeAcl(target *Acl, source *Acl, match func(ace *Ace) bool, protect bool) *Acl {
+	result := &Acl{Aces: []Ace{}}
+	var inherited []Ace
+	if target != nil {
+		for _, ace := range target.Aces {
+			if !match(&ace) {
+				result.Aces = append(result.Aces, cloneAce(ace))
+			} else if !protect && isInheritedAce(&ace) {
+				inherited = append(inherited, cloneAce(ace))
+			}
+		}
+	}
+	if source != nil {
+		for _, ace := range source.Aces {
+			if match(&ace) && (protect || !isInheritedAce(&ace)) {
+				result.Aces = append(result.Aces, cloneAce(ace))
+			}
+		}
+	}
+	result.Aces = append(result.Aces, inherited...)
+	result.AclRevision = result.RequiredRevision()
+	return result
+}
+
+func isInheritedAce(ace *Ace) bool {
+	return ace.AceFlags.Has(INHERITED_ACE)
+}
+
+func applyProtection(control SECURITY_DESCRIPTOR_CONTROL, si SecurityInformation, protectedInfo SecurityInformation,
+	unprotectedInfo SecurityInformation, protected SECURITY_DESCRIPTOR_CONTROL) (SECURITY_DESCRIPTOR_CONTROL, error) {
+	switch {
+	case si&protectedInfo != 0 && si&unprotectedInfo != 0:
+		return control, fmt.Errorf("both protected and unprotected security information requested")
+	case si&protectedInfo != 0:
+		return control | protected, nil
+	case si&unprotectedInfo != 0:
+		return control &^ protected, nil
+	default:
+		return control, nil
+	}
+}
+
+// Merge applies the parts of source selected by si to sd, following SetSecurityInfo:
+//   - OWNER and GROUP replace the owner and group.
+//   - DACL replaces the explicit ACEs of the DACL. Unless the DACL is protected, inherited ACEs
+//     in source are ignored and the inherited ACEs already in sd are kept, since they come from the parent.
+//   - SACL, LABEL, ATTRIBUTE, SCOPE and PROCESS_TRUST_LABEL each replace their own kind of SACL ACEs.
+//   - PROTECTED_DACL and UNPROTECTED_DACL set or clear SE_DACL_PROTECTED, likewise for the SACL.
+//     Without either, the protection of sd is kept. An unprotected ACL keeps the auto-inherited
+//     flag of sd, a protected one takes it from source.
+func (sd *SecurityDescriptor) Merge(source *SecurityDescriptor, si SecurityInformation) error {
+	si = si.expand()
+	// check the source before changing sd, so that a failed merge leaves it as it was
+	if si&OWNER_SECURITY_INFORMATION != 0 && source.Owner == "" {
+		return fmt.Errorf("owner selected but source has no owner")
+	}
+	if si&GROUP_SECURITY_INFORMATION != 0 && source.Group == "" {
+		return fmt.Errorf("group selected but source has no group")
+	}
+
+	control, err := applyProtection(sd.Control, si, PROTECTED_DACL_SECURITY_INFORMATION, UNPROTECTED_DACL_SECURITY_INFORMATION, SE_DACL_PROTECTED)
+	if err != nil {
+		return err
+	}
+	control, err = applyProtection(control, si, PROTECTED_SACL_SECURITY_INFORMATION, UNPROTECTED_SACL_SECURITY_INFORMATION, SE_SACL_PROTECTED)
+	if err != nil {
+		return err
+	}
+
+	if si&OWNER_SECURITY_INFORMATION != 0 {
+		sd.Owner = source.Owner
+		control = control&^SE_OWNER_DEFAULTED | source.Control&SE_OWNER_DEFAULTED
+	}
+	if si&GROUP_SECURITY_INFORMATION != 0 {
+		sd.Group = source.Group
+		control = control&^SE_GROUP_DEFAULTED | source.Control&SE_GROUP_DEFAULTED
+	}
+	if si&DACL_SECURITY_INFORMATION != 0 {
+		if source.DiscretionaryAcl == nil {
+			sd.DiscretionaryAcl = nil
+			control |= SE_DACL_PRESENT
+		} else {
+			sd.DiscretionaryAcl = mergeAcl(sd.DiscretionaryAcl, source.DiscretionaryAcl, func(*Ace) bool {
+				return true
+			}, control&SE_DACL_PROTECTED != 0)
+		}
+		control = control&^SE_DACL_DEFAULTED | source.Control&SE_DACL_DEFAULTED
+		if control&SE_DACL_PROTECTED != 0 {
+			control = control&^SE_DACL_AUTO_INHERITED | source.Control&SE_DACL_AUTO_INHERITED
+		}
+	}
+	if saclInfo := si & saclSecurityInformation; saclInfo != 0 {
+		protect := control&SE_SACL_PROTECTED != 0
+		if si&SACL_SECURITY_INFORMATION == 0 {
+			// labels, attributes and scopes are replaced as given
+			protect = true
+		}
+		sd.SystemAcl = mergeAcl(sd.SystemAcl, source.SystemAcl, func(ace *Ace) bool {
+			return saclAceInformation(ace)&saclInfo != 0
+		}, protect)
+		if si&SACL_SECURITY_INFORMATION != 0 {
+			control = control&^SE_SACL_DEFAULTED | source.Control&SE_SACL_DEFAULTED
+			if control&SE_SACL_PROTECTED != 0 {
+				control = control&^SE_SACL_AUTO_INHERITED | source.Control&SE_SACL_AUTO_INHERITED
+			}
+		}
+	}
+
+	sd.Control = control
+	return nil
+}
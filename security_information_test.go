@@ -0,0 +1,137 @@
+package winsddlconverter
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSecurityDescriptor_ToSddlSelective(t *testing.T) {
+	sd, err := ParseSDDL("O:BAG:SYD:PAI(A;;FA;;;BA)S:AI(AU;SA;FA;;;WD)(ML;;0x1;;;S-1-16-12288)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		si   SecurityInformation
+		want string
+	}{
+		{"owner", OWNER_SECURITY_INFORMATION, "O:BA"},
+		{"group and dacl", GROUP_SECURITY_INFORMATION | DACL_SECURITY_INFORMATION, "G:SYD:PAI(A;;FA;;;BA)"},
+		{"sacl", SACL_SECURITY_INFORMATION, "S:AI(AU;SA;FA;;;WD)"},
+		{"label", LABEL_SECURITY_INFORMATION, "S:AI(ML;;0x1;;;S-1-16-12288)"},
+		{"backup", BACKUP_SECURITY_INFORMATION, "O:BAG:SYD:PAI(A;;FA;;;BA)S:AI(AU;SA;FA;;;WD)(ML;;0x1;;;S-1-16-12288)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sd.ToSddlSelective(tt.si))
+
+			raw, err := sd.ToBinarySelective(tt.si)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed, err := ParseBinary(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.want, parsed.ToSddl())
+		})
+	}
+}
+
+func TestParseSDDL_EmptyAndNullAcl(t *testing.T) {
+	tests := []string{
+		"D:",
+		"D:PS:(AU;FA;FA;;;WD)",
+		"O:SYD:NO_ACCESS_CONTROL",
+		"D:PAI(A;;FA;;;BA)S:NO_ACCESS_CONTROL",
+	}
+	for _, sddl := range tests {
+		t.Run(sddl, func(t *testing.T) {
+			sd, err := ParseSDDL(sddl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, sddl, sd.ToSddl())
+		})
+	}
+}
+
+func TestSecurityDescriptor_Merge(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		source string
+		si     SecurityInformation
+		want   string
+	}{
+		{
+			"owner",
+			"O:BAG:SYD:(A;;FA;;;BA)",
+			"O:SY",
+			OWNER_SECURITY_INFORMATION,
+			"O:SYG:SYD:(A;;FA;;;BA)",
+		},
+		{
+			"dacl keeps inherited aces",
+			"O:BAD:AI(A;;FA;;;BA)(A;ID;FA;;;SY)",
+			"D:(A;;FA;;;BU)(A;ID;FA;;;WD)",
+			DACL_SECURITY_INFORMATION,
+			"O:BAD:AI(A;;FA;;;BU)(A;ID;FA;;;SY)",
+		},
+		{
+			"protected dacl",
+			"O:BAD:AI(A;;FA;;;BA)(A;ID;FA;;;SY)",
+			"D:(A;;FA;;;BU)(A;ID;FA;;;WD)",
+			DACL_SECURITY_INFORMATION | PROTECTED_DACL_SECURITY_INFORMATION,
+			"O:BAD:P(A;;FA;;;BU)(A;ID;FA;;;WD)",
+		},
+		{
+			"unprotected dacl",
+			"D:P(A;;FA;;;BA)",
+			"D:(A;;FA;;;BU)",
+			DACL_SECURITY_INFORMATION | UNPROTECTED_DACL_SECURITY_INFORMATION,
+			"D:(A;;FA;;;BU)",
+		},
+		{
+			"label keeps audit aces",
+			"S:(AU;SA;FA;;;WD)(ML;;0x1;;;S-1-16-4096)",
+			"S:(ML;;0x1;;;S-1-16-12288)",
+			LABEL_SECURITY_INFORMATION,
+			"S:(AU;SA;FA;;;WD)(ML;;0x1;;;S-1-16-12288)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := ParseSDDL(tt.target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			source, err := ParseSDDL(tt.source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.NoError(t, target.Merge(source, tt.si))
+			assert.Equal(t, tt.want, target.ToSddl())
+		})
+	}
+
+	sd := &SecurityDescriptor{}
+	assert.Error(t, sd.Merge(sd, DACL_SECURITY_INFORMATION|PROTECTED_DACL_SECURITY_INFORMATION|UNPROTECTED_DACL_SECURITY_INFORMATION))
+
+	for _, si := range []SecurityInformation{
+		OWNER_SECURITY_INFORMATION | GROUP_SECURITY_INFORMATION | DACL_SECURITY_INFORMATION,
+		DACL_SECURITY_INFORMATION | PROTECTED_DACL_SECURITY_INFORMATION | UNPROTECTED_DACL_SECURITY_INFORMATION,
+	} {
+		target, err := ParseSDDL("O:BAG:SYD:AI(A;;FA;;;BA)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		source, err := ParseSDDL("O:SYD:P(A;;FA;;;BU)")
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Error(t, target.Merge(source, si))
+		assert.Equal(t, "O:BAG:SYD:AI(A;;FA;;;BA)", target.ToSddl())
+	}
+}
@@ -2,17 +2,23 @@ package winsddlconverter
 
 import (
 	"encoding/binary"
-	"encoding/json"
 	"fmt"
 	"strings"
 )
 
 type SecurityDescriptor struct {
-	Control          SECURITY_DESCRIPTOR_CONTROL `json:"control"`
-	Owner            string                      `json:"owner,omitempty"`
-	Group            string                      `json:"group,omitempty"`
-	DiscretionaryAcl *Acl                        `json:"dacl,omitempty"`
-	SystemAcl        *Acl                        `json:"sacl,omitempty"`
+	Control SECURITY_DESCRIPTOR_CONTROL `json:"control"`
+	// RMControl is the resource manager control byte, valid when Control has SE_RM_CONTROL_VALID.
+	RMControl        uint8  `json:"rmControl,omitempty"`
+	Owner            string `json:"owner,omitempty"`
+	Group            string `json:"group,omitempty"`
+	DiscretionaryAcl *Acl   `json:"dacl,omitempty"`
+	SystemAcl        *Acl   `json:"sacl,omitempty"`
+
+	// Layout is the binary layout used by ToBinary. ParseBinary sets it to the layout it read.
+	Layout *BinaryLayout `json:"-"`
+	// Syntax is the SDDL text ParseSDDL read, used by FormatOptions.PreserveSpelling.
+	Syntax *SddlSyntax `json:"-"`
 }
 
 type Acl struct {
@@ -21,10 +27,30 @@ type Acl struct {
 }
 
 type Ace struct {
-	AceType    AceType          `json:"aceType"`
-	AceFlags   []string         `json:"aceFlags"`
-	AccessMask AccessMaskDetail `json:"accessMask"`
-	Sid        string           `json:"sid"`
+	AceType    AceType    `json:"aceType"`
+	AceFlags   AceFlags   `json:"aceFlags"`
+	AccessMask AccessMask `json:"accessMask"`
+	// ObjectType and InheritedObjectType are GUID strings, only used by object ACEs
+	ObjectType          string `json:"objectType,omitempty"`
+	InheritedObjectType string `json:"inheritedObjectType,omitempty"`
+	Sid                 string `json:"sid"`
+	// ApplicationData follows the SID of callback and resource attribute ACEs. It holds the
+	// conditional expression of XA, XD, ZA and XU ACEs, see Condition, and the attribute of
+	// RA ACEs, see ResourceAttribute.
+	ApplicationData []byte `json:"applicationData,omitempty"`
+
+	// bytes after the SID that were included in the ACE size by ParseBinary
+	padding []byte
+}
+
+// RequiredRevision returns ACL_REVISION_DS if the ACL contains object ACEs, otherwise ACL_REVISION.
+func (acl *Acl) RequiredRevision() uint8 {
+	for _, ace := range acl.Aces {
+		if ace.AceType.IsObject() {
+			return ACL_REVISION_DS
+		}
+	}
+	return ACL_REVISION
 }
 
 type AccessMaskDetail struct {
@@ -33,43 +59,19 @@ type AccessMaskDetail struct {
 	HasUnknown bool     `json:"hasUnknown"`
 }
 
-func parseAceFlags(flags uint8) []string {
-	var result []string
-	if flags&OBJECT_INHERIT_ACE != 0 {
-		result = append(result, "OI")
-	}
-	if flags&CONTAINER_INHERIT_ACE != 0 {
-		result = append(result, "CI")
-	}
-	if flags&NO_PROPAGATE_INHERIT_ACE != 0 {
-		result = append(result, "NP")
-	}
-	if flags&INHERIT_ONLY_ACE != 0 {
-		result = append(result, "IO")
-	}
-	if flags&INHERITED_ACE != 0 {
-		result = append(result, "ID")
-	}
-	if flags&SUCCESSFUL_ACCESS_ACE_FLAG != 0 {
-		result = append(result, "SA")
-	}
-	if flags&FAILED_ACCESS_ACE_FLAG != 0 {
-		result = append(result, "FA")
-	}
-	return result
-}
-
 type securityDescriptorParser struct {
 	data []byte
 }
 
+// ParseBinary reads a self-relative SECURITY_DESCRIPTOR. It reads whatever it can and
+// does not check the structure; use ValidateBinary for that.
 func ParseBinary(data []byte) (*SecurityDescriptor, error) {
 	parser := &securityDescriptorParser{data: data}
 	return parser.Parse()
 }
 
 func (p *securityDescriptorParser) parseSid(offset int) (string, error) {
-	if offset >= len(p.data) {
+	if offset+8 > len(p.data) {
 		return "", fmt.Errorf("invalid offset for SID parsing")
 	}
 
@@ -111,29 +113,38 @@ func (p *securityDescriptorParser) parseSid(offset int) (string, error) {
 	return fullSid, nil
 }
 
-func (p *securityDescriptorParser) parseAcl(offset int) (*Acl, int, error) {
-	if offset+8 >= len(p.data) {
-		return nil, 0, fmt.Errorf("invalid offset for ACL parsing")
+// sidLength returns the size of the SID at offset.
+func (p *securityDescriptorParser) sidLength(offset int) int {
+	return 8 + int(p.data[offset+1])*4
+}
+
+// parseAcl returns the ACL, the end of its last ACE and the end of the ACL according to its header.
+func (p *securityDescriptorParser) parseAcl(offset int) (*Acl, int, int, error) {
+	if offset+8 > len(p.data) {
+		return nil, 0, 0, fmt.Errorf("invalid offset for ACL parsing")
 	}
 
 	aclRevision := p.data[offset]
+	aclSize := uint16(p.data[offset+2]) | uint16(p.data[offset+3])<<8
 	aceCount := uint16(p.data[offset+4]) | uint16(p.data[offset+5])<<8
 
 	currentOffset := offset + 8 // Skip ACL header
 	aces := make([]Ace, 0, aceCount)
 
 	for i := 0; i < int(aceCount); i++ {
-		if currentOffset+4 >= len(p.data) {
-			return nil, 0, fmt.Errorf("invalid ACE data")
+		if currentOffset+4 > len(p.data) {
+			return nil, 0, 0, fmt.Errorf("invalid ACE data")
 		}
 
 		aceType := AceType(p.data[currentOffset])
 		aceFlags := p.data[currentOffset+1]
 		aceSize := uint16(p.data[currentOffset+2]) | uint16(p.data[currentOffset+3])<<8
 
-		if aceType == ACCESS_ALLOWED_ACE_TYPE || aceType == ACCESS_DENIED_ACE_TYPE || aceType == SYSTEM_MANDATORY_LABEL_ACE_TYPE {
-			if currentOffset+8 >= len(p.data) {
-				return nil, 0, fmt.Errorf("invalid ACE access mask")
+		if aceType.IsObject() || aceType == ACCESS_ALLOWED_ACE_TYPE || aceType == ACCESS_DENIED_ACE_TYPE ||
+			aceType == SYSTEM_AUDIT_ACE_TYPE || aceType == SYSTEM_ALARM_ACE_TYPE || aceType == SYSTEM_MANDATORY_LABEL_ACE_TYPE ||
+			aceType == SYSTEM_SCOPED_POLICY_ID_ACE_TYPE || aceType.hasApplicationData() {
+			if currentOffset+8 > len(p.data) {
+				return nil, 0, 0, fmt.Errorf("invalid ACE access mask")
 			}
 
 			accessMask := uint32(p.data[currentOffset+4]) |
@@ -141,17 +152,51 @@ func (p *securityDescriptorParser) parseAcl(offset int) (*Acl, int, error) {
 				uint32(p.data[currentOffset+6])<<16 |
 				uint32(p.data[currentOffset+7])<<24
 
-			sid, err := p.parseSid(currentOffset + 8)
-			if err != nil {
-				return nil, 0, fmt.Errorf("error parsing SID in ACE: %v", err)
-			}
-
 			ace := Ace{
 				AceType:    aceType,
-				AceFlags:   parseAceFlags(aceFlags),
-				AccessMask: ParseAccessMask(accessMask),
-				Sid:        sid,
+				AceFlags:   AceFlags(aceFlags),
+				AccessMask: AccessMask(accessMask),
+			}
+
+			sidOffset := currentOffset + 8
+			if aceType.IsObject() {
+				if sidOffset+4 > len(p.data) {
+					return nil, 0, 0, fmt.Errorf("invalid object ACE flags")
+				}
+				objectFlags := binary.LittleEndian.Uint32(p.data[sidOffset : sidOffset+4])
+				sidOffset += 4
+				if objectFlags&ACE_OBJECT_TYPE_PRESENT != 0 {
+					if sidOffset+16 > len(p.data) {
+						return nil, 0, 0, fmt.Errorf("invalid object type GUID")
+					}
+					ace.ObjectType = formatGuid(p.data[sidOffset : sidOffset+16])
+					sidOffset += 16
+				}
+				if objectFlags&ACE_INHERITED_OBJECT_TYPE_PRESENT != 0 {
+					if sidOffset+16 > len(p.data) {
+						return nil, 0, 0, fmt.Errorf("invalid inherited object type GUID")
+					}
+					ace.InheritedObjectType = formatGuid(p.data[sidOffset : sidOffset+16])
+					sidOffset += 16
+				}
+			}
+
+			sid, err := p.parseSid(sidOffset)
+			if err != nil {
+				return nil, 0, 0, fmt.Errorf("error parsing SID in ACE: %v", err)
+			}
+			sidEnd := sidOffset + p.sidLength(sidOffset)
+			aceEnd := currentOffset + int(aceSize)
+			if sidEnd > aceEnd || aceEnd > len(p.data) {
+				return nil, 0, 0, fmt.Errorf("invalid ACE size")
+			}
+			ace.Sid = sid
+			if aceType.hasApplicationData() {
+				ace.ApplicationData = append([]byte{}, p.data[sidEnd:aceEnd]...)
+			} else {
+				ace.padding = append([]byte{}, p.data[sidEnd:aceEnd]...)
 			}
+
 			aces = append(aces, ace)
 		}
 
@@ -161,7 +206,7 @@ func (p *securityDescriptorParser) parseAcl(offset int) (*Acl, int, error) {
 	return &Acl{
 		AclRevision: aclRevision,
 		Aces:        aces,
-	}, currentOffset, nil
+	}, currentOffset, offset + int(aclSize), nil
 }
 
 func (p *securityDescriptorParser) Parse() (*SecurityDescriptor, error) {
@@ -177,6 +222,9 @@ func (p *securityDescriptorParser) Parse() (*SecurityDescriptor, error) {
 	sd := &SecurityDescriptor{}
 
 	sd.Control = SECURITY_DESCRIPTOR_CONTROL(binary.LittleEndian.Uint16(p.data[2:4]))
+	if sd.Control&SE_RM_CONTROL_VALID != 0 {
+		sd.RMControl = p.data[1]
+	}
 
 	ownerOffset := uint32(p.data[4]) | uint32(p.data[5])<<8 |
 		uint32(p.data[6])<<16 | uint32(p.data[7])<<24
@@ -187,12 +235,16 @@ func (p *securityDescriptorParser) Parse() (*SecurityDescriptor, error) {
 	daclOffset := uint32(p.data[16]) | uint32(p.data[17])<<8 |
 		uint32(p.data[18])<<16 | uint32(p.data[19])<<24
 
+	var spans []layoutSpan
+	aclSlack := make(map[SecurityDescriptorPart][]byte)
+
 	if ownerOffset > 0 {
 		ownerSid, err := p.parseSid(int(ownerOffset))
 		if err != nil {
 			return nil, fmt.Errorf("error parsing owner SID: %v", err)
 		}
 		sd.Owner = ownerSid
+		spans = append(spans, layoutSpan{PartOwner, int(ownerOffset), int(ownerOffset) + p.sidLength(int(ownerOffset))})
 	}
 
 	if groupOffset > 0 {
@@ -201,97 +253,46 @@ func (p *securityDescriptorParser) Parse() (*SecurityDescriptor, error) {
 			return nil, fmt.Errorf("error parsing group SID: %v", err)
 		}
 		sd.Group = groupSid
+		spans = append(spans, layoutSpan{PartGroup, int(groupOffset), int(groupOffset) + p.sidLength(int(groupOffset))})
 	}
 
 	if saclOffset > 0 {
-		sacl, _, err := p.parseAcl(int(saclOffset))
+		sacl, acesEnd, aclEnd, err := p.parseAcl(int(saclOffset))
 		if err != nil {
 			return nil, fmt.Errorf("error parsing SACL: %v", err)
 		}
 		sd.SystemAcl = sacl
+		spans = append(spans, layoutSpan{PartSacl, int(saclOffset), aclEnd})
+		if acesEnd < aclEnd && aclEnd <= len(p.data) {
+			aclSlack[PartSacl] = append([]byte{}, p.data[acesEnd:aclEnd]...)
+		}
 	}
 
 	if daclOffset > 0 {
-		dacl, _, err := p.parseAcl(int(daclOffset))
+		dacl, acesEnd, aclEnd, err := p.parseAcl(int(daclOffset))
 		if err != nil {
 			return nil, fmt.Errorf("error parsing DACL: %v", err)
 		}
 		sd.DiscretionaryAcl = dacl
+		spans = append(spans, layoutSpan{PartDacl, int(daclOffset), aclEnd})
+		if acesEnd < aclEnd && aclEnd <= len(p.data) {
+			aclSlack[PartDacl] = append([]byte{}, p.data[acesEnd:aclEnd]...)
+		}
 	}
 
-	return sd, nil
-}
+	sd.Layout = newParsedLayout(p.data, spans, aclSlack)
 
-func (sd *SecurityDescriptor) ToJson() ([]byte, error) {
-	return json.MarshalIndent(sd, "", "    ")
+	return sd, nil
 }
 
 func (ace *Ace) ToSddlPart() string {
-	var builder strings.Builder
-
-	builder.WriteString("(")
-	builder.WriteString(ace.AceType.String())
-	builder.WriteString(";")
-
-	for _, flag := range ace.AceFlags {
-		builder.WriteString(flag)
-	}
-	builder.WriteString(";")
-	if ace.AccessMask.HasUnknown {
-		builder.WriteString(fmt.Sprintf("0x%x", ace.AccessMask.Mask))
-	} else {
-		for _, flag := range ace.AccessMask.Flags {
-			builder.WriteString(flag)
-		}
-	}
-	builder.WriteString(";")
-	builder.WriteString(";")
-	builder.WriteString(";")
-
-	builder.WriteString(ace.Sid)
-
-	builder.WriteString(")")
-
-	return builder.String()
+	return DefaultFormatOptions().FormatAce(ace)
 }
 
 func (acl *Acl) ToSddlPart() string {
-	var builder strings.Builder
-
-	for _, ace := range acl.Aces {
-		builder.WriteString(ace.ToSddlPart())
-	}
-
-	return builder.String()
+	return DefaultFormatOptions().FormatAcl(acl)
 }
 
 func (sd *SecurityDescriptor) ToSddl() string {
-	var builder strings.Builder
-
-	builder.WriteString("O:")
-	builder.WriteString(RawSidToString(sd.Owner))
-	builder.WriteString("G:")
-	builder.WriteString(RawSidToString(sd.Group))
-	if sd.DiscretionaryAcl != nil && len(sd.DiscretionaryAcl.Aces) > 0 {
-		builder.WriteString("D:")
-		if (sd.Control & SE_DACL_PROTECTED) != 0 {
-			builder.WriteString("P")
-		}
-		if (sd.Control & SE_DACL_AUTO_INHERITED) != 0 {
-			builder.WriteString("AI")
-		}
-		builder.WriteString(sd.DiscretionaryAcl.ToSddlPart())
-	}
-	if sd.SystemAcl != nil && len(sd.SystemAcl.Aces) > 0 {
-		builder.WriteString("S:")
-		if (sd.Control & SE_SACL_PROTECTED) != 0 {
-			builder.WriteString("P")
-		}
-		if (sd.Control & SE_SACL_AUTO_INHERITED) != 0 {
-			builder.WriteString("AI")
-		}
-		builder.WriteString(sd.SystemAcl.ToSddlPart())
-	}
-
-	return builder.String()
+	return sd.Format(DefaultFormatOptions())
 }
@@ -0,0 +1,155 @@
+package winsddlconverter
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// plainDescriptor has the fields of SecurityDescriptor without its JSON methods.
+type plainDescriptor SecurityDescriptor
+
+// MarshalText writes SDDL. Control bits without SDDL syntax are lost, see SddlWarnings.
+func (sd SecurityDescriptor) MarshalText() ([]byte, error) {
+	return []byte(sd.ToSddl()), nil
+}
+
+// UnmarshalText reads SDDL.
+func (sd *SecurityDescriptor) UnmarshalText(text []byte) error {
+	parsed, err := ParseSDDL(string(text))
+	if err != nil {
+		return err
+	}
+	*sd = *parsed
+	return nil
+}
+
+// MarshalBinary writes a self-relative security descriptor.
+func (sd SecurityDescriptor) MarshalBinary() ([]byte, error) {
+	return sd.ToBinary()
+}
+
+// UnmarshalBinary reads a self-relative security descriptor.
+func (sd *SecurityDescriptor) UnmarshalBinary(data []byte) error {
+	parsed, err := ParseBinary(data)
+	if err != nil {
+		return err
+	}
+	*sd = *parsed
+	return nil
+}
+
+// MarshalJSON writes the current JSON schema version.
+func (sd SecurityDescriptor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&versionedDescriptor{Version: JsonSchemaVersion, plainDescriptor: (*plainDescriptor)(&sd)})
+}
+
+// UnmarshalJSON reads any JSON schema version, see FromJson.
+func (sd *SecurityDescriptor) UnmarshalJSON(data []byte) error {
+	parsed, err := FromJson(data)
+	if err != nil {
+		return err
+	}
+	*sd = *parsed
+	return nil
+}
+
+// ColumnEncoding selects how a descriptor is stored in a database column.
+type ColumnEncoding uint8
+
+const (
+	// ColumnBinary stores the self-relative descriptor, for BLOB and BYTEA columns
+	ColumnBinary ColumnEncoding = iota
+	// ColumnSddl stores SDDL text. Control bits without SDDL syntax are lost.
+	ColumnSddl
+	// ColumnJson stores the JSON of ToJson, for JSON and text columns
+	ColumnJson
+)
+
+// encode returns the driver value of sd in the encoding.
+func (e ColumnEncoding) encode(sd *SecurityDescriptor) (driver.Value, error) {
+	switch e {
+	case ColumnBinary:
+		return sd.ToBinary()
+	case ColumnSddl:
+		return sd.ToSddl(), nil
+	case ColumnJson:
+		raw, err := sd.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		return string(raw), nil
+	default:
+		return nil, fmt.Errorf("unknown column encoding %d", e)
+	}
+}
+
+// decodeColumn reads a column value in any of the encodings.
+// Binary descriptors start with revision 1, JSON with '{' and SDDL with a section prefix.
+func decodeColumn(src interface{}) (*SecurityDescriptor, error) {
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return nil, fmt.Errorf("cannot scan %T into a security descriptor", src)
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("cannot scan an empty value into a security descriptor")
+	}
+	switch data[0] {
+	case SECURITY_DESCRIPTOR_REVISION:
+		return ParseBinary(data)
+	case '{':
+		return FromJson(data)
+	default:
+		return ParseSDDL(string(data))
+	}
+}
+
+// Value stores the descriptor with ColumnBinary. Use SecurityDescriptorColumn for other encodings.
+func (sd SecurityDescriptor) Value() (driver.Value, error) {
+	return ColumnBinary.encode(&sd)
+}
+
+// Scan reads a binary, SDDL or JSON column. NULL is an error, use SecurityDescriptorColumn for nullable columns.
+func (sd *SecurityDescriptor) Scan(src interface{}) error {
+	if src == nil {
+		return fmt.Errorf("cannot scan NULL into a security descriptor")
+	}
+	parsed, err := decodeColumn(src)
+	if err != nil {
+		return err
+	}
+	*sd = *parsed
+	return nil
+}
+
+// SecurityDescriptorColumn is a nullable database column holding a descriptor in the chosen encoding.
+// Scan accepts every encoding.
+type SecurityDescriptorColumn struct {
+	Descriptor *SecurityDescriptor
+	Encoding   ColumnEncoding
+}
+
+func (c SecurityDescriptorColumn) Value() (driver.Value, error) {
+	if c.Descriptor == nil {
+		return nil, nil
+	}
+	return c.Encoding.encode(c.Descriptor)
+}
+
+func (c *SecurityDescriptorColumn) Scan(src interface{}) error {
+	if src == nil {
+		c.Descriptor = nil
+		return nil
+	}
+	parsed, err := decodeColumn(src)
+	if err != nil {
+		return err
+	}
+	c.Descriptor = parsed
+	return nil
+}
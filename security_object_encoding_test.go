@@ -0,0 +1,134 @@
+package winsddlconverter
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/gob"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+const encodingTestSddl = "O:BAG:SYD:PAI(A;OICI;FA;;;BA)(A;;0x1200a9;;;WD)"
+
+func TestSecurityDescriptor_TextAndBinary(t *testing.T) {
+	sd, err := ParseSDDL(encodingTestSddl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := sd.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromText := &SecurityDescriptor{}
+	assert.NoError(t, fromText.UnmarshalText(text))
+	assert.Equal(t, encodingTestSddl, fromText.ToSddl())
+
+	raw, err := sd.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromBinary := &SecurityDescriptor{}
+	assert.NoError(t, fromBinary.UnmarshalBinary(raw))
+	assert.Equal(t, encodingTestSddl, fromBinary.ToSddl())
+
+	assert.Error(t, fromText.UnmarshalText([]byte("X:")))
+}
+
+func TestSecurityDescriptor_JsonAndGob(t *testing.T) {
+	type record struct {
+		Name       string              `json:"name"`
+		Descriptor *SecurityDescriptor `json:"descriptor"`
+	}
+	sd, err := ParseSDDL(encodingTestSddl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := json.Marshal(record{Name: "share", Descriptor: sd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(raw), `"descriptor":{"version":3,`)
+	var fromJson record
+	assert.NoError(t, json.Unmarshal(raw, &fromJson))
+	assert.Equal(t, encodingTestSddl, fromJson.Descriptor.ToSddl())
+
+	var buffer bytes.Buffer
+	assert.NoError(t, gob.NewEncoder(&buffer).Encode(record{Name: "share", Descriptor: sd}))
+	var fromGob record
+	assert.NoError(t, gob.NewDecoder(&buffer).Decode(&fromGob))
+	assert.Equal(t, encodingTestSddl, fromGob.Descriptor.ToSddl())
+}
+
+func TestSecurityDescriptor_ByValue(t *testing.T) {
+	type record struct {
+		Name       string             `json:"name"`
+		Descriptor SecurityDescriptor `json:"descriptor"`
+	}
+	sd, err := ParseSDDL(encodingTestSddl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := json.Marshal(record{Name: "share", Descriptor: *sd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(raw), `"descriptor":{"version":3,`)
+	var fromJson record
+	assert.NoError(t, json.Unmarshal(raw, &fromJson))
+	assert.Equal(t, encodingTestSddl, fromJson.Descriptor.ToSddl())
+
+	var buffer bytes.Buffer
+	assert.NoError(t, gob.NewEncoder(&buffer).Encode(record{Name: "share", Descriptor: *sd}))
+	var fromGob record
+	assert.NoError(t, gob.NewDecoder(&buffer).Decode(&fromGob))
+	assert.Equal(t, encodingTestSddl, fromGob.Descriptor.ToSddl())
+
+	var valuer driver.Valuer = *sd
+	value, err := valuer.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := sd.ToBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, expected, value)
+}
+
+func TestSecurityDescriptorColumn(t *testing.T) {
+	sd, err := ParseSDDL(encodingTestSddl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, encoding := range []ColumnEncoding{ColumnBinary, ColumnSddl, ColumnJson} {
+		value, err := SecurityDescriptorColumn{Descriptor: sd, Encoding: encoding}.Value()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encoding == ColumnSddl {
+			assert.Equal(t, encodingTestSddl, value)
+		}
+
+		column := &SecurityDescriptorColumn{}
+		assert.NoError(t, column.Scan(value))
+		assert.Equal(t, encodingTestSddl, column.Descriptor.ToSddl())
+
+		scanned := &SecurityDescriptor{}
+		assert.NoError(t, scanned.Scan(value))
+		assert.Equal(t, encodingTestSddl, scanned.ToSddl())
+	}
+
+	value, err := SecurityDescriptorColumn{}.Value()
+	assert.NoError(t, err)
+	assert.Nil(t, value)
+	column := &SecurityDescriptorColumn{Descriptor: sd}
+	assert.NoError(t, column.Scan(nil))
+	assert.Nil(t, column.Descriptor)
+	assert.Error(t, sd.Scan(nil))
+	assert.Error(t, sd.Scan(42))
+}
@@ -0,0 +1,191 @@
+package winsddlconverter
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+)
+
+// JsonSchemaVersion is the version written by ToJson.
+//
+//	1: no version field, written before versions were introduced
+//	2: adds the version field
+//	3: adds applicationData to ACEs
+const JsonSchemaVersion = 3
+
+//go:embed schema/*.json
+var jsonSchemas embed.FS
+
+// JsonSchema returns the published JSON Schema of a version.
+func JsonSchema(version int) ([]byte, error) {
+	if version < 1 || version > JsonSchemaVersion {
+		return nil, fmt.Errorf("unsupported JSON schema version %d", version)
+	}
+	return jsonSchemas.ReadFile(fmt.Sprintf("schema/security-descriptor.v%d.schema.json", version))
+}
+
+// MaskConflictPolicy decides what FromJson does when an access mask contradicts its flags.
+type MaskConflictPolicy uint8
+
+const (
+	MaskConflictReject MaskConflictPolicy = iota
+	MaskConflictPreferMask
+	MaskConflictPreferFlags
+)
+
+// JsonDecodeOptions controls FromJsonWithOptions.
+type JsonDecodeOptions struct {
+	MaskConflict MaskConflictPolicy
+	// SkipValidation returns descriptors that Validate reports errors for
+	SkipValidation bool
+}
+
+type versionedDescriptor struct {
+	Version int `json:"version"`
+	*plainDescriptor
+}
+
+type jsonAccessMask struct {
+	Mask       *uint32  `json:"mask"`
+	Flags      []string `json:"flags"`
+	HasUnknown bool     `json:"hasUnknown"`
+}
+
+type jsonAce struct {
+	AceType             AceType        `json:"aceType"`
+	AceFlags            AceFlags       `json:"aceFlags"`
+	AccessMask          jsonAccessMask `json:"accessMask"`
+	ObjectType          string         `json:"objectType"`
+	InheritedObjectType string         `json:"inheritedObjectType"`
+	Sid                 string         `json:"sid"`
+	ApplicationData     []byte         `json:"applicationData"`
+}
+
+type jsonAcl struct {
+	AclRevision uint8     `json:"aclRevision"`
+	Aces        []jsonAce `json:"aces"`
+}
+
+type jsonDescriptor struct {
+	Version          *int                        `json:"version"`
+	Control          SECURITY_DESCRIPTOR_CONTROL `json:"control"`
+	RMControl        uint8                       `json:"rmControl"`
+	Owner            string                      `json:"owner"`
+	Group            string                      `json:"group"`
+	DiscretionaryAcl *jsonAcl                    `json:"dacl"`
+	SystemAcl        *jsonAcl                    `json:"sacl"`
+}
+
+func (sd *SecurityDescriptor) ToJson() ([]byte, error) {
+	return json.MarshalIndent(sd, "", "    ")
+}
+
+// FromJson reads JSON written by ToJson of any schema version and validates the result.
+// An access mask whose flags contradict its mask is rejected.
+func FromJson(data []byte) (*SecurityDescriptor, error) {
+	return FromJsonWithOptions(data, &JsonDecodeOptions{})
+}
+
+func FromJsonWithOptions(data []byte, opts *JsonDecodeOptions) (*SecurityDescriptor, error) {
+	var doc jsonDescriptor
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid security descriptor JSON: %v", err)
+	}
+
+	version := 1
+	if doc.Version != nil {
+		version = *doc.Version
+	}
+	if version < 1 || version > JsonSchemaVersion {
+		return nil, fmt.Errorf("unsupported JSON schema version %d", version)
+	}
+
+	sd := &SecurityDescriptor{
+		Control:   doc.Control,
+		RMControl: doc.RMControl,
+		Owner:     doc.Owner,
+		Group:     doc.Group,
+	}
+	var err error
+	if sd.DiscretionaryAcl, err = doc.DiscretionaryAcl.decode("dacl", opts); err != nil {
+		return nil, err
+	}
+	if sd.SystemAcl, err = doc.SystemAcl.decode("sacl", opts); err != nil {
+		return nil, err
+	}
+
+	if !opts.SkipValidation {
+		if err := validationError(sd.Validate()); err != nil {
+			return nil, err
+		}
+	}
+	return sd, nil
+}
+
+func (j *jsonAcl) decode(path string, opts *JsonDecodeOptions) (*Acl, error) {
+	if j == nil {
+		return nil, nil
+	}
+	acl := &Acl{AclRevision: j.AclRevision, Aces: make([]Ace, 0, len(j.Aces))}
+	for i, a := range j.Aces {
+		mask, err := a.AccessMask.resolve(opts.MaskConflict)
+		if err != nil {
+			return nil, fmt.Errorf("%s.aces[%d].accessMask: %v", path, i, err)
+		}
+		acl.Aces = append(acl.Aces, Ace{
+			AceType:             a.AceType,
+			AceFlags:            a.AceFlags,
+			AccessMask:          mask,
+			ObjectType:          a.ObjectType,
+			InheritedObjectType: a.InheritedObjectType,
+			Sid:                 a.Sid,
+			ApplicationData:     a.ApplicationData,
+		})
+	}
+	return acl, nil
+}
+
+// resolve returns the mask, checking it against the flags.
+// hasUnknown means the mask has bits that the flags do not cover.
+func (j *jsonAccessMask) resolve(policy MaskConflictPolicy) (AccessMask, error) {
+	var fromFlags AccessMask
+	for _, flag := range j.Flags {
+		right, ok := accessRightTokens[flag]
+		if !ok {
+			return 0, fmt.Errorf("unknown access right %q", flag)
+		}
+		fromFlags |= AccessMask(right)
+	}
+	if j.Mask == nil {
+		if j.HasUnknown {
+			return 0, fmt.Errorf("hasUnknown without mask")
+		}
+		return fromFlags, nil
+	}
+
+	mask := AccessMask(*j.Mask)
+	if j.Flags == nil {
+		return mask, nil
+	}
+	consistent := fromFlags == mask
+	if j.HasUnknown {
+		consistent = mask.Has(fromFlags) && mask != fromFlags
+	}
+	if consistent {
+		return mask, nil
+	}
+	switch policy {
+	case MaskConflictPreferMask:
+		return mask, nil
+	case MaskConflictPreferFlags:
+		if j.HasUnknown {
+			return fromFlags | mask.Unknown(), nil
+		}
+		return fromFlags, nil
+	default:
+		return 0, fmt.Errorf("mask 0x%x contradicts flags %v", uint32(mask), j.Flags)
+	}
+}
@@ -0,0 +1,78 @@
+package winsddlconverter
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFromJson_RoundTrip(t *testing.T) {
+	sd, err := ParseSDDL("O:BAG:SYD:PAI(A;OICI;FA;;;BA)(A;;0x1200a9;;;WD)(OA;;CR;ab721a53-1e2f-11d0-9819-00aa0040529b;;AU)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := sd.ToJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(raw), `"version": 3`)
+
+	got, err := FromJson(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, sd.ToSddl(), got.ToSddl())
+	assert.Equal(t, sd.Control, got.Control)
+}
+
+func TestFromJson(t *testing.T) {
+	const v1 = `{"control":4,"owner":"S-1-5-32-544","dacl":{"aclRevision":2,"aces":[
+		{"aceType":0,"aceFlags":["OI","CI"],"accessMask":{"mask":%s,"flags":%s,"hasUnknown":%s},"sid":"BA"}]}}`
+
+	tests := []struct {
+		name    string
+		json    string
+		opts    *JsonDecodeOptions
+		want    string
+		wantErr bool
+	}{
+		{"v1", fmt.Sprintf(v1, "2032127", `["FA"]`, "false"), &JsonDecodeOptions{}, "O:BAD:(A;OICI;FA;;;BA)", false},
+		{"v1 flags only", `{"control":4,"dacl":{"aces":[{"aceType":0,"accessMask":{"flags":["GR","GX"]},"sid":"WD"}]}}`, &JsonDecodeOptions{}, "D:(A;;GXGR;;;WD)", false},
+		{"unknown bits", fmt.Sprintf(v1, "1179817", `["SY"]`, "true"), &JsonDecodeOptions{}, "O:BAD:(A;OICI;0x1200a9;;;BA)", false},
+		{"conflict", fmt.Sprintf(v1, "2032127", `["GR"]`, "false"), &JsonDecodeOptions{}, "", true},
+		{"conflict prefer mask", fmt.Sprintf(v1, "2032127", `["GR"]`, "false"), &JsonDecodeOptions{MaskConflict: MaskConflictPreferMask}, "O:BAD:(A;OICI;FA;;;BA)", false},
+		{"conflict prefer flags", fmt.Sprintf(v1, "2032127", `["GR"]`, "false"), &JsonDecodeOptions{MaskConflict: MaskConflictPreferFlags}, "O:BAD:(A;OICI;GR;;;BA)", false},
+		{"unknown right", fmt.Sprintf(v1, "2032127", `["XX"]`, "false"), &JsonDecodeOptions{}, "", true},
+		{"unknown field", `{"control":0,"dcl":{}}`, &JsonDecodeOptions{}, "", true},
+		{"future version", `{"version":4,"control":0}`, &JsonDecodeOptions{}, "", true},
+		{"invalid sid", `{"version":2,"control":0,"owner":"S-1-x"}`, &JsonDecodeOptions{}, "", true},
+		{"invalid sid unchecked", `{"version":2,"control":0,"owner":"S-1-x"}`, &JsonDecodeOptions{SkipValidation: true}, "O:S-1-x", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromJsonWithOptions([]byte(tt.json), tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FromJsonWithOptions() error = %+v, wantErr %+v", err, tt.wantErr)
+			}
+			if err == nil {
+				assert.Equal(t, tt.want, got.ToSddl())
+			}
+		})
+	}
+}
+
+func TestJsonSchema(t *testing.T) {
+	for version := 1; version <= JsonSchemaVersion; version++ {
+		raw, err := JsonSchema(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var schema map[string]interface{}
+		assert.NoError(t, json.Unmarshal(raw, &schema))
+		_, hasVersion := schema["properties"].(map[string]interface{})["version"]
+		assert.Equal(t, version > 1, hasVersion)
+	}
+	_, err := JsonSchema(JsonSchemaVersion + 1)
+	assert.Error(t, err)
+}
@@ -8,19 +8,31 @@ import (
 	"strings"
 )
 
+// ToBinary converts the descriptor to self-relative format using sd.Layout,
+// or NtfsLayout when the descriptor was not read by ParseBinary.
 func (sd *SecurityDescriptor) ToBinary() ([]byte, error) {
-	var buffer bytes.Buffer
-	var offsets struct {
-		owner, group, sacl, dacl uint32
+	layout := sd.Layout
+	if layout == nil {
+		layout = NtfsLayout()
 	}
+	return sd.ToBinaryWithLayout(layout)
+}
+
+func (sd *SecurityDescriptor) ToBinaryWithLayout(layout *BinaryLayout) ([]byte, error) {
+	var buffer bytes.Buffer
+	var offsets [4]uint32
 
 	// Start with the fixed-size header
 	// Revision (1 byte), Sbz1 (1 byte), Control (2 bytes)
-	err := binary.Write(&buffer, binary.LittleEndian, uint8(1)) // Revision
+	err := binary.Write(&buffer, binary.LittleEndian, uint8(SECURITY_DESCRIPTOR_REVISION))
 	if err != nil {
 		return nil, fmt.Errorf("failed to write revision: %v", err)
 	}
-	err = binary.Write(&buffer, binary.LittleEndian, uint8(0)) // Sbz1 (reserved)
+	sbz1 := layout.sbz1
+	if sd.Control&SE_RM_CONTROL_VALID != 0 {
+		sbz1 = sd.RMControl
+	}
+	err = binary.Write(&buffer, binary.LittleEndian, sbz1) // Sbz1 (resource manager control)
 	if err != nil {
 		return nil, fmt.Errorf("failed to write sbz1: %v", err)
 	}
@@ -37,45 +49,47 @@ func (sd *SecurityDescriptor) ToBinary() ([]byte, error) {
 	offsetStructure := make([]byte, 16) // 4 * 4-byte offsets
 	buffer.Write(offsetStructure)
 
-	// Convert and store SACL
-	if sd.SystemAcl != nil {
-		offsets.sacl = uint32(buffer.Len())
-		saclBytes, err := marshalAcl(sd.SystemAcl)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal SACL: %v", err)
-		}
-		buffer.Write(saclBytes)
-	}
-
-	// Convert and store DACL
-	if sd.DiscretionaryAcl != nil {
-		offsets.dacl = uint32(buffer.Len())
-		daclBytes, err := marshalAcl(sd.DiscretionaryAcl)
-		if err != nil {
-			return nil, fmt.Errorf("failed to marshal DACL: %v", err)
-		}
-		buffer.Write(daclBytes)
-	}
-
-	// Convert and store Owner SID
-	if sd.Owner != "" {
-		offsets.owner = uint32(buffer.Len())
-		ownerSID, err := MarshalSidFromString(sd.Owner)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse owner SID: %v", err)
-		}
-		buffer.Write(ownerSID)
-	}
-
-	// Convert and store Group SID
-	if sd.Group != "" {
-		offsets.group = uint32(buffer.Len())
-		groupSID, err := MarshalSidFromString(sd.Group)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse group SID: %v", err)
+	for _, part := range layout.parts() {
+		var partBytes []byte
+		switch part {
+		case PartOwner:
+			if sd.Owner == "" {
+				continue
+			}
+			partBytes, err = MarshalSidFromString(sd.Owner)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse owner SID: %v", err)
+			}
+		case PartGroup:
+			if sd.Group == "" {
+				continue
+			}
+			partBytes, err = MarshalSidFromString(sd.Group)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse group SID: %v", err)
+			}
+		case PartSacl:
+			if sd.SystemAcl == nil {
+				continue
+			}
+			partBytes, err = marshalAcl(sd.SystemAcl, layout.AclRevision, layout.aclSlack[PartSacl])
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal SACL: %v", err)
+			}
+		case PartDacl:
+			if sd.DiscretionaryAcl == nil {
+				continue
+			}
+			partBytes, err = marshalAcl(sd.DiscretionaryAcl, layout.AclRevision, layout.aclSlack[PartDacl])
+			if err != nil {
+				return nil, fmt.Errorf("failed to marshal DACL: %v", err)
+			}
 		}
-		buffer.Write(groupSID)
+		buffer.Write(layout.padding(part, buffer.Len()))
+		offsets[part] = uint32(buffer.Len())
+		buffer.Write(partBytes)
 	}
+	buffer.Write(layout.trailing)
 
 	// Update control flags
 	controlFlags := sd.Control | SE_SELF_RELATIVE // Important: Set Self-Relative flag
@@ -91,23 +105,9 @@ func (sd *SecurityDescriptor) ToBinary() ([]byte, error) {
 	binary.LittleEndian.PutUint16(controlBytes, uint16(controlFlags))
 	copy(buffer.Bytes()[controlOffset:controlOffset+2], controlBytes)
 
-	// Update offsets
-	offsetBytes := make([]byte, 4)
-	if offsets.owner > 0 {
-		binary.LittleEndian.PutUint32(offsetBytes, offsets.owner)
-		copy(buffer.Bytes()[offsetsOffset:offsetsOffset+4], offsetBytes)
-	}
-	if offsets.group > 0 {
-		binary.LittleEndian.PutUint32(offsetBytes, offsets.group)
-		copy(buffer.Bytes()[offsetsOffset+4:offsetsOffset+8], offsetBytes)
-	}
-	if offsets.sacl > 0 {
-		binary.LittleEndian.PutUint32(offsetBytes, offsets.sacl)
-		copy(buffer.Bytes()[offsetsOffset+8:offsetsOffset+12], offsetBytes)
-	}
-	if offsets.dacl > 0 {
-		binary.LittleEndian.PutUint32(offsetBytes, offsets.dacl)
-		copy(buffer.Bytes()[offsetsOffset+12:offsetsOffset+16], offsetBytes)
+	// Update offsets: owner, group, sacl, dacl
+	for i, part := range []SecurityDescriptorPart{PartOwner, PartGroup, PartSacl, PartDacl} {
+		binary.LittleEndian.PutUint32(buffer.Bytes()[offsetsOffset+i*4:offsetsOffset+i*4+4], offsets[part])
 	}
 
 	return buffer.Bytes(), nil
@@ -132,6 +132,9 @@ func MarshalSidFromString(sidString string) ([]byte, error) {
 	sidBytes = append(sidBytes, 1)
 
 	// SubAuthority Count (derived from number of parts)
+	if len(parts)-3 > SID_MAX_SUB_AUTHORITIES {
+		return nil, fmt.Errorf("SID has %d sub-authorities, maximum is %d", len(parts)-3, SID_MAX_SUB_AUTHORITIES)
+	}
 	sidBytes = append(sidBytes, uint8(len(parts)-3))
 
 	// Parse and add Identifier Authority (last 6 bytes of first part)
@@ -167,12 +170,26 @@ func parseUint32(s string) (uint32, error) {
 	return val, nil
 }
 
-// marshalAcl converts an ACL struct to its binary representation
-func marshalAcl(acl *Acl) ([]byte, error) {
+// marshalAcl converts an ACL struct to its binary representation.
+// A non-zero revision overrides acl.AclRevision, and slack is appended after the ACEs.
+func marshalAcl(acl *Acl, revision uint8, slack []byte) ([]byte, error) {
 	var buffer bytes.Buffer
 
+	if revision == 0 {
+		revision = acl.AclRevision
+	}
+	required := acl.RequiredRevision()
+	if revision == 0 {
+		revision = required
+	} else if revision < required {
+		return nil, fmt.Errorf("ACL revision %d cannot contain object ACEs, revision %d is required", revision, required)
+	}
+	if len(acl.Aces) > MAX_ACE_COUNT {
+		return nil, fmt.Errorf("ACL has %d ACEs, maximum is %d", len(acl.Aces), MAX_ACE_COUNT)
+	}
+
 	// ACL Header
-	err := binary.Write(&buffer, binary.LittleEndian, uint8(acl.AclRevision)) // Revision
+	err := binary.Write(&buffer, binary.LittleEndian, revision) // Revision
 	if err != nil {
 		return nil, fmt.Errorf("failed to write ACL revision: %v", err)
 	}
@@ -188,9 +205,6 @@ func marshalAcl(acl *Acl) ([]byte, error) {
 		return nil, fmt.Errorf("failed to write ACL size: %v", err)
 	}
 
-	// Placeholder for ACE count
-	aceCountOffset := buffer.Len()
-	_ = aceCountOffset
 	err = binary.Write(&buffer, binary.LittleEndian, uint16(len(acl.Aces)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to write ACE count: %v", err)
@@ -198,16 +212,23 @@ func marshalAcl(acl *Acl) ([]byte, error) {
 
 	// Sbz2
 	err = binary.Write(&buffer, binary.LittleEndian, uint16(0))
+	if err != nil {
+		return nil, fmt.Errorf("failed to write ACL reserved word: %v", err)
+	}
 
 	// Marshal ACEs
-	for _, ace := range acl.Aces {
+	for i, ace := range acl.Aces {
 		if err := marshalAce(&buffer, ace); err != nil {
-			return nil, fmt.Errorf("failed to marshal ACE: %v", err)
+			return nil, fmt.Errorf("failed to marshal ACE #%d: %v", i, err)
 		}
 	}
+	buffer.Write(slack)
 
 	// Update ACL size
 	aclSize := buffer.Len()
+	if aclSize > MAX_ACL_SIZE {
+		return nil, fmt.Errorf("ACL size %d exceeds maximum of %d bytes", aclSize, MAX_ACL_SIZE)
+	}
 	sizeBytes := make([]byte, 2)
 	binary.LittleEndian.PutUint16(sizeBytes, uint16(aclSize))
 	copy(buffer.Bytes()[sizeOffset:sizeOffset+2], sizeBytes)
@@ -217,21 +238,27 @@ func marshalAcl(acl *Acl) ([]byte, error) {
 
 // marshalAce converts an individual ACE to its binary representation
 func marshalAce(buffer *bytes.Buffer, ace Ace) error {
-	// Determine ACE flags
-	var aceFlags uint8
-	for _, flag := range ace.AceFlags {
-		switch flag {
-		case "OI":
-			aceFlags |= OBJECT_INHERIT_ACE
-		case "CI":
-			aceFlags |= CONTAINER_INHERIT_ACE
-		case "NP":
-			aceFlags |= NO_PROPAGATE_INHERIT_ACE
-		case "IO":
-			aceFlags |= INHERIT_ONLY_ACE
-		case "ID":
-			aceFlags |= INHERITED_ACE
+	var body []byte
+
+	// Object ACEs: Flags, ObjectType and InheritedObjectType
+	if ace.AceType.IsObject() {
+		var objectFlags uint32
+		var guids []byte
+		for i, guid := range []string{ace.ObjectType, ace.InheritedObjectType} {
+			if guid == "" {
+				continue
+			}
+			guidBytes, err := marshalGuid(guid)
+			if err != nil {
+				return err
+			}
+			objectFlags |= 1 << i
+			guids = append(guids, guidBytes...)
 		}
+		body = binary.LittleEndian.AppendUint32(body, objectFlags)
+		body = append(body, guids...)
+	} else if ace.ObjectType != "" || ace.InheritedObjectType != "" {
+		return fmt.Errorf("object GUID on non-object ACE type %s", ace.AceType)
 	}
 
 	// Convert SID to bytes
@@ -239,16 +266,31 @@ func marshalAce(buffer *bytes.Buffer, ace Ace) error {
 	if err != nil {
 		return fmt.Errorf("failed to convert SID: %v", err)
 	}
+	body = append(body, sidBytes...)
+	if len(ace.ApplicationData) > 0 && !ace.AceType.hasApplicationData() {
+		return fmt.Errorf("application data on ACE type %s", ace.AceType)
+	}
+	body = append(body, ace.ApplicationData...)
+
+	// Keep the padding read by ParseBinary, otherwise align the ACE to a DWORD
+	padding := ace.padding
+	if padding == nil && len(body)%4 != 0 {
+		padding = make([]byte, 4-len(body)%4)
+	}
 
-	// Calculate ACE size
-	aceSize := uint16(8 + len(sidBytes)) // Header + Mask + SID length
+	// Calculate ACE size: Header + Mask + body + padding
+	size := 8 + len(body) + len(padding)
+	if size > 0xffff {
+		return fmt.Errorf("ACE size %d exceeds maximum of %d bytes", size, 0xffff)
+	}
+	aceSize := uint16(size)
 
 	// Write ACE header
 	err = binary.Write(buffer, binary.LittleEndian, uint8(ace.AceType))
 	if err != nil {
 		return err
 	}
-	err = binary.Write(buffer, binary.LittleEndian, aceFlags)
+	err = binary.Write(buffer, binary.LittleEndian, uint8(ace.AceFlags))
 	if err != nil {
 		return err
 	}
@@ -258,13 +300,13 @@ func marshalAce(buffer *bytes.Buffer, ace Ace) error {
 	}
 
 	// Write access mask
-	err = binary.Write(buffer, binary.LittleEndian, ace.AccessMask.Mask)
+	err = binary.Write(buffer, binary.LittleEndian, uint32(ace.AccessMask))
 	if err != nil {
 		return err
 	}
 
-	// Write SID
-	buffer.Write(sidBytes)
+	buffer.Write(body)
+	buffer.Write(padding)
 
 	return nil
 }
@@ -2,6 +2,7 @@ package winsddlconverter
 
 import (
 	"encoding/hex"
+	"encoding/json"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -12,12 +13,11 @@ func TestSecurityDescriptor_ToSddl(t *testing.T) {
 		hex  string
 		sddl string
 	}{
-		//// same but order is different...
-		//{
-		//	"C:/Windows",
-		//	"0100049414000000340000000000000054000000010600000000000550000000b589fb381984c2cb5c6c236d5700776ec0026487010600000000000550000000b589fb381984c2cb5c6c236d5700776ec0026487020054010d00000000002800ff011f00010600000000000550000000b589fb381984c2cb5c6c236d5700776ec0026487000a280000000010010600000000000550000000b589fb381984c2cb5c6c236d5700776ec002648700001400bf011300010100000000000512000000000b14000000001001010000000000051200000000001800bf01130001020000000000052000000020020000000b1800000000100102000000000005200000002002000000001800a900120001020000000000052000000021020000000b1800000000a001020000000000052000000021020000000b14000000001001010000000000030000000000001800a9001200010200000000000f0200000001000000000b1800000000a0010200000000000f020000000100000000001800a9001200010200000000000f0200000002000000000b1800000000a0010200000000000f0200000002000000",
-		//	"O:S-1-5-80-956008885-3418522649-1831038044-1853292631-2271478464G:S-1-5-80-956008885-3418522649-1831038044-1853292631-2271478464D:(A;OICIIO;GA;;;CO)(A;OICIIO;GA;;;SY)(A;;0x1301bf;;;SY)(A;OICIIO;GA;;;BA)(A;;0x1301bf;;;BA)(A;OICIIO;GXGR;;;BU)(A;;0x1200a9;;;BU)(A;CIIO;GA;;;S-1-5-80-956008885-3418522649-1831038044-1853292631-2271478464)(A;;FA;;;S-1-5-80-956008885-3418522649-1831038044-1853292631-2271478464)(A;;0x1200a9;;;AC)(A;OICIIO;GXGR;;;AC)(A;;0x1200a9;;;S-1-15-2-2)(A;OICIIO;GXGR;;;S-1-15-2-2)",
-		//},
+		{
+			"C:/Windows",
+			"0100049414000000340000000000000054000000010600000000000550000000b589fb381984c2cb5c6c236d5700776ec0026487010600000000000550000000b589fb381984c2cb5c6c236d5700776ec0026487020054010d00000000002800ff011f00010600000000000550000000b589fb381984c2cb5c6c236d5700776ec0026487000a280000000010010600000000000550000000b589fb381984c2cb5c6c236d5700776ec002648700001400bf011300010100000000000512000000000b14000000001001010000000000051200000000001800bf01130001020000000000052000000020020000000b1800000000100102000000000005200000002002000000001800a900120001020000000000052000000021020000000b1800000000a001020000000000052000000021020000000b14000000001001010000000000030000000000001800a9001200010200000000000f0200000001000000000b1800000000a0010200000000000f020000000100000000001800a9001200010200000000000f0200000002000000000b1800000000a0010200000000000f0200000002000000",
+			"O:S-1-5-80-956008885-3418522649-1831038044-1853292631-2271478464G:S-1-5-80-956008885-3418522649-1831038044-1853292631-2271478464D:PAI(A;;FA;;;S-1-5-80-956008885-3418522649-1831038044-1853292631-2271478464)(A;CIIO;GA;;;S-1-5-80-956008885-3418522649-1831038044-1853292631-2271478464)(A;;0x1301bf;;;SY)(A;OICIIO;GA;;;SY)(A;;0x1301bf;;;BA)(A;OICIIO;GA;;;BA)(A;;0x1200a9;;;BU)(A;OICIIO;GXGR;;;BU)(A;OICIIO;GA;;;CO)(A;;0x1200a9;;;AC)(A;OICIIO;GXGR;;;AC)(A;;0x1200a9;;;S-1-15-2-2)(A;OICIIO;GXGR;;;S-1-15-2-2)",
+		},
 		{
 			"C:/testdir",
 			"0100048488000000a40000000000000014000000020074000500000000131800ff011f000102000000000005200000002002000000131400ff011f0001010000000000051200000000131800a90012000102000000000005200000002102000000101400bf01130001010000000000050b000000001b1400000001e001010000000000050b000000010500000000000515000000d5f5e336d1deab50504a58b6e9030000010500000000000515000000d5f5e336d1deab50504a58b601020000",
@@ -57,3 +57,185 @@ func TestSecurityDescriptor_ToSddl(t *testing.T) {
 		})
 	}
 }
+
+func TestSecurityDescriptor_ToBinaryWithLayout(t *testing.T) {
+	sd, err := ParseSDDL("O:BAG:SYD:PAI(A;;0x1200a9;;;WD)(A;;FA;;;BA)(A;;0x12019f;;;SY)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		layout *BinaryLayout
+		hex    string
+	}{
+		{
+			"ntfs",
+			NtfsLayout(),
+			"010004945c0000006c00000000000000140000000200480003000000" +
+				"00001400a900120001010000000000010000000000001800ff011f0001020000000000052000000020020000000014009f011200010100000000000512000000" +
+				"01020000000000052000000020020000010100000000000512000000",
+		},
+		{
+			"security info",
+			SecurityInfoLayout(),
+			"0100049414000000240000000000000030000000" +
+				"01020000000000052000000020020000010100000000000512000000" +
+				"020048000300000000001400a900120001010000000000010000000000001800ff011f0001020000000000052000000020020000000014009f011200010100000000000512000000",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := sd.ToBinaryWithLayout(tt.layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, tt.hex, hex.EncodeToString(raw))
+		})
+	}
+}
+
+func TestParseBinary_PreservesPadding(t *testing.T) {
+	// owner and DACL separated by 4 bytes of padding, ACL with 4 spare bytes and trailing garbage
+	input := "010004841800000000000000000000002c000000" +
+		"aabbccdd" +
+		"01020000000000052000000020020000" +
+		"eeff0011" +
+		"020020000100000000001400ff011f00010100000000000512000000" + "00000000" +
+		"deadbeef"
+	raw, err := hex.DecodeString(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := ParseBinary(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "BA", sd.Owner)
+	assert.Equal(t, "(A;;FA;;;SY)", sd.DiscretionaryAcl.ToSddlPart())
+
+	generated, err := sd.ToBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, input, hex.EncodeToString(generated))
+}
+
+func TestParseBinary_PreservesSbz1(t *testing.T) {
+	// Sbz1 of 5 without SE_RM_CONTROL_VALID
+	input := "010504801400000000000000000000002400000001020000000000052000000020020000" +
+		"02001c000100000000001400ff011f00010100000000000512000000"
+	raw, err := hex.DecodeString(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd, err := ParseBinary(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint8(0), sd.RMControl)
+
+	generated, err := sd.ToBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, input, hex.EncodeToString(generated))
+}
+
+func TestSecurityDescriptor_ToBinary_ObjectAces(t *testing.T) {
+	sddl := "O:BAG:BAD:(OA;CI;0x100;00299570-246d-11d0-a768-00aa006e0529;bf967aba-0de6-11d0-a285-00aa003049e2;AU)(A;;RC;;;AU)S:(AU;SAFA;WDWO;;;WD)"
+	sd, err := ParseSDDL(sddl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint8(ACL_REVISION_DS), sd.DiscretionaryAcl.AclRevision)
+	assert.Equal(t, uint8(ACL_REVISION), sd.SystemAcl.AclRevision)
+
+	raw, err := sd.ToBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseBinary(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, sddl, parsed.ToSddl())
+
+	sd.DiscretionaryAcl.AclRevision = ACL_REVISION
+	_, err = sd.ToBinary()
+	assert.Error(t, err)
+}
+
+func TestSecurityDescriptor_ToBinary_Limits(t *testing.T) {
+	tests := []struct {
+		name string
+		sd   *SecurityDescriptor
+	}{
+		{
+			"too many sub-authorities",
+			&SecurityDescriptor{Owner: "S-1-5-21-1-2-3-4-5-6-7-8-9-10-11-12-13-14-15"},
+		},
+		{
+			"oversize ACL",
+			&SecurityDescriptor{DiscretionaryAcl: &Acl{Aces: make([]Ace, 3300)}},
+		},
+		{
+			"too many ACEs",
+			&SecurityDescriptor{DiscretionaryAcl: &Acl{Aces: make([]Ace, MAX_ACE_COUNT+1)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.sd.DiscretionaryAcl != nil {
+				for i := range tt.sd.DiscretionaryAcl.Aces {
+					tt.sd.DiscretionaryAcl.Aces[i].Sid = "S-1-5-21-1-2-3-1001"
+				}
+			}
+			_, err := tt.sd.ToBinary()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSecurityDescriptor_ControlRoundTrip(t *testing.T) {
+	sd, err := ParseSDDL("O:BAG:SYD:AR(A;;FA;;;SY)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd.Control |= SE_OWNER_DEFAULTED | SE_DACL_DEFAULTED
+	sd.SetRMControl(0x5a)
+
+	raw, err := sd.ToBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, uint8(0x5a), raw[1])
+	assert.True(t, IsValidSecurityDescriptor(raw))
+
+	parsed, err := ParseBinary(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, sd.Control|SE_SELF_RELATIVE|SE_DACL_PRESENT, parsed.Control)
+	rm, ok := parsed.GetRMControl()
+	assert.True(t, ok)
+	assert.Equal(t, uint8(0x5a), rm)
+
+	raw, err = parsed.ToJson()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJson := &SecurityDescriptor{}
+	if err := json.Unmarshal(raw, fromJson); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, parsed.Control, fromJson.Control)
+	assert.Equal(t, parsed.RMControl, fromJson.RMControl)
+
+	sddl, warnings := parsed.ToSddlWithWarnings()
+	assert.Equal(t, "O:BAG:SYD:AR(A;;FA;;;SY)", sddl)
+	assert.Equal(t, []ConversionWarning{
+		{Control: SE_OWNER_DEFAULTED | SE_DACL_DEFAULTED, Message: "control bits SE_OWNER_DEFAULTED|SE_DACL_DEFAULTED have no SDDL syntax"},
+		{Control: SE_RM_CONTROL_VALID, Message: "resource manager control 0x5a has no SDDL syntax"},
+	}, warnings)
+}
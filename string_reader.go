@@ -1,6 +1,10 @@
 package winsddlconverter
 
-import "errors"
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
 
 type stringReader struct {
 	s string
@@ -19,23 +23,37 @@ func (sr *stringReader) Consume(n int) {
 	sr.r += n
 }
 
+// ReadChars reads up to n characters, fewer at the end of the input.
 func (sr *stringReader) ReadChars(n int) string {
+	if n > sr.Len() {
+		n = sr.Len()
+	}
 	c := sr.s[sr.r : sr.r+n]
 	sr.r += n
 	return c
 }
 
-func (sr *stringReader) ReadSid() (string, error) {
+func (sr *stringReader) SkipSpace() {
+	for sr.r < len(sr.s) && unicode.IsSpace(rune(sr.s[sr.r])) {
+		sr.r++
+	}
+}
+
+// ReadSid reads an alias or a "S-..." SID. foldCase accepts lowercase spellings.
+func (sr *stringReader) ReadSid(foldCase bool) (string, error) {
 	head := sr.ReadChars(2)
+	if foldCase {
+		head = strings.ToUpper(head)
+	}
 	if head != "S-" {
 		sid, ok := wellKnownSidsReverse[head]
 		if !ok {
-			return "", errors.New("invalid")
+			return "", errors.New("invalid SID: " + head)
 		}
 		return sid, nil
 	}
 	begin := sr.r
-	for {
+	for sr.r < len(sr.s) {
 		c := sr.s[sr.r]
 		if !(c >= '0' && c <= '9') && c != '-' {
 			break
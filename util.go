@@ -1,5 +1,40 @@
 package winsddlconverter
 
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
 func bitNot(v uint32) uint32 {
 	return v ^ 0xffffffff
 }
+
+// marshalGuid converts "xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx" to the 16-byte GUID structure.
+func marshalGuid(s string) ([]byte, error) {
+	parts := strings.Split(s, "-")
+	if len(parts) != 5 || len(parts[0]) != 8 || len(parts[1]) != 4 || len(parts[2]) != 4 || len(parts[3]) != 4 || len(parts[4]) != 12 {
+		return nil, fmt.Errorf("invalid GUID format: %s", s)
+	}
+	raw, err := hex.DecodeString(strings.Join(parts, ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid GUID format: %s", s)
+	}
+	guid := make([]byte, 16)
+	binary.LittleEndian.PutUint32(guid[0:4], binary.BigEndian.Uint32(raw[0:4]))
+	binary.LittleEndian.PutUint16(guid[4:6], binary.BigEndian.Uint16(raw[4:6]))
+	binary.LittleEndian.PutUint16(guid[6:8], binary.BigEndian.Uint16(raw[6:8]))
+	copy(guid[8:], raw[8:])
+	return guid, nil
+}
+
+// formatGuid converts a 16-byte GUID structure to its lowercase string form.
+func formatGuid(guid []byte) string {
+	return fmt.Sprintf("%08x-%04x-%04x-%x-%x",
+		binary.LittleEndian.Uint32(guid[0:4]),
+		binary.LittleEndian.Uint16(guid[4:6]),
+		binary.LittleEndian.Uint16(guid[6:8]),
+		guid[8:10],
+		guid[10:16])
+}
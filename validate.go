@@ -0,0 +1,461 @@
+package winsddlconverter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type ValidationSeverity uint8
+
+const (
+	// SeverityWarning marks structures Windows accepts but that are unusual or lossy
+	SeverityWarning ValidationSeverity = iota
+	// SeverityError marks structures IsValidSecurityDescriptor, IsValidAcl or IsValidSid would reject
+	SeverityError
+)
+
+func (v ValidationSeverity) String() string {
+	switch v {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return "?"
+	}
+}
+
+// Validation finding codes
+const (
+	FindingTruncated         = "truncated"
+	FindingRevision          = "revision"
+	FindingNotSelfRelative   = "not-self-relative"
+	FindingSbz1              = "sbz1"
+	FindingOffsetOutOfBounds = "offset-out-of-bounds"
+	FindingOffsetInHeader    = "offset-in-header"
+	FindingOffsetUnaligned   = "offset-unaligned"
+	FindingOverlap           = "overlap"
+	FindingNullAcl           = "null-acl"
+	FindingOffsetNotPresent  = "offset-without-present-flag"
+	FindingTrailingData      = "trailing-data"
+	FindingGap               = "gap"
+	FindingSidSubAuthorities = "sid-sub-authorities"
+	FindingAclSize           = "acl-size"
+	FindingAclSizeMismatch   = "acl-size-mismatch"
+	FindingAclReserved       = "acl-reserved"
+	FindingAceSize           = "ace-size"
+	FindingAceSizeUnaligned  = "ace-size-unaligned"
+	FindingAceType           = "ace-type"
+	FindingAceFlags          = "ace-flags"
+	FindingObjectAceRevision = "object-ace-revision"
+	FindingObjectGuid        = "object-guid"
+	FindingSid               = "sid"
+	FindingMarshal           = "marshal"
+	FindingApplicationData   = "application-data"
+)
+
+// ValidationFinding describes one structural problem.
+// Offset is the byte offset in the binary data, or -1 for parsed descriptors.
+// Path locates the problem in a parsed descriptor, e.g. "dacl.aces[2].sid".
+type ValidationFinding struct {
+	Severity ValidationSeverity `json:"severity"`
+	Code     string             `json:"code"`
+	Offset   int                `json:"offset"`
+	Path     string             `json:"path,omitempty"`
+	Message  string             `json:"message"`
+}
+
+func (f ValidationFinding) String() string {
+	if f.Offset >= 0 {
+		return fmt.Sprintf("%s: %s at offset %d: %s", f.Severity, f.Code, f.Offset, f.Message)
+	}
+	if f.Path != "" {
+		return fmt.Sprintf("%s: %s at %s: %s", f.Severity, f.Code, f.Path, f.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Code, f.Message)
+}
+
+func hasValidationError(findings []ValidationFinding) bool {
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidationError is returned for a descriptor with error findings.
+type ValidationError struct {
+	Findings []ValidationFinding
+}
+
+func (e *ValidationError) Error() string {
+	var messages []string
+	for _, f := range e.Findings {
+		if f.Severity == SeverityError {
+			messages = append(messages, f.String())
+		}
+	}
+	return "invalid security descriptor: " + strings.Join(messages, "; ")
+}
+
+// validationError returns a *ValidationError if findings has errors.
+func validationError(findings []ValidationFinding) error {
+	if !hasValidationError(findings) {
+		return nil
+	}
+	return &ValidationError{Findings: findings}
+}
+
+type binaryValidator struct {
+	data     []byte
+	findings []ValidationFinding
+}
+
+func (v *binaryValidator) add(severity ValidationSeverity, code string, offset int, format string, args ...interface{}) {
+	v.findings = append(v.findings, ValidationFinding{
+		Severity: severity,
+		Code:     code,
+		Offset:   offset,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// validateSid checks the SID at offset against limit and returns its end, or -1 if it is unusable.
+func (v *binaryValidator) validateSid(offset int, limit int) int {
+	if offset+8 > limit {
+		v.add(SeverityError, FindingTruncated, offset, "SID header needs 8 bytes, %d available", limit-offset)
+		return -1
+	}
+	if v.data[offset] != 1 {
+		v.add(SeverityError, FindingRevision, offset, "unsupported SID revision %d", v.data[offset])
+	}
+	count := int(v.data[offset+1])
+	if count > SID_MAX_SUB_AUTHORITIES {
+		v.add(SeverityError, FindingSidSubAuthorities, offset, "SID has %d sub-authorities, maximum is %d", count, SID_MAX_SUB_AUTHORITIES)
+	}
+	end := offset + 8 + count*4
+	if end > limit {
+		v.add(SeverityError, FindingTruncated, offset, "SID with %d sub-authorities needs %d bytes, %d available", count, end-offset, limit-offset)
+		return -1
+	}
+	return end
+}
+
+// validateAcl checks the ACL at offset and returns its end according to its header, or -1 if it is unusable.
+func (v *binaryValidator) validateAcl(offset int) int {
+	if offset+8 > len(v.data) {
+		v.add(SeverityError, FindingTruncated, offset, "ACL header needs 8 bytes, %d available", len(v.data)-offset)
+		return -1
+	}
+	revision := v.data[offset]
+	if revision < 2 || revision > ACL_REVISION_DS {
+		v.add(SeverityError, FindingRevision, offset, "unsupported ACL revision %d", revision)
+	}
+	if v.data[offset+1] != 0 {
+		v.add(SeverityWarning, FindingAclReserved, offset+1, "Sbz1 is %d", v.data[offset+1])
+	}
+	aclSize := int(binary.LittleEndian.Uint16(v.data[offset+2:]))
+	aceCount := int(binary.LittleEndian.Uint16(v.data[offset+4:]))
+	if binary.LittleEndian.Uint16(v.data[offset+6:]) != 0 {
+		v.add(SeverityWarning, FindingAclReserved, offset+6, "Sbz2 is %d", binary.LittleEndian.Uint16(v.data[offset+6:]))
+	}
+	if aclSize < 8 {
+		v.add(SeverityError, FindingAclSize, offset+2, "ACL size %d is smaller than its header", aclSize)
+		return -1
+	}
+	if aclSize%4 != 0 {
+		v.add(SeverityError, FindingAclSize, offset+2, "ACL size %d is not a multiple of 4", aclSize)
+	}
+	aclEnd := offset + aclSize
+	if aclEnd > len(v.data) {
+		v.add(SeverityError, FindingTruncated, offset+2, "ACL size %d exceeds the %d bytes available", aclSize, len(v.data)-offset)
+		aclEnd = len(v.data)
+	}
+
+	current := offset + 8
+	for i := 0; i < aceCount; i++ {
+		if current+4 > aclEnd {
+			v.add(SeverityError, FindingAceSize, current, "ACE #%d header exceeds the ACL size", i)
+			return offset + aclSize
+		}
+		aceType := AceType(v.data[current])
+		aceSize := int(binary.LittleEndian.Uint16(v.data[current+2:]))
+		if aceSize < 8 || current+aceSize > aclEnd {
+			v.add(SeverityError, FindingAceSize, current+2, "ACE #%d size %d exceeds the ACL size", i, aceSize)
+			return offset + aclSize
+		}
+		if aceSize%4 != 0 {
+			v.add(SeverityError, FindingAceSizeUnaligned, current+2, "ACE #%d size %d is not a multiple of 4", i, aceSize)
+		}
+		v.validateAceBody(i, aceType, current, current+aceSize, revision)
+		current += aceSize
+	}
+	if current != offset+aclSize {
+		v.add(SeverityWarning, FindingAclSizeMismatch, offset+2, "ACL size is %d but its ACEs end at %d", aclSize, current-offset)
+	}
+	return offset + aclSize
+}
+
+func (v *binaryValidator) validateAceBody(index int, aceType AceType, start int, end int, revision uint8) {
+	sidOffset := start + 8
+	switch {
+	case aceType.IsObject():
+		if revision < ACL_REVISION_DS {
+			v.add(SeverityError, FindingObjectAceRevision, start, "object ACE #%d requires ACL revision %d, found %d", index, ACL_REVISION_DS, revision)
+		}
+		if sidOffset+4 > end {
+			v.add(SeverityError, FindingAceSize, start, "object ACE #%d is too small for its flags", index)
+			return
+		}
+		objectFlags := binary.LittleEndian.Uint32(v.data[sidOffset:])
+		sidOffset += 4
+		if objectFlags&ACE_OBJECT_TYPE_PRESENT != 0 {
+			sidOffset += 16
+		}
+		if objectFlags&ACE_INHERITED_OBJECT_TYPE_PRESENT != 0 {
+			sidOffset += 16
+		}
+		if objectFlags&^uint32(ACE_OBJECT_TYPE_PRESENT|ACE_INHERITED_OBJECT_TYPE_PRESENT) != 0 {
+			v.add(SeverityWarning, FindingObjectGuid, start+8, "object ACE #%d has undefined flags 0x%x", index, objectFlags)
+		}
+	case aceType > ACCESS_MAX_MS_V5_ACE_TYPE:
+		v.add(SeverityError, FindingAceType, start, "ACE #%d has unknown type 0x%x", index, uint8(aceType))
+		return
+	}
+	v.validateSid(sidOffset, end)
+}
+
+// ValidateBinary checks a self-relative SECURITY_DESCRIPTOR as described in MS-DTYP 2.4.6.
+// Unlike ParseBinary, which reads whatever it can, it reports every structural problem found.
+func ValidateBinary(data []byte) []ValidationFinding {
+	v := &binaryValidator{data: data}
+	if len(data) < 20 {
+		v.add(SeverityError, FindingTruncated, 0, "SECURITY_DESCRIPTOR header needs 20 bytes, %d available", len(data))
+		return v.findings
+	}
+	if data[0] != 1 {
+		v.add(SeverityError, FindingRevision, 0, "unsupported SECURITY_DESCRIPTOR revision %d", data[0])
+	}
+	control := SECURITY_DESCRIPTOR_CONTROL(binary.LittleEndian.Uint16(data[2:4]))
+	if control&SE_SELF_RELATIVE == 0 {
+		v.add(SeverityError, FindingNotSelfRelative, 2, "SE_SELF_RELATIVE is not set")
+	}
+	if data[1] != 0 && control&SE_RM_CONTROL_VALID == 0 {
+		v.add(SeverityError, FindingSbz1, 1, "Sbz1 is 0x%x but SE_RM_CONTROL_VALID is not set", data[1])
+	}
+
+	type component struct {
+		part        SecurityDescriptorPart
+		offset      int
+		fieldOffset int
+		present     SECURITY_DESCRIPTOR_CONTROL
+	}
+	components := []component{
+		{PartOwner, int(binary.LittleEndian.Uint32(data[4:8])), 4, 0},
+		{PartGroup, int(binary.LittleEndian.Uint32(data[8:12])), 8, 0},
+		{PartSacl, int(binary.LittleEndian.Uint32(data[12:16])), 12, SE_SACL_PRESENT},
+		{PartDacl, int(binary.LittleEndian.Uint32(data[16:20])), 16, SE_DACL_PRESENT},
+	}
+
+	var spans []layoutSpan
+	for _, c := range components {
+		if c.present != 0 {
+			if c.offset == 0 && control&c.present != 0 {
+				v.add(SeverityWarning, FindingNullAcl, 2, "%s is present with a zero offset, which is a NULL %s granting everything", c.part, c.part)
+			}
+			if c.offset != 0 && control&c.present == 0 {
+				v.add(SeverityError, FindingOffsetNotPresent, c.fieldOffset, "%s offset is %d but its present flag is not set", c.part, c.offset)
+			}
+		}
+		if c.offset == 0 {
+			continue
+		}
+		if c.offset < 20 {
+			v.add(SeverityError, FindingOffsetInHeader, c.fieldOffset, "%s offset %d points into the header", c.part, c.offset)
+			continue
+		}
+		if c.offset >= len(data) {
+			v.add(SeverityError, FindingOffsetOutOfBounds, c.fieldOffset, "%s offset %d is outside the %d byte buffer", c.part, c.offset, len(data))
+			continue
+		}
+		if c.offset%4 != 0 {
+			v.add(SeverityWarning, FindingOffsetUnaligned, c.fieldOffset, "%s offset %d is not DWORD aligned", c.part, c.offset)
+		}
+		var end int
+		if c.part == PartOwner || c.part == PartGroup {
+			end = v.validateSid(c.offset, len(data))
+		} else {
+			end = v.validateAcl(c.offset)
+		}
+		if end > 0 {
+			spans = append(spans, layoutSpan{c.part, c.offset, end})
+		}
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].start < spans[j].start
+	})
+	end := 20
+	for i, span := range spans {
+		if i > 0 && span.start < end {
+			v.add(SeverityError, FindingOverlap, span.start, "%s overlaps %s", span.part, spans[i-1].part)
+		} else if span.start > end {
+			v.add(SeverityWarning, FindingGap, end, "%d unused bytes before %s", span.start-end, span.part)
+		}
+		if span.end > end {
+			end = span.end
+		}
+	}
+	if end < len(data) {
+		v.add(SeverityWarning, FindingTrailingData, end, "%d bytes after the last component", len(data)-end)
+	}
+
+	return v.findings
+}
+
+// ValidateAcl checks a binary ACL as described in MS-DTYP 2.4.5.
+func ValidateAcl(data []byte) []ValidationFinding {
+	v := &binaryValidator{data: data}
+	end := v.validateAcl(0)
+	if end > 0 && end < len(data) {
+		v.add(SeverityWarning, FindingTrailingData, end, "%d bytes after the ACL", len(data)-end)
+	}
+	return v.findings
+}
+
+// ValidateSid checks a binary SID as described in MS-DTYP 2.4.2.2.
+func ValidateSid(data []byte) []ValidationFinding {
+	v := &binaryValidator{data: data}
+	end := v.validateSid(0, len(data))
+	if end > 0 && end < len(data) {
+		v.add(SeverityWarning, FindingTrailingData, end, "%d bytes after the SID", len(data)-end)
+	}
+	return v.findings
+}
+
+// IsValidSecurityDescriptor reports whether ValidateBinary found no errors.
+func IsValidSecurityDescriptor(data []byte) bool {
+	return !hasValidationError(ValidateBinary(data))
+}
+
+// IsValidAcl reports whether ValidateAcl found no errors.
+func IsValidAcl(data []byte) bool {
+	return !hasValidationError(ValidateAcl(data))
+}
+
+// IsValidSid reports whether ValidateSid found no errors.
+func IsValidSid(data []byte) bool {
+	return !hasValidationError(ValidateSid(data))
+}
+
+type descriptorValidator struct {
+	findings []ValidationFinding
+}
+
+func (v *descriptorValidator) add(severity ValidationSeverity, code string, path string, format string, args ...interface{}) {
+	v.findings = append(v.findings, ValidationFinding{
+		Severity: severity,
+		Code:     code,
+		Offset:   -1,
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *descriptorValidator) validateSid(path string, sid string) {
+	if _, err := MarshalSidFromString(sid); err != nil {
+		v.add(SeverityError, FindingSid, path, "invalid SID %q: %v", sid, err)
+	}
+}
+
+func (v *descriptorValidator) validateAcl(path string, acl *Acl) {
+	required := acl.RequiredRevision()
+	if acl.AclRevision != 0 && acl.AclRevision < required {
+		v.add(SeverityError, FindingObjectAceRevision, path+".aclRevision", "ACL revision %d cannot contain object ACEs, revision %d is required", acl.AclRevision, required)
+	}
+	if acl.AclRevision > ACL_REVISION_DS || acl.AclRevision == 1 {
+		v.add(SeverityError, FindingRevision, path+".aclRevision", "unsupported ACL revision %d", acl.AclRevision)
+	}
+	if len(acl.Aces) > MAX_ACE_COUNT {
+		v.add(SeverityError, FindingAclSize, path+".aces", "ACL has %d ACEs, maximum is %d", len(acl.Aces), MAX_ACE_COUNT)
+	}
+
+	for i, ace := range acl.Aces {
+		acePath := fmt.Sprintf("%s.aces[%d]", path, i)
+		if ace.AceType.String() == "?" {
+			v.add(SeverityError, FindingAceType, acePath+".aceType", "unsupported ACE type 0x%x", uint8(ace.AceType))
+		}
+		switch ace.AceType {
+		case SYSTEM_AUDIT_ACE_TYPE, SYSTEM_ALARM_ACE_TYPE, ACCESS_AUDIT_OBJECT_ACE_TYPE, ACCESS_ALARM_OBJECT_ACE_TYPE,
+			SYSTEM_AUDIT_CALLBACK_ACE_TYPE, SYSTEM_ALARM_CALLBACK_ACE_TYPE, SYSTEM_AUDIT_CALLBACK_OBJECT_ACE_TYPE, SYSTEM_ALARM_CALLBACK_OBJECT_ACE_TYPE:
+		default:
+			if ace.AceFlags&(SUCCESSFUL_ACCESS_ACE_FLAG|FAILED_ACCESS_ACE_FLAG) != 0 {
+				v.add(SeverityWarning, FindingAceFlags, acePath+".aceFlags", "audit flags on %s ACE have no effect", ace.AceType)
+			}
+		}
+		if !ace.AceType.IsObject() && (ace.ObjectType != "" || ace.InheritedObjectType != "") {
+			v.add(SeverityError, FindingObjectGuid, acePath, "object GUID on non-object ACE type %s", ace.AceType)
+		}
+		for _, guid := range []string{ace.ObjectType, ace.InheritedObjectType} {
+			if guid == "" {
+				continue
+			}
+			if _, err := marshalGuid(guid); err != nil {
+				v.add(SeverityError, FindingObjectGuid, acePath, "%v", err)
+			}
+		}
+		v.validateSid(acePath+".sid", ace.Sid)
+		v.validateApplicationData(acePath+".applicationData", &ace)
+	}
+
+	if _, err := marshalAcl(acl, 0, nil); err != nil {
+		v.add(SeverityError, FindingMarshal, path, "%v", err)
+	}
+}
+
+// validateApplicationData checks conditional expressions and resource attributes. Callback
+// ACEs may carry data of the application that wrote them instead of an expression.
+func (v *descriptorValidator) validateApplicationData(path string, ace *Ace) {
+	var err error
+	switch {
+	case ace.IsConditional():
+		_, err = ace.Condition()
+	case ace.AceType == SYSTEM_RESOURCE_ATTRIBUTE_ACE_TYPE:
+		_, err = ace.ResourceAttribute()
+	case len(ace.ApplicationData) > 0 && !ace.AceType.IsCallback():
+		err = fmt.Errorf("application data on %s ACE", ace.AceType)
+	}
+	if err != nil {
+		v.add(SeverityError, FindingApplicationData, path, "%v", err)
+	}
+}
+
+// Validate checks that the descriptor can be converted to a valid binary descriptor.
+func (sd *SecurityDescriptor) Validate() []ValidationFinding {
+	v := &descriptorValidator{}
+
+	if sd.Owner != "" {
+		v.validateSid("owner", sd.Owner)
+	}
+	if sd.Group != "" {
+		v.validateSid("group", sd.Group)
+	}
+	if sd.DiscretionaryAcl != nil {
+		v.validateAcl("dacl", sd.DiscretionaryAcl)
+	} else if sd.Control&SE_DACL_PRESENT != 0 {
+		v.add(SeverityWarning, FindingNullAcl, "dacl", "DACL is present but NULL, which grants everything")
+	}
+	if sd.SystemAcl != nil {
+		v.validateAcl("sacl", sd.SystemAcl)
+	}
+
+	return v.findings
+}
+
+// IsValid reports whether Validate found no errors.
+func (sd *SecurityDescriptor) IsValid() bool {
+	return !hasValidationError(sd.Validate())
+}
@@ -0,0 +1,122 @@
+package winsddlconverter
+
+import (
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidateBinary(t *testing.T) {
+	const ownerSid = "01020000000000052000000020020000"
+	const dacl = "02001c000100000000001400ff011f00010100000000000512000000"
+
+	tests := []struct {
+		name  string
+		hex   string
+		codes []string
+		valid bool
+	}{
+		{
+			"valid",
+			"01000480" + "14000000" + "00000000" + "00000000" + "24000000" + ownerSid + dacl,
+			nil,
+			true,
+		},
+		{
+			"null dacl",
+			"01000480" + "14000000" + "00000000" + "00000000" + "00000000" + ownerSid,
+			[]string{FindingNullAcl},
+			true,
+		},
+		{
+			"dacl offset without present flag",
+			"01000080" + "14000000" + "00000000" + "00000000" + "24000000" + ownerSid + dacl,
+			[]string{FindingOffsetNotPresent},
+			false,
+		},
+		{
+			"offset out of bounds",
+			"01000480" + "14000000" + "00000000" + "00000000" + "00010000" + ownerSid,
+			[]string{FindingOffsetOutOfBounds},
+			false,
+		},
+		{
+			"overlap",
+			"01000480" + "14000000" + "14000000" + "00000000" + "24000000" + ownerSid + dacl,
+			[]string{FindingOverlap},
+			false,
+		},
+		{
+			"sbz1 without rm control",
+			"01050480" + "14000000" + "00000000" + "00000000" + "24000000" + ownerSid + dacl,
+			[]string{FindingSbz1},
+			false,
+		},
+		{
+			"sbz1 with rm control",
+			"01050440" + "14000000" + "00000000" + "00000000" + "24000000" + ownerSid + dacl,
+			[]string{FindingNotSelfRelative},
+			false,
+		},
+		{
+			"trailing garbage",
+			"01000480" + "14000000" + "00000000" + "00000000" + "24000000" + ownerSid + dacl + "deadbeef",
+			[]string{FindingTrailingData},
+			true,
+		},
+		{
+			"ace size not aligned",
+			"01000480" + "14000000" + "00000000" + "00000000" + "24000000" + ownerSid +
+				"02001c000100000000001300ff011f00010100000000000512000000",
+			[]string{FindingAceSizeUnaligned, FindingTruncated, FindingAclSizeMismatch},
+			false,
+		},
+		{
+			"acl size larger than aces",
+			"01000480" + "14000000" + "00000000" + "00000000" + "24000000" + ownerSid +
+				"020020000100000000001400ff011f0001010000000000051200000000000000",
+			[]string{FindingAclSizeMismatch},
+			true,
+		},
+		{
+			"truncated header",
+			"01000480",
+			[]string{FindingTruncated},
+			false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := hex.DecodeString(tt.hex)
+			if err != nil {
+				t.Fatal(err)
+			}
+			findings := ValidateBinary(raw)
+			var codes []string
+			for _, f := range findings {
+				codes = append(codes, f.Code)
+			}
+			assert.Equal(t, tt.codes, codes)
+			assert.Equal(t, tt.valid, IsValidSecurityDescriptor(raw))
+		})
+	}
+}
+
+func TestSecurityDescriptor_Validate(t *testing.T) {
+	sd, err := ParseSDDL("O:BAG:SYD:(A;OICI;FA;;;BA)(A;;0x1200a9;;;WD)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, sd.Validate())
+	assert.True(t, sd.IsValid())
+
+	sd.Owner = "S-1-x"
+	sd.DiscretionaryAcl.Aces[0].AceFlags |= SUCCESSFUL_ACCESS_ACE_FLAG
+	sd.DiscretionaryAcl.Aces[1].ObjectType = "bf967aba-0de6-11d0-a285-00aa003049e2"
+	var paths []string
+	for _, f := range sd.Validate() {
+		paths = append(paths, f.Path)
+	}
+	assert.Equal(t, []string{"owner", "dacl.aces[0].aceFlags", "dacl.aces[1]", "dacl"}, paths)
+	assert.False(t, sd.IsValid())
+}